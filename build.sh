@@ -8,11 +8,11 @@ mkdir -p web/static web/images
 # Build WebAssembly
 echo "🏗️  Building WebAssembly module..."
 cd /Users/nathan.nam/Documents/GitHub/NathanNam/incident-commander-game-no-instrumentation
-GOOS=js GOARCH=wasm go build -o web/static/game.wasm cmd/game/main.go
+GOOS=js GOARCH=wasm go build -o web/static/game.wasm ./cmd/game
 
 # Copy WebAssembly support
 echo "📋 Copying WebAssembly support files..."
 cp "$(go env GOROOT)/misc/wasm/wasm_exec.js" web/static/
 
 echo "✅ Build complete!"
-echo "🚀 Run 'go run cmd/server/main.go' to start the server"
\ No newline at end of file
+echo "🚀 Run 'go run ./cmd/server' to start the server"
\ No newline at end of file
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"syscall/js"
+
+	"github.com/NathanNam/incident-commander-game/internal/achievements"
+	"github.com/NathanNam/incident-commander-game/internal/game"
+	"github.com/NathanNam/incident-commander-game/internal/renderer"
+)
+
+// localStorage keys
+const (
+	playerIDKey     = "incident_commander_player_id"
+	playerTokenKey  = "incident_commander_player_token"
+	achievementsKey = "incident_commander_achievements"
+)
+
+// achievementProgress holds the player's unlocked achievements
+var achievementProgress *achievements.Progress
+
+// The player's ID, and the token the server issued for it, which requests
+// acting for the player carry. The token is empty while the server is unreachable.
+var (
+	playerID    string
+	playerToken string
+)
+
+// getPlayerID returns the player's ID. The first call asks the server for an
+// ID and token unless localStorage has them; a player from before tokens gets
+// a new ID and their achievements move to it.
+func getPlayerID() string {
+	if playerID != "" {
+		return playerID
+	}
+	storage := js.Global().Get("localStorage")
+	if token := storage.Call("getItem", playerTokenKey); !token.IsNull() {
+		if id, _, ok := strings.Cut(token.String(), "."); ok {
+			playerID, playerToken = id, token.String()
+			return playerID
+		}
+	}
+
+	var identity struct {
+		PlayerID string `json:"player_id"`
+		Token    string `json:"token"`
+	}
+	data, err := fetchBytes("POST", "/api/players", nil)
+	if err != nil || json.Unmarshal(data, &identity) != nil || identity.Token == "" {
+		playerID = localPlayerID()
+		return playerID
+	}
+
+	if previous := storage.Call("getItem", playerIDKey); !previous.IsNull() {
+		moveAchievements(previous.String(), identity.PlayerID)
+	}
+	storage.Call("setItem", playerIDKey, identity.PlayerID)
+	storage.Call("setItem", playerTokenKey, identity.Token)
+	playerID, playerToken = identity.PlayerID, identity.Token
+	return playerID
+}
+
+// moveAchievements hands locally stored progress from one player ID to another
+func moveAchievements(from, to string) {
+	storage := js.Global().Get("localStorage")
+	stored := storage.Call("getItem", achievementsKey)
+	if stored.IsNull() {
+		return
+	}
+	var local achievements.Progress
+	if err := json.Unmarshal([]byte(stored.String()), &local); err != nil || local.PlayerID != from {
+		return
+	}
+	local.PlayerID = to
+	if data, err := json.Marshal(&local); err == nil {
+		storage.Call("setItem", achievementsKey, string(data))
+	}
+}
+
+// localPlayerID returns the ID from localStorage, creating one if needed, for
+// playing while the server can't issue one
+func localPlayerID() string {
+	storage := js.Global().Get("localStorage")
+	if id := storage.Call("getItem", playerIDKey); !id.IsNull() && id.String() != "" {
+		return id.String()
+	}
+
+	array := js.Global().Get("Uint8Array").New(12)
+	js.Global().Get("crypto").Call("getRandomValues", array)
+	id := "player_"
+	for i := 0; i < 12; i++ {
+		id += fmt.Sprintf("%02x", array.Index(i).Int())
+	}
+	storage.Call("setItem", playerIDKey, id)
+	return id
+}
+
+// loadAchievements restores progress from localStorage and syncs it with the server
+func loadAchievements(playerID string) {
+	achievementProgress = achievements.NewProgress(playerID)
+
+	stored := js.Global().Get("localStorage").Call("getItem", achievementsKey)
+	if !stored.IsNull() {
+		var local achievements.Progress
+		if err := json.Unmarshal([]byte(stored.String()), &local); err == nil && local.PlayerID == playerID {
+			achievementProgress.Merge(&local)
+		}
+	}
+
+	go syncAchievements()
+}
+
+// saveAchievements writes progress to localStorage
+func saveAchievements() {
+	data, err := json.Marshal(achievementProgress)
+	if err != nil {
+		return
+	}
+	js.Global().Get("localStorage").Call("setItem", achievementsKey, string(data))
+}
+
+// syncAchievements uploads local progress and merges in what the server knows
+func syncAchievements() {
+	data, err := json.Marshal(achievementProgress)
+	if err != nil {
+		return
+	}
+
+	resp, err := fetchBytes("PUT", "/api/achievements/"+achievementProgress.PlayerID, data)
+	if err != nil {
+		js.Global().Get("console").Call("warn", "Failed to sync achievements:", err.Error())
+		return
+	}
+
+	var remote achievements.Progress
+	if err := json.Unmarshal(resp, &remote); err != nil {
+		return
+	}
+	achievementProgress.Merge(&remote)
+	saveAchievements()
+}
+
+// processAchievements checks the game's events for newly unlocked achievements
+func processAchievements(events []game.Event, r *renderer.Renderer) {
+	if achievementProgress == nil {
+		return
+	}
+
+	unlockedAny := false
+	for _, event := range events {
+		for _, def := range achievementProgress.Process(string(event.Type), event.Fields()) {
+			unlockedAny = true
+			r.AnnounceAchievement(def.Icon, def.Name, def.Description)
+
+			logGameEvent("achievement_unlocked", event.Level, event.Score, def.ID)
+		}
+	}
+
+	if unlockedAny {
+		saveAchievements()
+		go syncAchievements()
+	}
+}
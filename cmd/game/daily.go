@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"syscall/js"
+
+	"github.com/NathanNam/incident-commander-game/internal/game"
+)
+
+// Daily challenge runs; restarts after the ranked run are practice runs
+var (
+	dailyRankedRun string // Run that counts for today's daily leaderboard
+	dailyShownRun  string // Run the daily status in the sidebar describes
+)
+
+// modifierNames describes daily rule modifiers in the page
+var modifierNames = map[string]string{
+	game.ModifierNoRollbacks: "⛔ No rollbacks",
+	game.ModifierHeadStart:   "🚀 Starts at level 3",
+}
+
+// loadDailyChallenge fetches today's shared seed and rules from the server
+func loadDailyChallenge() (*game.DailyChallenge, error) {
+	data, err := fetchBytes("GET", "/api/daily", nil)
+	if err != nil {
+		return nil, err
+	}
+	var challenge game.DailyChallenge
+	if err := json.Unmarshal(data, &challenge); err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// showDailyChallenge describes the challenge in the sidebar
+func showDailyChallenge(challenge *game.DailyChallenge) {
+	document := js.Global().Get("document")
+	document.Call("getElementById", "daily-panel").Get("style").Set("display", "block")
+	document.Call("getElementById", "daily-date").Set("textContent", "📅 Daily Incident "+challenge.Date)
+
+	rules := []string{"Difficulty: " + challenge.Difficulty}
+	if challenge.Difficulty == game.DailyHard {
+		rules = append(rules, "🌫️ Fog of war")
+	}
+	for _, modifier := range challenge.Modifiers {
+		if name, ok := modifierNames[modifier]; ok {
+			rules = append(rules, name)
+		}
+	}
+	document.Call("getElementById", "daily-rules").Set("textContent", strings.Join(rules, "\n"))
+}
+
+// setDailyStatus shows whether the current run counts for the daily leaderboard
+func setDailyStatus(ranked bool) {
+	status := "🔁 Practice run, today's ranked attempt is used"
+	if ranked {
+		status = "🏅 Ranked attempt, good luck!"
+	}
+	js.Global().Get("document").Call("getElementById", "daily-status").Set("textContent", status)
+}
+
+// startDailyAttempt asks the server to lock in this run as the player's one
+// ranked attempt of the day
+func startDailyAttempt(runID string) {
+	data, err := json.Marshal(map[string]string{
+		"player_id": achievementProgress.PlayerID,
+		"run_id":    runID,
+	})
+	if err != nil {
+		return
+	}
+
+	resp, err := fetchBytes("POST", "/api/daily/attempts", data)
+	if err != nil {
+		js.Global().Get("console").Call("warn", "Failed to start daily attempt:", err.Error())
+		setDailyStatus(false)
+		return
+	}
+
+	var result struct {
+		Ranked bool `json:"ranked"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return
+	}
+	if result.Ranked {
+		dailyRankedRun = runID
+	}
+	setDailyStatus(result.Ranked)
+	logGameEvent("daily_attempt", 1, 0, runID)
+}
+
+// isDailyPractice reports whether a daily challenge run won't be ranked
+func isDailyPractice(g *game.Game) bool {
+	return g.GetDaily() != nil && g.GetRunID() != dailyRankedRun
+}
+
+// trackDailyRun switches the daily status to practice once the ranked run is restarted
+func trackDailyRun(g *game.Game) {
+	if dailyRankedRun == "" || g.GetRunID() == dailyShownRun {
+		return
+	}
+	dailyShownRun = g.GetRunID()
+	setDailyStatus(dailyShownRun == dailyRankedRun)
+}
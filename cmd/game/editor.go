@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/base64"
+	"strconv"
+	"syscall/js"
+
+	"github.com/NathanNam/incident-commander-game/internal/editor"
+	"github.com/NathanNam/incident-commander-game/internal/game"
+	"github.com/NathanNam/incident-commander-game/internal/input"
+)
+
+// Level editor state; levelEditor is nil outside editor mode
+var (
+	levelEditor   *editor.Editor
+	editorTesting bool // Test-playing the level instead of editing it
+	editorFuncs   []js.Func
+)
+
+// editorActive reports whether the canvas is currently a paint surface
+func editorActive() bool {
+	return levelEditor != nil && !editorTesting
+}
+
+// decodeLevelParam decodes a level shared through the ?level= query parameter
+func decodeLevelParam(param string) (*game.LevelDefinition, error) {
+	data, err := base64.RawURLEncoding.DecodeString(param)
+	if err != nil {
+		return nil, err
+	}
+	return game.ParseLevel(data)
+}
+
+// shareURL builds a link that plays an exported level
+func shareURL(data []byte) string {
+	return getCurrentServerURL() + "/?level=" + base64.RawURLEncoding.EncodeToString(data)
+}
+
+// setupEditor switches the client into editor mode, starting from def if given.
+// Test-play replaces the game in place so the input handler keeps driving it.
+func setupEditor(g *game.Game, inputHandler *input.InputHandler, def *game.LevelDefinition) {
+	if def != nil {
+		levelEditor = editor.Load(def)
+	} else {
+		levelEditor = editor.New(g.GetWidth(), g.GetHeight())
+	}
+
+	document := js.Global().Get("document")
+	byID := func(id string) js.Value { return document.Call("getElementById", id) }
+
+	byID("editor-panel").Get("style").Set("display", "block")
+	byID("editor-name").Set("value", levelEditor.Level.Name)
+	byID("editor-alerts").Set("value", levelEditor.Level.AlertsNeeded)
+
+	setStatus := func(message string, ok bool) {
+		status := byID("editor-status")
+		status.Set("textContent", message)
+		if ok {
+			status.Set("className", "ok")
+		} else {
+			status.Set("className", "error")
+		}
+	}
+
+	on := func(el js.Value, event string, handler func(el js.Value)) {
+		callback := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			handler(el)
+			return nil
+		})
+		el.Call("addEventListener", event, callback)
+		editorFuncs = append(editorFuncs, callback)
+	}
+
+	// Tool palette
+	buttons := document.Call("querySelectorAll", "#editor-tools button")
+	for i := 0; i < buttons.Get("length").Int(); i++ {
+		on(buttons.Index(i), "click", func(el js.Value) {
+			levelEditor.SetTool(editor.Tool(el.Get("dataset").Get("tool").String()))
+			for j := 0; j < buttons.Get("length").Int(); j++ {
+				buttons.Index(j).Get("classList").Call("remove", "selected")
+			}
+			el.Get("classList").Call("add", "selected")
+		})
+	}
+
+	on(byID("editor-gate-direction"), "change", func(el js.Value) {
+		if dir, err := strconv.Atoi(el.Get("value").String()); err == nil {
+			levelEditor.GateDirection = game.Direction(dir)
+		}
+	})
+	on(byID("editor-name"), "input", func(el js.Value) {
+		levelEditor.Level.Name = el.Get("value").String()
+	})
+	on(byID("editor-alerts"), "input", func(el js.Value) {
+		if alerts, err := strconv.Atoi(el.Get("value").String()); err == nil {
+			levelEditor.Level.AlertsNeeded = alerts
+		}
+	})
+
+	// Test-play runs the same checks as export so unsolvable levels never start
+	on(byID("editor-play"), "click", func(el js.Value) {
+		if editorTesting {
+			editorTesting = false
+			el.Set("textContent", "▶️ Test play")
+			setStatus("Back to editing", true)
+			return
+		}
+
+		data, err := levelEditor.Export()
+		if err != nil {
+			setStatus("❌ "+err.Error(), false)
+			return
+		}
+		def, err := game.ParseLevel(data)
+		if err != nil {
+			setStatus("❌ "+err.Error(), false)
+			return
+		}
+
+		*g = *game.NewWithOptions(def.Width, def.Height, game.Options{Level: def})
+		editorTesting = true
+		el.Set("textContent", "✏️ Back to editor")
+		setStatus("Test playing "+def.Name, true)
+		logGameEvent("editor_test_play", 1, 0, def.Name)
+	})
+
+	on(byID("editor-export"), "click", func(el js.Value) {
+		data, err := levelEditor.Export()
+		if err != nil {
+			setStatus("❌ "+err.Error(), false)
+			return
+		}
+
+		byID("editor-json").Set("value", string(data))
+		share := byID("editor-share")
+		share.Set("href", shareURL(data))
+		share.Get("style").Set("display", "block")
+
+		// Offer the level as a file download
+		blob := js.Global().Get("Blob").New([]interface{}{string(data)}, map[string]interface{}{"type": "application/json"})
+		url := js.Global().Get("URL").Call("createObjectURL", blob)
+		link := document.Call("createElement", "a")
+		link.Set("href", url)
+		link.Set("download", "level.json")
+		link.Call("click")
+		js.Global().Get("URL").Call("revokeObjectURL", url)
+
+		setStatus("✅ Level is solvable and exported", true)
+		logGameEvent("editor_export", 1, 0, levelEditor.Level.Name)
+	})
+
+	on(byID("editor-import"), "click", func(el js.Value) {
+		def, err := game.ParseLevel([]byte(byID("editor-json").Get("value").String()))
+		if err != nil {
+			setStatus("❌ "+err.Error(), false)
+			return
+		}
+		levelEditor = editor.Load(def)
+		byID("editor-name").Set("value", def.Name)
+		byID("editor-alerts").Set("value", def.AlertsNeeded)
+		setStatus("✅ Imported "+def.Name, true)
+	})
+
+	inputHandler.SetupEditorListeners(editorCanvas{})
+}
+
+// editorCanvas forwards canvas paint strokes to the current editor, ignoring them while test-playing
+type editorCanvas struct{}
+
+func (editorCanvas) PaintCell(x, y int, dragging bool) {
+	if editorActive() {
+		levelEditor.PaintCell(x, y, dragging)
+	}
+}
+
+func (editorCanvas) EndStroke() {
+	if levelEditor != nil {
+		levelEditor.EndStroke()
+	}
+}
+
+func (editorCanvas) GridSize() (int, int) {
+	return levelEditor.GridSize()
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"syscall/js"
+
+	"github.com/NathanNam/incident-commander-game/internal/game"
+	"github.com/NathanNam/incident-commander-game/internal/leaderboard"
+)
+
+// playerNameKey is the localStorage key for the name shown on the leaderboard
+const playerNameKey = "incident_commander_player_name"
+
+// leaderboardFuncs keeps the leaderboard panel callbacks alive
+var leaderboardFuncs []js.Func
+
+// scoreMode returns the leaderboard mode and difficulty for a game, or false
+// if its scores aren't ranked (hand-made levels and the level editor)
+func scoreMode(g *game.Game) (string, string, bool) {
+	if g.IsCustomLevel() || levelEditor != nil {
+		return "", "", false
+	}
+
+	// Each daily challenge has its own leaderboard
+	if daily := g.GetDaily(); daily != nil {
+		return "daily:" + daily.Date, daily.Difficulty, true
+	}
+
+	// Fog of war only changes what's drawn, so the server can't tell a fog
+	// run from any other and ranks them together
+	mode := "classic"
+	if scenario := g.GetScenario(); scenario != nil {
+		mode = "scenario:" + scenario.Name
+	}
+	return mode, leaderboard.DifficultyNormal, true
+}
+
+// getPlayerName returns the leaderboard name entered in the page
+func getPlayerName() string {
+	input := js.Global().Get("document").Call("getElementById", "player-name")
+	if input.IsNull() {
+		return ""
+	}
+	return strings.TrimSpace(input.Get("value").String())
+}
+
+// setupLeaderboard restores the player's name and loads the top 10 for this mode
+func setupLeaderboard(g *game.Game) {
+	document := js.Global().Get("document")
+	storage := js.Global().Get("localStorage")
+
+	nameInput := document.Call("getElementById", "player-name")
+	if name := storage.Call("getItem", playerNameKey); !name.IsNull() {
+		nameInput.Set("value", name.String())
+	}
+	onName := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		storage.Call("setItem", playerNameKey, getPlayerName())
+		return nil
+	})
+	nameInput.Call("addEventListener", "change", onName)
+
+	onWindow := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		go refreshLeaderboard(g)
+		return nil
+	})
+	document.Call("getElementById", "leaderboard-window").Call("addEventListener", "change", onWindow)
+
+	leaderboardFuncs = append(leaderboardFuncs, onName, onWindow)
+	go refreshLeaderboard(g)
+}
+
+// processScores submits the run's score with its replay when the game ends, so
+// the server can verify it. Runs that continue after a rollback resubmit under
+// the same run ID.
+func processScores(g *game.Game, events []game.Event) {
+	mode, difficulty, ranked := scoreMode(g)
+	if !ranked || achievementProgress == nil || isDailyPractice(g) {
+		return
+	}
+
+	for _, event := range events {
+		if event.Type == game.EventGameOver || event.Type == game.EventGameComplete {
+			go submitScore(g, leaderboard.Submission{
+				Entry: leaderboard.Entry{
+					RunID:      g.GetRunID(),
+					PlayerID:   achievementProgress.PlayerID,
+					Name:       getPlayerName(),
+					Score:      event.Score,
+					Level:      event.Level,
+					Mode:       mode,
+					Difficulty: difficulty,
+				},
+				Replay: g.GetReplay(),
+			})
+		}
+	}
+}
+
+// submitScore posts a score to the leaderboard and refreshes the top 10
+func submitScore(g *game.Game, sub leaderboard.Submission) {
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return
+	}
+
+	resp, err := fetchBytes("POST", "/api/scores", data)
+	if err != nil {
+		js.Global().Get("console").Call("warn", "Failed to submit score:", err.Error())
+		return
+	}
+
+	var result struct {
+		Rank int `json:"rank"`
+	}
+	if err := json.Unmarshal(resp, &result); err == nil {
+		logGameEvent("score_submitted", sub.Level, sub.Score, fmt.Sprintf("Rank %d in %s", result.Rank, sub.Mode))
+	}
+	refreshLeaderboard(g)
+}
+
+// refreshLeaderboard fetches the top 10 for the current mode and window and shows it in the page
+func refreshLeaderboard(g *game.Game) {
+	document := js.Global().Get("document")
+	list := document.Call("getElementById", "leaderboard-list")
+	if list.IsNull() {
+		return
+	}
+
+	mode, difficulty, ranked := scoreMode(g)
+	if !ranked {
+		return
+	}
+
+	params := url.Values{}
+	params.Set("mode", mode)
+	params.Set("difficulty", difficulty)
+	params.Set("window", document.Call("getElementById", "leaderboard-window").Get("value").String())
+	params.Set("limit", "10")
+
+	resp, err := fetchBytes("GET", "/api/leaderboard?"+params.Encode(), nil)
+	if err != nil {
+		js.Global().Get("console").Call("warn", "Failed to load leaderboard:", err.Error())
+		return
+	}
+	var page leaderboard.Page
+	if err := json.Unmarshal(resp, &page); err != nil {
+		return
+	}
+
+	list.Set("innerHTML", "")
+	if len(page.Entries) == 0 {
+		item := document.Call("createElement", "li")
+		item.Set("textContent", "No scores yet, be the first!")
+		list.Call("appendChild", item)
+		return
+	}
+	for _, entry := range page.Entries {
+		item := document.Call("createElement", "li")
+		item.Set("textContent", fmt.Sprintf("%s: %d (L%d)", entry.Name, entry.Score, entry.Level))
+		if entry.Mine {
+			item.Set("className", "mine")
+		}
+		list.Call("appendChild", item)
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
 	"syscall/js"
 	"time"
 
@@ -59,6 +61,37 @@ func logGameEvent(eventType string, level, score int, data string) {
 		}
 
 		clientTelemetry.LogEvent(eventType, level, score, data, attributes)
+		if eventType == "error" {
+			clientTelemetry.RecordError(data)
+		}
+	}
+}
+
+// traceGameEvents records a tick's events on the current level span. A lost
+// run ends the span; the game loop starts the next one.
+func traceGameEvents(events []game.Event) {
+	span := clientTelemetry.LevelSpan()
+	if span == nil {
+		return
+	}
+	for _, event := range events {
+		attributes := map[string]interface{}{"score": event.Score}
+		switch event.Type {
+		case game.EventAlertCollected:
+			attributes["combo"] = event.Combo
+			span.AddEvent(string(event.Type), attributes)
+		case game.EventPause, game.EventRollback:
+			span.AddEvent(string(event.Type), attributes)
+		case game.EventLevelComplete:
+			attributes["turns"] = event.Turns
+			span.AddEvent(string(event.Type), attributes)
+			span.SetStatus(telemetry.SpanStatusOK, "")
+		case game.EventGameOver, game.EventGameComplete:
+			span.AddEvent(string(event.Type), attributes)
+			span.SetAttribute("outcome", string(event.Type))
+			clientTelemetry.EndLevelSpan()
+			return
+		}
 	}
 }
 
@@ -75,12 +108,13 @@ func reportPerformanceMetrics(currentLevel int) {
 
 		// Send performance metrics to telemetry
 		if clientTelemetry != nil {
-			clientTelemetry.RecordMetric("fps", fps, "gauge", map[string]interface{}{
-				"level": currentLevel,
+			clientTelemetry.RecordMetricWithUnit("fps", fps, "histogram", "{frame}/s", map[string]interface{}{
+				"level":                 currentLevel,
 				"game_duration_seconds": time.Since(gameStartTime).Seconds(),
 			})
 
-			clientTelemetry.RecordMetric("frames_rendered_total", float64(frameCount), "counter", map[string]interface{}{
+			// frameCount restarts after each report, so it's the increment
+			clientTelemetry.RecordMetricWithUnit("frames_rendered_total", float64(frameCount), "counter", "{frame}", map[string]interface{}{
 				"level": currentLevel,
 			})
 		}
@@ -103,6 +137,76 @@ func getCurrentServerURL() string {
 	return protocol + "//" + hostname
 }
 
+// getQueryParam reads a query string parameter from the page URL
+func getQueryParam(name string) string {
+	params := js.Global().Get("URLSearchParams").New(js.Global().Get("location").Get("search"))
+	value := params.Call("get", name)
+	if value.IsNull() {
+		return ""
+	}
+	return value.String()
+}
+
+// fetchBytes sends a request and blocks until the response body is available.
+// A nil body sends no request body.
+func fetchBytes(method, url string, body []byte) ([]byte, error) {
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+
+	var onResponse, onBody, onError js.Func
+	onResponse = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		resp := args[0]
+		if !resp.Get("ok").Bool() {
+			done <- result{err: fmt.Errorf("fetch %s: %d %s", url, resp.Get("status").Int(), resp.Get("statusText").String())}
+			return nil
+		}
+		resp.Call("arrayBuffer").Call("then", onBody).Call("catch", onError)
+		return nil
+	})
+	onBody = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		array := js.Global().Get("Uint8Array").New(args[0])
+		data := make([]byte, array.Get("length").Int())
+		js.CopyBytesToGo(data, array)
+		done <- result{data: data}
+		return nil
+	})
+	onError = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		done <- result{err: errors.New("fetch " + url + ": " + args[0].Call("toString").String())}
+		return nil
+	})
+	defer onResponse.Release()
+	defer onBody.Release()
+	defer onError.Release()
+
+	headers := map[string]interface{}{}
+	options := map[string]interface{}{"method": method, "headers": headers}
+	if clientTelemetry != nil {
+		headers["traceparent"] = clientTelemetry.TraceParent()
+	}
+	if playerToken != "" {
+		headers["X-Player-Token"] = playerToken
+	}
+	if body != nil {
+		headers["Content-Type"] = "application/json"
+		options["body"] = string(body)
+	}
+	js.Global().Call("fetch", url, options).Call("then", onResponse).Call("catch", onError)
+	res := <-done
+	return res.data, res.err
+}
+
+// loadScenario fetches a scenario definition file
+func loadScenario(name string) (*game.Scenario, error) {
+	data, err := fetchBytes("GET", "/web/scenarios/"+name+".json", nil)
+	if err != nil {
+		return nil, err
+	}
+	return game.ParseScenario(data)
+}
+
 func main() {
 	gameStartTime = time.Now()
 	lastFPSReport = time.Now()
@@ -144,7 +248,82 @@ func main() {
 	initSpan.SetAttribute("canvas_width", canvas.Get("width").Int())
 	initSpan.SetAttribute("canvas_height", canvas.Get("height").Int())
 
-	g := game.New(20, 20)
+	// Optional modes from the page URL
+	opts := game.Options{}
+	if getQueryParam("fog") == "1" {
+		opts.FogRadius = game.DefaultFogRadius
+		if radius, err := strconv.Atoi(getQueryParam("fog_radius")); err == nil && radius > 0 {
+			opts.FogRadius = radius
+		}
+		initSpan.SetAttribute("fog_radius", opts.FogRadius)
+	}
+
+	// Hand-made levels are shared as base64 JSON in the URL
+	var sharedLevel *game.LevelDefinition
+	if param := getQueryParam("level"); param != "" {
+		def, err := decodeLevelParam(param)
+		if err != nil {
+			println("⚠️ Failed to load shared level, falling back to classic mode:", err.Error())
+			logGameEvent("error", 1, 0, "Shared level load failed: "+err.Error())
+		} else {
+			sharedLevel = def
+			initSpan.SetAttribute("custom_level", def.Name)
+		}
+	}
+	editorMode := getQueryParam("mode") == "editor"
+	if sharedLevel != nil && !editorMode {
+		opts.Level = sharedLevel
+	}
+
+	// Scenario mode loads its dependency graph from a definition file
+	if getQueryParam("mode") == "scenario" {
+		name := getQueryParam("scenario")
+		if name == "" {
+			name = "api-db"
+		}
+		scenario, err := loadScenario(name)
+		if err != nil {
+			println("⚠️ Failed to load scenario, falling back to classic mode:", err.Error())
+			logGameEvent("error", 1, 0, "Scenario load failed: "+err.Error())
+		} else {
+			opts.Scenario = scenario
+			initSpan.SetAttribute("scenario", name)
+			logGameEvent("scenario_loaded", 1, 0, "Scenario: "+name)
+		}
+	}
+
+	// The daily challenge gives everyone the same seed and rules
+	if getQueryParam("mode") == "daily" {
+		challenge, err := loadDailyChallenge()
+		if err != nil {
+			println("⚠️ Failed to load daily challenge, falling back to classic mode:", err.Error())
+			logGameEvent("error", 1, 0, "Daily challenge load failed: "+err.Error())
+		} else {
+			opts.Daily = challenge
+			initSpan.SetAttribute("daily_date", challenge.Date)
+			logGameEvent("daily_loaded", 1, 0, "Daily challenge: "+challenge.Date)
+		}
+	}
+
+	// Spectators watch someone else's game instead of playing
+	watchID := getQueryParam("watch")
+	if watchID != "" {
+		initSpan.SetAttribute("watch", watchID)
+	}
+
+	// Multiplayer races run in rooms on the server
+	roomsMode := getQueryParam("mode") == "rooms" && watchID == ""
+	if roomsMode {
+		initSpan.SetAttribute("rooms", true)
+	}
+
+	// The game can run on the server, except in the editor and on hand-made levels
+	serverPlay := getQueryParam("server") == "1" && !editorMode && opts.Level == nil && watchID == "" && !roomsMode
+	if serverPlay {
+		initSpan.SetAttribute("server_play", true)
+	}
+
+	g := game.NewWithOptions(game.BoardSize, game.BoardSize, opts)
 	r := renderer.New(canvas)
 	inputHandler := input.New()
 
@@ -153,12 +332,52 @@ func main() {
 	println("✅ Game components initialized")
 	logGameEvent("components_initialized", 1, 0, "Game, renderer, and input handler created")
 
-	// Set up event listeners
-	inputHandler.SetupEventListeners(g)
+	// Server-authoritative play sends the controls to the server instead of the local game
+	var controls input.Controller = g
+	if serverPlay {
+		remote = newRemoteGame(g, r)
+		controls = remote
+	} else if roomsMode {
+		racing = &roomClient{r: r}
+		controls = racing
+	}
+
+	// Set up event listeners; spectators have nothing to control
+	if watchID == "" {
+		inputHandler.SetupEventListeners(controls)
+	}
+
+	// Editor mode turns the canvas into a paint surface
+	if editorMode {
+		setupEditor(g, inputHandler, sharedLevel)
+		logGameEvent("editor_opened", 1, 0, "Level editor ready")
+	}
 
 	println("✅ Event listeners set up")
 	logGameEvent("event_listeners_setup", 1, 0, "Input event listeners configured")
 
+	// Restore achievement progress for this player
+	loadAchievements(getPlayerID())
+	setupLeaderboard(g)
+
+	// Only the first daily run of the day is ranked; the server tracks it in server play.
+	// Games played in this page are streamed live for spectators.
+	if watchID != "" {
+		startWatching(g, r, watchID)
+	} else if remote != nil {
+		remote.start()
+		logGameEvent("server_play", 1, 0, "Game runs on the server")
+	} else if racing != nil {
+		racing.start()
+		logGameEvent("rooms_opened", 1, 0, "Multiplayer race rooms")
+	} else if daily := g.GetDaily(); daily != nil {
+		showDailyChallenge(daily)
+		go startDailyAttempt(g.GetRunID())
+	}
+	if watchID == "" && remote == nil && racing == nil && !editorMode {
+		startBroadcast(g)
+	}
+
 	// Initial render
 	r.Render(g)
 
@@ -169,19 +388,26 @@ func main() {
 	var gameLoop js.Func
 	var lastUpdate float64
 
-	// Better speed progression - faster but still playable
-	getTargetFPS := func(level int) float64 {
-		// Level 1: 2 FPS (500ms), Level 10: 8 FPS (125ms)
-		fps := 1.5 + float64(level)*0.65 // 2.15 to 8 FPS range
-		if fps > 8 {
-			fps = 8 // Maximum 8 FPS
+	gameLoop = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		// The level editor only redraws the layout being edited
+		if editorActive() {
+			r.RenderEditor(levelEditor.Preview(), levelEditor.PendingPad())
+			js.Global().Call("requestAnimationFrame", gameLoop)
+			return nil
+		}
+
+		// Server frames are rendered as they arrive; only the rollback animation runs here
+		if remote != nil || watching != nil || racing != nil {
+			if g.GetState() == game.Rewinding {
+				r.Render(g)
+			}
+			js.Global().Call("requestAnimationFrame", gameLoop)
+			return nil
 		}
-		return fps
-	}
 
-	gameLoop = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
 		now := args[0].Float()
-		targetFPS := getTargetFPS(g.GetLevel())
+		// The engine's tick rate keeps replays in step with what the player saw
+		targetFPS := game.TickRate(g.GetLevel())
 
 		if now-lastUpdate >= 1000.0/targetFPS {
 			// Start game loop span for performance tracking
@@ -196,6 +422,13 @@ func main() {
 
 			// Always update to handle level transitions, but render depends on game state
 			g.Update()
+			events := g.TakeEvents()
+			processAchievements(events, r)
+			processScores(g, events)
+			if g.GetDaily() != nil {
+				trackDailyRun(g)
+			}
+			broadcastFrame(g)
 			r.Render(g)
 			lastUpdate = now
 			frameCount++
@@ -210,6 +443,12 @@ func main() {
 			currentScore := g.GetScore()
 			currentState := g.GetState()
 
+			// Each level, and each new run after a lost one, gets its own span
+			traceGameEvents(events)
+			if currentLevel != prevLevel || (clientTelemetry.LevelSpan() == nil && currentState == game.Playing) {
+				clientTelemetry.StartLevelSpan(currentLevel)
+			}
+
 			// Log level changes
 			if currentLevel != prevLevel {
 				logGameEvent("level_change", currentLevel, currentScore,
@@ -224,13 +463,16 @@ func main() {
 
 			// Log game state changes
 			if currentState != prevState {
-				stateStr := map[int]string{0: "Playing", 1: "Paused", 2: "GameOver", 3: "LevelComplete"}
+				stateStr := map[int]string{0: "Playing", 1: "Paused", 2: "GameOver", 3: "LevelComplete", 4: "Rewinding"}
 				logGameEvent("state_change", currentLevel, currentScore,
 					fmt.Sprintf("State changed to %s", stateStr[int(currentState)]))
 			}
 
 			// Report performance metrics periodically
 			reportPerformanceMetrics(currentLevel)
+		} else if g.GetState() == game.Rewinding {
+			// Animate the rollback at full frame rate between ticks
+			r.Render(g)
 		}
 
 		// Continue the animation loop
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/url"
+	"strings"
+	"syscall/js"
+
+	"github.com/NathanNam/incident-commander-game/internal/game"
+	"github.com/NathanNam/incident-commander-game/internal/netplay"
+	"github.com/NathanNam/incident-commander-game/internal/renderer"
+)
+
+// playSessionKey is the sessionStorage key of the server session to resume after a reload
+const playSessionKey = "incident_commander_play_session"
+
+// Reconnect backoff, doubling from the first delay up to the cap
+const (
+	reconnectDelayMs    = 500
+	maxReconnectDelayMs = 8000
+)
+
+// directionActions maps directions to the inputs sent to the server
+var directionActions = map[game.Direction]game.Action{
+	game.Up: game.ActionUp, game.Down: game.ActionDown, game.Left: game.ActionLeft, game.Right: game.ActionRight,
+}
+
+// remote is the server connection in server-authoritative play; nil when the
+// game runs in the browser
+var remote *remoteGame
+
+// storedSession is the session saved in sessionStorage
+type storedSession struct {
+	Query     string `json:"query"` // Query string the session was created with
+	SessionID string `json:"session_id"`
+	Token     string `json:"token"`
+}
+
+// remoteGame plays a game running on the server. Controls are sent over a
+// WebSocket and the frames received are mirrored into a local game that is
+// only rendered.
+type remoteGame struct {
+	g        *game.Game
+	r        *renderer.Renderer
+	query    string // Creates a new session
+	session  storedSession
+	ranked   bool
+	ws       js.Value
+	attempts int  // Failed connections since the last welcome
+	ended    bool // The server ended the session; the next restart starts a new one
+	funcs    []js.Func
+}
+
+// newRemoteGame creates the server connection for a display game; start connects it
+func newRemoteGame(g *game.Game, r *renderer.Renderer) *remoteGame {
+	return &remoteGame{g: g, r: r}
+}
+
+// start connects to the server for a new game in the display game's mode, or
+// resumes the session from before a page reload
+func (rg *remoteGame) start() {
+	mode, difficulty, _ := serverModeFor(rg.g)
+	params := url.Values{}
+	params.Set("mode", mode)
+	params.Set("difficulty", difficulty)
+	params.Set("player", achievementProgress.PlayerID)
+	params.Set("player_token", playerToken)
+	params.Set("name", getPlayerName())
+	rg.query = params.Encode()
+
+	// Resume the session if the page was reloaded in the same mode
+	stored := js.Global().Get("sessionStorage").Call("getItem", playSessionKey)
+	if !stored.IsNull() {
+		var session storedSession
+		if err := json.Unmarshal([]byte(stored.String()), &session); err == nil && session.Query == modeQuery(rg.query) {
+			rg.session = session
+		}
+	}
+
+	setServerStatus("🔌 Connecting to the server...")
+	rg.connect()
+}
+
+// modeQuery drops the player's name, which may change between sessions, from a query string
+func modeQuery(query string) string {
+	params, _ := url.ParseQuery(query)
+	params.Del("name")
+	return params.Encode()
+}
+
+// connect opens the WebSocket, resuming the current session if there is one
+func (rg *remoteGame) connect() {
+	query := rg.query
+	if rg.session.SessionID != "" {
+		query = url.Values{"session": {rg.session.SessionID}, "token": {rg.session.Token}}.Encode()
+	}
+
+	rg.releaseFuncs()
+	rg.ws = js.Global().Get("WebSocket").New(webSocketURL("/ws/play?" + query))
+
+	opened := false
+	onOpen := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		opened = true
+		return nil
+	})
+	onMessage := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		var msg netplay.ServerMessage
+		if err := json.Unmarshal([]byte(args[0].Get("data").String()), &msg); err == nil {
+			rg.receive(msg)
+		}
+		return nil
+	})
+	onClose := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		// The server ends idle sessions after a finished run; wait for a restart
+		if args[0].Get("code").Int() == netplay.CloseSessionEnded {
+			rg.forgetSession()
+			rg.ended = true
+			setServerStatus("🏁 Session ended, restart to play again")
+			logGameEvent("server_session_ended", rg.g.GetLevel(), rg.g.GetScore(), "")
+			return nil
+		}
+		// A session the server no longer has can't be resumed; start a new one
+		if !opened && rg.session.SessionID != "" {
+			rg.forgetSession()
+		}
+		rg.reconnect()
+		return nil
+	})
+	rg.ws.Set("onopen", onOpen)
+	rg.ws.Set("onmessage", onMessage)
+	rg.ws.Set("onclose", onClose)
+	rg.funcs = append(rg.funcs, onOpen, onMessage, onClose)
+}
+
+// reconnect retries the connection with exponential backoff
+func (rg *remoteGame) reconnect() {
+	delay := math.Min(maxReconnectDelayMs, reconnectDelayMs*math.Pow(2, float64(rg.attempts)))
+	rg.attempts++
+	setServerStatus("🔌 Connection lost, reconnecting...")
+	logGameEvent("server_reconnect", rg.g.GetLevel(), rg.g.GetScore(), rg.session.SessionID)
+
+	var retry js.Func
+	retry = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		retry.Release()
+		rg.connect()
+		return nil
+	})
+	js.Global().Call("setTimeout", retry, delay)
+}
+
+// receive handles a message from the server
+func (rg *remoteGame) receive(msg netplay.ServerMessage) {
+	switch msg.Type {
+	case netplay.TypeWelcome:
+		rg.attempts = 0
+		rg.session = storedSession{Query: modeQuery(rg.query), SessionID: msg.SessionID, Token: msg.Token}
+		if data, err := json.Marshal(rg.session); err == nil {
+			js.Global().Get("sessionStorage").Call("setItem", playSessionKey, string(data))
+		}
+		if msg.Resync {
+			setServerStatus("🖥️ Reconnected, game resumed")
+		} else {
+			setServerStatus("🖥️ Playing on the server")
+		}
+		logGameEvent("server_connected", rg.g.GetLevel(), rg.g.GetScore(), msg.SessionID)
+
+	case netplay.TypeFrame:
+		if msg.Frame == nil {
+			return
+		}
+		prevRun := rg.g.GetRunID()
+		rg.g.ApplyFrame(*msg.Frame)
+		if daily := rg.g.GetDaily(); daily != nil && (rg.g.GetRunID() != prevRun || msg.Ranked != rg.ranked) {
+			showDailyChallenge(daily)
+			setDailyStatus(msg.Ranked)
+		}
+		rg.ranked = msg.Ranked
+
+		events := rg.g.TakeEvents()
+		processAchievements(events, rg.r)
+		for _, event := range events {
+			// The server submits ranked scores itself
+			if event.Type == game.EventGameOver || event.Type == game.EventGameComplete {
+				go refreshLeaderboard(rg.g)
+			}
+		}
+		rg.r.Render(rg.g)
+	}
+}
+
+// send writes a message to the server if connected
+func (rg *remoteGame) send(msg netplay.ClientMessage) {
+	if rg.ws.Get("readyState").Int() != js.Global().Get("WebSocket").Get("OPEN").Int() {
+		return
+	}
+	if data, err := json.Marshal(msg); err == nil {
+		rg.ws.Call("send", string(data))
+	}
+}
+
+// forgetSession drops the saved session so the next connection starts a new game
+func (rg *remoteGame) forgetSession() {
+	rg.session = storedSession{}
+	js.Global().Get("sessionStorage").Call("removeItem", playSessionKey)
+}
+
+// releaseFuncs releases the previous connection's callbacks
+func (rg *remoteGame) releaseFuncs() {
+	for _, f := range rg.funcs {
+		f.Release()
+	}
+	rg.funcs = nil
+}
+
+// Controls, sent to the server. The local game only changes when the next frame arrives.
+
+func (rg *remoteGame) SetDirection(dir game.Direction) {
+	rg.send(netplay.ClientMessage{Type: netplay.TypeInput, Action: directionActions[dir]})
+}
+
+func (rg *remoteGame) Pause() {
+	rg.send(netplay.ClientMessage{Type: netplay.TypeInput, Action: game.ActionPause})
+}
+
+func (rg *remoteGame) Restart() {
+	if rg.ended {
+		rg.ended = false
+		setServerStatus("🔌 Connecting to the server...")
+		rg.connect()
+		return
+	}
+	rg.send(netplay.ClientMessage{Type: netplay.TypeRestart})
+}
+
+func (rg *remoteGame) Rollback() bool {
+	if !rg.g.CanRollback() {
+		return false
+	}
+	rg.send(netplay.ClientMessage{Type: netplay.TypeInput, Action: game.ActionRollback})
+	return true
+}
+
+func (rg *remoteGame) GetRollbacksLeft() int { return rg.g.GetRollbacksLeft() }
+
+// setServerStatus shows the server connection state in the sidebar
+func setServerStatus(status string) {
+	document := js.Global().Get("document")
+	document.Call("getElementById", "server-panel").Get("style").Set("display", "block")
+	document.Call("getElementById", "server-status").Set("textContent", status)
+}
+
+// serverModeFor returns the mode and difficulty to request from the server.
+// Daily runs ask for today's challenge, whose difficulty the server picks.
+func serverModeFor(g *game.Game) (string, string, bool) {
+	mode, difficulty, ok := scoreMode(g)
+	if strings.HasPrefix(mode, "daily:") {
+		mode = "daily"
+	}
+	return mode, difficulty, ok
+}
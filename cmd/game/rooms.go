@@ -0,0 +1,429 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall/js"
+
+	"github.com/NathanNam/incident-commander-game/internal/game"
+	"github.com/NathanNam/incident-commander-game/internal/netplay"
+	"github.com/NathanNam/incident-commander-game/internal/race"
+	"github.com/NathanNam/incident-commander-game/internal/renderer"
+)
+
+// roomListRefreshMs is how often the list of open rooms is reloaded
+const roomListRefreshMs = 3000
+
+// racing is the room client in multiplayer mode; nil otherwise
+var racing *roomClient
+
+// roomClient races other players in a room on the server. It shows the room
+// list until the player creates or joins a room, then the lobby, the race, and
+// the results.
+type roomClient struct {
+	r        *renderer.Renderer
+	roomID   string
+	state    netplay.RoomState
+	frame    *race.Frame
+	ws       js.Value
+	left     bool // The player left or the room closed, so don't reconnect
+	attempts int  // Failed connections since the last room state
+
+	listTimer js.Value  // Interval refreshing the room list; undefined in a room
+	listFuncs []js.Func // The refresh and the list's join buttons
+	wsFuncs   []js.Func
+}
+
+// start shows the room list, or joins the room in the page's URL
+func (rc *roomClient) start() {
+	rc.state = netplay.RoomState{You: -1}
+	rc.setupPanel()
+	if id := getQueryParam("room"); id != "" {
+		go rc.join(id)
+		return
+	}
+	rc.showList()
+}
+
+// setupPanel wires up the room panel's buttons
+func (rc *roomClient) setupPanel() {
+	document := js.Global().Get("document")
+	document.Call("getElementById", "room-panel").Get("style").Set("display", "block")
+
+	onCreate := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		go rc.create()
+		return nil
+	})
+	onReady := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		rc.send(netplay.RoomCommand{Type: netplay.TypeReady, Ready: !rc.isReady()})
+		return nil
+	})
+	onLeave := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		rc.leave()
+		return nil
+	})
+	document.Call("getElementById", "room-create").Call("addEventListener", "click", onCreate)
+	document.Call("getElementById", "room-ready").Call("addEventListener", "click", onReady)
+	document.Call("getElementById", "room-leave").Call("addEventListener", "click", onLeave)
+}
+
+// showList shows the open rooms and keeps them up to date until the player picks one
+func (rc *roomClient) showList() {
+	rc.roomID = ""
+	rc.frame = nil
+	rc.state = netplay.RoomState{You: -1}
+	js.Global().Get("history").Call("replaceState", nil, "", "/?mode=rooms")
+	setRoomStatus("🏁 Create a room or join one, then get ready")
+	showRoomView("list")
+
+	rc.stopList()
+	tick := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		go rc.refreshList()
+		return nil
+	})
+	rc.listFuncs = []js.Func{tick}
+	rc.listTimer = js.Global().Call("setInterval", tick, roomListRefreshMs)
+	go rc.refreshList()
+}
+
+// stopList stops refreshing the room list
+func (rc *roomClient) stopList() {
+	if !rc.listTimer.IsUndefined() {
+		js.Global().Call("clearInterval", rc.listTimer)
+		rc.listTimer = js.Undefined()
+	}
+	for _, f := range rc.listFuncs {
+		f.Release()
+	}
+	rc.listFuncs = nil
+}
+
+// refreshList loads the open rooms into the panel
+func (rc *roomClient) refreshList() {
+	data, err := fetchBytes("GET", "/api/rooms", nil)
+	if err != nil {
+		println("⚠️ Failed to load rooms:", err.Error())
+		return
+	}
+	var rooms []netplay.RoomSummary
+	if err := json.Unmarshal(data, &rooms); err != nil {
+		return
+	}
+
+	// The list may have been closed while the request was in flight
+	if rc.listTimer.IsUndefined() {
+		return
+	}
+	for _, f := range rc.listFuncs[1:] {
+		f.Release()
+	}
+	rc.listFuncs = rc.listFuncs[:1]
+
+	document := js.Global().Get("document")
+	list := document.Call("getElementById", "room-list")
+	list.Call("replaceChildren")
+	for _, room := range rooms {
+		if room.Phase != netplay.PhaseLobby || len(room.Players) >= room.Seats {
+			continue
+		}
+		id := room.ID
+		item := document.Call("createElement", "li")
+		button := document.Call("createElement", "button")
+		button.Set("textContent", "Join "+strconv.Itoa(len(room.Players))+"/"+strconv.Itoa(room.Seats))
+		onJoin := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			go rc.join(id)
+			return nil
+		})
+		rc.listFuncs = append(rc.listFuncs, onJoin)
+		button.Call("addEventListener", "click", onJoin)
+		item.Call("appendChild", button)
+		item.Call("append", " "+strings.Join(room.Players, ", "))
+		list.Call("appendChild", item)
+	}
+	if list.Get("children").Get("length").Int() == 0 {
+		list.Set("textContent", "No open rooms yet.")
+	}
+}
+
+// create opens a new room with this player in it
+func (rc *roomClient) create() {
+	data, err := fetchBytes("POST", "/api/rooms", rc.playerRequest())
+	if err != nil {
+		setRoomStatus("⚠️ Couldn't create a room")
+		logGameEvent("error", 1, 0, "Room create failed: "+err.Error())
+		return
+	}
+	rc.enter(data)
+}
+
+// join takes a seat in a room's lobby
+func (rc *roomClient) join(id string) {
+	data, err := fetchBytes("POST", "/api/rooms/"+url.PathEscape(id)+"/join", rc.playerRequest())
+	if err != nil {
+		setRoomStatus("⚠️ Couldn't join that room; it may be full or already racing")
+		logGameEvent("error", 1, 0, "Room join failed: "+err.Error())
+		if rc.roomID == "" && rc.listTimer.IsUndefined() {
+			rc.showList()
+		}
+		return
+	}
+	rc.enter(data)
+}
+
+// playerRequest is the body of a create or join request
+func (rc *roomClient) playerRequest() []byte {
+	data, _ := json.Marshal(map[string]string{"player_id": getPlayerID(), "name": getPlayerName()})
+	return data
+}
+
+// enter connects to the room described by a create or join response
+func (rc *roomClient) enter(data []byte) {
+	var state netplay.RoomState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return
+	}
+	rc.stopList()
+
+	rc.roomID = state.ID
+	rc.state = state
+	rc.left = false
+	rc.attempts = 0
+	// The URL is the room's invite link, and rejoins it after a reload
+	js.Global().Get("history").Call("replaceState", nil, "", "/?mode=rooms&room="+url.QueryEscape(state.ID))
+	logGameEvent("room_joined", 1, 0, state.ID)
+
+	rc.showLobby()
+	rc.connect()
+}
+
+// connect opens the room's WebSocket
+func (rc *roomClient) connect() {
+	for _, f := range rc.wsFuncs {
+		f.Release()
+	}
+	params := url.Values{"player": {getPlayerID()}, "player_token": {playerToken}}
+	rc.ws = js.Global().Get("WebSocket").New(webSocketURL("/ws/rooms/" + url.PathEscape(rc.roomID) + "?" + params.Encode()))
+
+	opened := false
+	onOpen := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		opened = true
+		return nil
+	})
+	onMessage := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		var msg netplay.RoomMessage
+		if err := json.Unmarshal([]byte(args[0].Get("data").String()), &msg); err == nil {
+			rc.receive(msg)
+		}
+		return nil
+	})
+	onClose := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		switch {
+		case rc.left:
+		case rc.state.Phase == netplay.PhaseFinished:
+			// The room closed after the race; the results stay up until the player leaves
+			rc.left = true
+		case !opened && rc.attempts > 0:
+			// The room is gone, or the player lost their seat in it
+			rc.showList()
+			setRoomStatus("🚪 That room has closed")
+		default:
+			rc.reconnect()
+		}
+		return nil
+	})
+	rc.ws.Set("onopen", onOpen)
+	rc.ws.Set("onmessage", onMessage)
+	rc.ws.Set("onclose", onClose)
+	rc.wsFuncs = []js.Func{onOpen, onMessage, onClose}
+}
+
+// reconnect retries the connection with exponential backoff. Racers who stay
+// away too long forfeit.
+func (rc *roomClient) reconnect() {
+	delay := math.Min(maxReconnectDelayMs, reconnectDelayMs*math.Pow(2, float64(rc.attempts)))
+	rc.attempts++
+	setRoomStatus("🔌 Connection lost, reconnecting...")
+	logGameEvent("room_reconnect", 1, 0, rc.roomID)
+
+	var retry js.Func
+	retry = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		retry.Release()
+		if !rc.left {
+			rc.connect()
+		}
+		return nil
+	})
+	js.Global().Call("setTimeout", retry, delay)
+}
+
+// receive handles a message from the room
+func (rc *roomClient) receive(msg netplay.RoomMessage) {
+	switch msg.Type {
+	case netplay.TypeRoom:
+		if msg.Room == nil {
+			return
+		}
+		rc.attempts = 0
+		rc.state = *msg.Room
+		// The results screen stays up once the race is over
+		if rc.state.Phase != netplay.PhaseFinished {
+			rc.showLobby()
+		}
+
+	case netplay.TypeCountdown:
+		setRoomStatus("🚦 Race starts in " + strconv.Itoa(msg.Countdown) + "...")
+
+	case netplay.TypeRace:
+		if msg.Race == nil {
+			return
+		}
+		rc.frame = msg.Race
+		for _, event := range msg.Events {
+			if event.Seat == rc.state.You && event.Type == race.EventCrash {
+				logGameEvent("race_crash", 1, rc.frame.Players[event.Seat].Score, event.Crash)
+			}
+		}
+		rc.r.RenderRace(rc.frame, rc.state.You)
+
+	case netplay.TypeResults:
+		rc.showResults(msg.Results)
+	}
+}
+
+// send writes a command to the room if connected
+func (rc *roomClient) send(cmd netplay.RoomCommand) {
+	if rc.ws.IsUndefined() || rc.ws.Get("readyState").Int() != js.Global().Get("WebSocket").Get("OPEN").Int() {
+		return
+	}
+	if data, err := json.Marshal(cmd); err == nil {
+		rc.ws.Call("send", string(data))
+	}
+}
+
+// leave gives up the seat, forfeiting a race in progress, and goes back to the room list
+func (rc *roomClient) leave() {
+	rc.send(netplay.RoomCommand{Type: netplay.TypeLeave})
+	rc.left = true
+	if !rc.ws.IsUndefined() {
+		rc.ws.Call("close")
+	}
+	logGameEvent("room_left", 1, 0, rc.roomID)
+	rc.showList()
+}
+
+// isReady reports whether this player is ready in the lobby
+func (rc *roomClient) isReady() bool {
+	for _, p := range rc.state.Players {
+		if p.Seat == rc.state.You {
+			return p.Ready
+		}
+	}
+	return false
+}
+
+// showLobby lists the room's players with their ready checks
+func (rc *roomClient) showLobby() {
+	document := js.Global().Get("document")
+	showRoomView("lobby")
+
+	list := document.Call("getElementById", "room-players")
+	list.Call("replaceChildren")
+	for _, p := range rc.state.Players {
+		item := document.Call("createElement", "li")
+		item.Get("style").Set("color", renderer.RaceColor(p.Seat))
+		label := p.Name
+		if p.Seat == rc.state.You {
+			label += " (you)"
+		}
+		switch {
+		case !p.Connected:
+			label += " 🔌"
+		case p.Ready:
+			label += " ✅"
+		default:
+			label += " ⏳"
+		}
+		item.Set("textContent", label)
+		list.Call("appendChild", item)
+	}
+
+	ready := document.Call("getElementById", "room-ready")
+	ready.Set("disabled", rc.state.Phase != netplay.PhaseLobby && rc.state.Phase != netplay.PhaseCountdown)
+	if rc.isReady() {
+		ready.Set("textContent", "✋ Not ready")
+	} else {
+		ready.Set("textContent", "✅ Ready")
+	}
+
+	switch rc.state.Phase {
+	case netplay.PhaseLobby:
+		if len(rc.state.Players) < race.MinPlayers {
+			setRoomStatus("⏳ Waiting for another player. Share this page's link to invite someone")
+		} else {
+			setRoomStatus("⏳ The race starts when everyone is ready")
+		}
+	case netplay.PhaseRacing:
+		setRoomStatus("🏎️ Collect " + strconv.Itoa(race.TargetAlerts) + " alerts first and stay off the trails")
+	}
+}
+
+// showResults shows the final placings
+func (rc *roomClient) showResults(results []race.Result) {
+	document := js.Global().Get("document")
+	showRoomView("results")
+
+	list := document.Call("getElementById", "room-results")
+	list.Call("replaceChildren")
+	for _, result := range results {
+		item := document.Call("createElement", "li")
+		item.Get("style").Set("color", renderer.RaceColor(result.Seat))
+		label := result.Name + ": " + strconv.Itoa(result.Score) + " (" + strconv.Itoa(result.Alerts) + " alerts)"
+		if result.Alive {
+			label += " 🏁"
+		}
+		item.Set("textContent", label)
+		list.Call("appendChild", item)
+	}
+
+	if len(results) > 0 && results[0].Seat == rc.state.You {
+		setRoomStatus("🏆 You won!")
+	} else {
+		setRoomStatus("🏁 Race over")
+	}
+	for _, result := range results {
+		if result.Seat == rc.state.You {
+			logGameEvent("race_finished", 1, result.Score, "Rank "+strconv.Itoa(result.Rank))
+		}
+	}
+}
+
+// Controls, sent to the room. Races can't be paused, restarted, or rolled back.
+
+func (rc *roomClient) SetDirection(dir game.Direction) {
+	rc.send(netplay.RoomCommand{Type: netplay.TypeInput, Action: directionActions[dir]})
+}
+
+func (rc *roomClient) Pause()                {}
+func (rc *roomClient) Restart()              {}
+func (rc *roomClient) Rollback() bool        { return false }
+func (rc *roomClient) GetRollbacksLeft() int { return 0 }
+
+// showRoomView shows one part of the room panel: the room list, the lobby, or the results
+func showRoomView(view string) {
+	document := js.Global().Get("document")
+	for _, id := range []string{"list", "lobby", "results"} {
+		display := "none"
+		if id == view {
+			display = "block"
+		}
+		document.Call("getElementById", "room-view-"+id).Get("style").Set("display", display)
+	}
+}
+
+// setRoomStatus shows the room's state in the sidebar
+func setRoomStatus(status string) {
+	js.Global().Get("document").Call("getElementById", "room-status").Set("textContent", status)
+}
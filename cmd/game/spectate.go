@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"syscall/js"
+
+	"github.com/NathanNam/incident-commander-game/internal/game"
+	"github.com/NathanNam/incident-commander-game/internal/netplay"
+	"github.com/NathanNam/incident-commander-game/internal/renderer"
+)
+
+// Spectator streaming tuning
+const (
+	keyframeInterval   = 100  // Ticks between keyframes, so a lost delta doesn't last
+	streamRetryDelayMs = 5000 // Wait before reopening a dropped stream
+)
+
+// Live streaming of this page's game to spectators, or of another game to this page
+var (
+	liveStream *broadcaster
+	watching   *watcher
+)
+
+// broadcaster streams the game played in this page to the server as a
+// keyframe followed by a delta per tick
+type broadcaster struct {
+	ws            js.Value
+	open          bool
+	prev          game.StateFrame
+	hasPrev       bool // prev was sent, so the next frame can be a delta
+	sinceKeyframe int
+	funcs         []js.Func
+}
+
+// startBroadcast lets anyone watch this page's game from the lobby
+func startBroadcast(g *game.Game) {
+	liveStream = &broadcaster{}
+	liveStream.connect(g)
+}
+
+// connect opens the stream to the server
+func (b *broadcaster) connect(g *game.Game) {
+	mode, _, ranked := scoreMode(g)
+	if !ranked {
+		mode = "custom"
+	}
+	params := url.Values{}
+	params.Set("player", achievementProgress.PlayerID)
+	params.Set("player_token", playerToken)
+	params.Set("name", getPlayerName())
+	params.Set("mode", mode)
+
+	for _, f := range b.funcs {
+		f.Release()
+	}
+	b.ws = js.Global().Get("WebSocket").New(webSocketURL("/ws/broadcast?" + params.Encode()))
+
+	onOpen := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		b.open = true
+		b.hasPrev = false
+		return nil
+	})
+	onMessage := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		var msg netplay.StreamMessage
+		if err := json.Unmarshal([]byte(args[0].Get("data").String()), &msg); err == nil && msg.Type == netplay.TypeWelcome {
+			setSpectateStatus("🔴 Live, anyone can watch", "/?watch="+msg.SessionID)
+			logGameEvent("broadcast_started", g.GetLevel(), g.GetScore(), msg.SessionID)
+		}
+		return nil
+	})
+	onClose := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		b.open = false
+		var retry js.Func
+		retry = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			retry.Release()
+			b.connect(g)
+			return nil
+		})
+		js.Global().Call("setTimeout", retry, streamRetryDelayMs)
+		return nil
+	})
+	b.ws.Set("onopen", onOpen)
+	b.ws.Set("onmessage", onMessage)
+	b.ws.Set("onclose", onClose)
+	b.funcs = []js.Func{onOpen, onMessage, onClose}
+}
+
+// broadcastFrame sends the change since the last tick, or a keyframe when the
+// board changed or it's been a while since the last one
+func broadcastFrame(g *game.Game) {
+	b := liveStream
+	if b == nil || !b.open {
+		return
+	}
+
+	frame := g.Frame()
+	msg := netplay.StreamMessage{Type: netplay.TypeKeyframe, Frame: &frame}
+	if b.hasPrev && b.sinceKeyframe < keyframeInterval {
+		if delta, ok := netplay.Diff(b.prev, frame); ok {
+			b.prev = frame
+			b.sinceKeyframe++
+			if delta.Empty() {
+				return
+			}
+			msg = netplay.StreamMessage{Type: netplay.TypeDelta, Delta: &delta}
+		}
+	}
+	if msg.Type == netplay.TypeKeyframe {
+		b.prev = frame
+		b.hasPrev = true
+		b.sinceKeyframe = 0
+	}
+
+	if data, err := json.Marshal(msg); err == nil {
+		b.ws.Call("send", string(data))
+	}
+}
+
+// watcher mirrors another player's live game into the local game, which is only rendered
+type watcher struct {
+	id    string // Session ID, or "top" to follow the highest scoring game
+	g     *game.Game
+	r     *renderer.Renderer
+	frame game.StateFrame
+	ready bool // A keyframe arrived
+	funcs []js.Func
+}
+
+// startWatching spectates a live game instead of playing
+func startWatching(g *game.Game, r *renderer.Renderer, id string) {
+	watching = &watcher{id: id, g: g, r: r}
+	setSpectateStatus("👀 Connecting...", "")
+	watching.connect()
+}
+
+// connect opens the spectator stream for the watched session
+func (w *watcher) connect() {
+	for _, f := range w.funcs {
+		f.Release()
+	}
+	w.ready = false
+	ws := js.Global().Get("WebSocket").New(webSocketURL("/spectate/" + url.PathEscape(w.id)))
+
+	onMessage := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		var msg netplay.StreamMessage
+		if err := json.Unmarshal([]byte(args[0].Get("data").String()), &msg); err == nil {
+			w.receive(msg)
+		}
+		return nil
+	})
+	onClose := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		// Following the top game moves on to the next one; a single session is just over
+		if w.id != "top" {
+			setSpectateStatus("🏁 This game has ended", "/lobby")
+			return nil
+		}
+		setSpectateStatus("⏳ Waiting for the next top game...", "/lobby")
+		var retry js.Func
+		retry = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			retry.Release()
+			w.connect()
+			return nil
+		})
+		js.Global().Call("setTimeout", retry, streamRetryDelayMs)
+		return nil
+	})
+	ws.Set("onmessage", onMessage)
+	ws.Set("onclose", onClose)
+	w.funcs = []js.Func{onMessage, onClose}
+}
+
+// receive applies a keyframe or delta and renders the result
+func (w *watcher) receive(msg netplay.StreamMessage) {
+	switch msg.Type {
+	case netplay.TypeKeyframe:
+		if msg.Frame == nil {
+			return
+		}
+		w.frame = *msg.Frame
+		if !w.ready {
+			setSpectateStatus("👀 Watching "+msg.Name, "/lobby")
+			logGameEvent("spectate_started", w.frame.Level, w.frame.Score, msg.SessionID)
+		}
+		w.ready = true
+
+	case netplay.TypeDelta:
+		if msg.Delta == nil || !w.ready {
+			return
+		}
+		if err := msg.Delta.Apply(&w.frame); err != nil {
+			// The next keyframe puts the board right again
+			w.ready = false
+			return
+		}
+
+	default:
+		return
+	}
+
+	w.g.ApplyFrame(w.frame)
+	w.g.TakeEvents()
+	w.r.Render(w.g)
+}
+
+// webSocketURL returns the WebSocket URL for a path on this page's server
+func webSocketURL(path string) string {
+	location := js.Global().Get("location")
+	scheme := "ws:"
+	if location.Get("protocol").String() == "https:" {
+		scheme = "wss:"
+	}
+	return scheme + "//" + location.Get("host").String() + path
+}
+
+// setSpectateStatus shows the live streaming state in the sidebar with an optional link
+func setSpectateStatus(status, link string) {
+	document := js.Global().Get("document")
+	document.Call("getElementById", "spectate-panel").Get("style").Set("display", "block")
+	document.Call("getElementById", "spectate-status").Set("textContent", status)
+
+	anchor := document.Call("getElementById", "spectate-link")
+	if link == "" {
+		anchor.Get("style").Set("display", "none")
+		return
+	}
+	anchor.Get("style").Set("display", "block")
+	anchor.Set("href", link)
+	if link == "/lobby" {
+		anchor.Set("textContent", "📺 All live games")
+	} else {
+		anchor.Set("textContent", "🔗 Watch link")
+	}
+}
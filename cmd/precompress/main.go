@@ -0,0 +1,93 @@
+// Command precompress writes brotli (.br) and gzip (.gz) copies of web assets
+// at the highest compression levels, which are too slow to run when the server
+// starts. The server embeds the copies and serves them by Accept-Encoding.
+//
+//	go run ./cmd/precompress web/static/game.wasm web/static/wasm_exec.js
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// encoder compresses a file into one variant
+type encoder struct {
+	ext      string
+	compress func(w io.Writer) io.WriteCloser
+}
+
+var encoders = []encoder{
+	{".br", func(w io.Writer) io.WriteCloser { return brotli.NewWriterLevel(w, brotli.BestCompression) }},
+	{".gz", func(w io.Writer) io.WriteCloser {
+		zw, _ := gzip.NewWriterLevel(w, gzip.BestCompression)
+		return zw
+	}},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: precompress FILE...")
+		os.Exit(2)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, (len(os.Args)-1)*len(encoders))
+	for _, path := range os.Args[1:] {
+		for _, enc := range encoders {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := precompress(path, enc); err != nil {
+					errs <- err
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	failed := false
+	for err := range errs {
+		fmt.Fprintln(os.Stderr, "precompress:", err)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// precompress writes one compressed copy of path, unless it's already up to date
+func precompress(path string, enc encoder) error {
+	src, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	out := path + enc.ext
+	if dst, err := os.Stat(out); err == nil && !dst.ModTime().Before(src.ModTime()) {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	w := enc.compress(&buf)
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := os.WriteFile(out, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d -> %d bytes\n", out, len(data), buf.Len())
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/NathanNam/incident-commander-game/internal/achievements"
+	"github.com/NathanNam/incident-commander-game/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// playerIDPattern restricts player IDs to the client-generated format
+var playerIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Achievement sync limits. Every update rewrites the whole store file, so
+// updates are rate limited per client IP and the number of players is capped.
+const (
+	maxAchievementBody    = 8 << 10
+	maxAchievementPlayers = 10_000
+	achievementRateLimit  = 0.2 // Updates per second per IP
+	achievementRateBurst  = 10
+)
+
+// errAchievementStoreFull is returned for a new player once the store is at capacity
+var errAchievementStoreFull = errors.New("achievement store is full")
+
+// achievementLimiter rate limits achievement updates per client IP
+var achievementLimiter = NewRateLimiter(achievementRateLimit, achievementRateBurst)
+
+// AchievementStore persists achievement progress per player in a JSON file
+type AchievementStore struct {
+	mu       sync.Mutex
+	path     string
+	progress map[string]*achievements.Progress
+}
+
+// NewAchievementStore loads the store from path, starting empty if the file doesn't exist
+func NewAchievementStore(path string) (*AchievementStore, error) {
+	s := &AchievementStore{
+		path:     path,
+		progress: make(map[string]*achievements.Progress),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.progress); err != nil {
+		return nil, fmt.Errorf("corrupt achievement store %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Get returns a copy of a player's progress
+func (s *AchievementStore) Get(playerID string) *achievements.Progress {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := achievements.NewProgress(playerID)
+	if stored, ok := s.progress[playerID]; ok {
+		result.Merge(stored)
+	}
+	return result
+}
+
+// Merge combines incoming progress with the stored progress and persists it.
+// Returns the merged progress and the IDs that were new to the server.
+func (s *AchievementStore) Merge(incoming *achievements.Progress) (*achievements.Progress, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.progress[incoming.PlayerID]
+	if !ok {
+		if len(s.progress) >= maxAchievementPlayers {
+			return nil, nil, errAchievementStoreFull
+		}
+		stored = achievements.NewProgress(incoming.PlayerID)
+	}
+
+	var added []string
+	for id := range incoming.Unlocked {
+		if _, known := stored.Unlocked[id]; !known {
+			added = append(added, id)
+		}
+	}
+
+	merged := achievements.NewProgress(incoming.PlayerID)
+	merged.Merge(stored)
+	merged.Merge(incoming)
+	s.progress[incoming.PlayerID] = merged
+
+	if err := s.save(); err != nil {
+		return nil, nil, err
+	}
+	return merged, added, nil
+}
+
+// save writes the store atomically via a temporary file
+func (s *AchievementStore) save() error {
+	data, err := json.Marshal(s.progress)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// achievementsHandler returns (GET) or merges (PUT) a player's achievement progress
+func achievementsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := telemetry.GetLogger()
+	tracer := telemetry.GetTracer()
+
+	ctx, span := tracer.Start(ctx, "sync_achievements")
+	defer span.End()
+
+	playerID := r.PathValue("player")
+	if !playerIDPattern.MatchString(playerID) {
+		span.SetStatus(codes.Error, "Invalid player ID")
+		http.Error(w, "Invalid player ID", http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(
+		attribute.String("player.id", playerID),
+		attribute.String("http.method", r.Method),
+	)
+
+	var progress *achievements.Progress
+	switch r.Method {
+	case http.MethodGet:
+		progress = achievementStore.Get(playerID)
+
+	case http.MethodPut, http.MethodPost:
+		if !allowRequest(w, achievementLimiter, clientIP(r)) {
+			span.SetStatus(codes.Error, "Rate limited")
+			return
+		}
+		if !authorizePlayer(w, r, playerID) {
+			span.SetStatus(codes.Error, "Invalid player token")
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAchievementBody))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Failed to read request body")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		incoming := achievements.NewProgress(playerID)
+		if err := json.Unmarshal(body, incoming); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Failed to unmarshal achievement progress")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		incoming.PlayerID = playerID
+		if err := incoming.Validate(); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Invalid achievement progress")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var added []string
+		progress, added, err = achievementStore.Merge(incoming)
+		if errors.Is(err, errAchievementStoreFull) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Achievement store full")
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Failed to save achievement progress")
+			logger.ErrorContext(ctx, "Failed to save achievement progress", "error", err, "player_id", playerID)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		for _, id := range added {
+			achievementUnlockCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("achievement", id)))
+			logger.InfoContext(ctx, "Achievement unlocked", "player_id", playerID, "achievement", id)
+		}
+		span.SetAttributes(attribute.Int("achievements.added", len(added)))
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	span.SetAttributes(attribute.Int("achievements.unlocked", len(progress.Unlocked)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(progress)
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NathanNam/incident-commander-game/internal/telemetry"
+	"github.com/NathanNam/incident-commander-game/web"
+	"github.com/andybalholm/brotli"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// AssetStore serves the game's browser files: the copy embedded in the binary,
+// or a directory on disk while developing
+type AssetStore struct {
+	fsys   fs.FS
+	dir    string            // Empty when serving the embedded copy
+	assets map[string]*asset // Embedded files by path, and by hashed path when fingerprinted
+}
+
+// asset is an embedded file, loaded into memory with its compressed copies
+type asset struct {
+	name        string // Path in the asset tree, e.g. static/game.wasm
+	hashedName  string // Content-hashed path, e.g. static/game.3f2a9c1b7d4e.wasm; empty for pages
+	data        []byte
+	etag        string
+	contentType string
+	encoded     map[string][]byte // Smaller compressed copies by content coding
+}
+
+// assetEncoding is a compression the server can serve. Copies made by
+// cmd/precompress are used when they match; otherwise the server compresses
+// at startup at a faster level.
+type assetEncoding struct {
+	coding   string // Content-Encoding value
+	ext      string // Extension of the precompressed copy
+	compress func(w io.Writer) io.WriteCloser
+	open     func(r io.Reader) (io.Reader, error)
+}
+
+// assetEncodings are in order of preference
+var assetEncodings = []assetEncoding{
+	{"br", ".br",
+		func(w io.Writer) io.WriteCloser { return brotli.NewWriterLevel(w, 5) },
+		func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil }},
+	{"gzip", ".gz",
+		func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+}
+
+// fingerprintedDirs hold the files pages link to, which get content-hashed URLs
+var fingerprintedDirs = []string{"static/", "images/"}
+
+// immutableCache lets browsers keep content-hashed files without revalidating
+const immutableCache = "public, max-age=31536000, immutable"
+
+// webAssets serves index.html, the lobby, and the built game
+var webAssets *AssetStore
+
+// NewAssetStore serves the files in dir, or the embedded files if dir is empty.
+// Embedded files never change while the server runs, so they're hashed,
+// compressed, and linked by content-hashed URLs once here.
+func NewAssetStore(dir string) (*AssetStore, error) {
+	if dir != "" {
+		return &AssetStore{fsys: os.DirFS(dir), dir: dir}, nil
+	}
+	return loadEmbeddedAssets(web.Assets)
+}
+
+// loadEmbeddedAssets reads every file into memory and prepares it for serving
+func loadEmbeddedAssets(fsys fs.FS) (*AssetStore, error) {
+	a := &AssetStore{fsys: fsys, assets: make(map[string]*asset)}
+	var files []*asset
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || precompressedCopy(name) {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = http.DetectContentType(data)
+		}
+		files = append(files, &asset{name: name, data: data, contentType: contentType})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Hash linked files first, so pages can point at their hashed URLs
+	for _, f := range files {
+		if fingerprinted(f.name) {
+			f.hashedName = hashedName(f.name, f.data)
+		}
+	}
+	for _, f := range files {
+		if strings.HasSuffix(f.name, ".html") {
+			for _, linked := range files {
+				if linked.hashedName != "" {
+					f.data = bytes.ReplaceAll(f.data, []byte(`"/`+linked.name+`"`), []byte(`"/`+linked.hashedName+`"`))
+				}
+			}
+		}
+		sum := sha256.Sum256(f.data)
+		f.etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+	}
+
+	var wg sync.WaitGroup
+	for _, f := range files {
+		if compressible(f.contentType) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				f.encoded = encodeAsset(fsys, f)
+			}()
+		}
+	}
+	wg.Wait()
+
+	for _, f := range files {
+		a.assets[f.name] = f
+		if f.hashedName != "" {
+			a.assets[f.hashedName] = f
+		}
+	}
+	return a, nil
+}
+
+// precompressedCopy reports whether a file is a compressed copy of another
+func precompressedCopy(name string) bool {
+	for _, enc := range assetEncodings {
+		if strings.HasSuffix(name, enc.ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// fingerprinted reports whether a file gets a content-hashed URL
+func fingerprinted(name string) bool {
+	for _, dir := range fingerprintedDirs {
+		if strings.HasPrefix(name, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// hashedName puts a hash of the content before the extension
+func hashedName(name string, data []byte) string {
+	sum := sha256.Sum256(data)
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:6]) + ext
+}
+
+// compressible reports whether a content type is worth compressing
+func compressible(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/wasm", "application/javascript", "text/javascript", "application/json", "image/svg+xml":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/")
+}
+
+// encodeAsset returns the compressed copies of a file worth serving. A
+// precompressed copy is only used if it still matches the file; one left over
+// from an older build is replaced.
+func encodeAsset(fsys fs.FS, f *asset) map[string][]byte {
+	logger := telemetry.GetLogger()
+	encoded := make(map[string][]byte)
+	for _, enc := range assetEncodings {
+		data, err := fs.ReadFile(fsys, f.name+enc.ext)
+		if err == nil && !decodesTo(enc, data, f.data) {
+			logger.Warn("Precompressed asset is out of date; compressing again", "asset", f.name+enc.ext)
+			err = fs.ErrNotExist
+		}
+		if err != nil {
+			start := time.Now()
+			if data, err = compressAsset(enc, f.data); err != nil {
+				logger.Warn("Failed to compress asset", "asset", f.name, "encoding", enc.coding, "error", err)
+				continue
+			}
+			if len(f.data) > 1<<20 {
+				logger.Info("Compressed asset at startup; make build-prod precompresses it",
+					"asset", f.name, "encoding", enc.coding, "duration_ms", time.Since(start).Milliseconds())
+			}
+		}
+		if len(data) < len(f.data) {
+			encoded[enc.coding] = data
+		}
+	}
+	return encoded
+}
+
+// compressAsset compresses data with one encoding
+func compressAsset(enc assetEncoding, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := enc.compress(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodesTo reports whether a compressed copy decompresses to want
+func decodesTo(enc assetEncoding, compressed, want []byte) bool {
+	r, err := enc.open(bytes.NewReader(compressed))
+	if err != nil {
+		return false
+	}
+	got, err := io.ReadAll(r)
+	return err == nil && bytes.Equal(got, want)
+}
+
+// Source describes where the files come from, for logs
+func (a *AssetStore) Source() string {
+	if a.dir != "" {
+		return a.dir
+	}
+	return "embedded"
+}
+
+// Has reports whether a file exists
+func (a *AssetStore) Has(name string) bool {
+	info, err := fs.Stat(a.fsys, name)
+	return err == nil && !info.IsDir()
+}
+
+// ReadFile returns a file's contents, e.g. a scenario the server replays
+func (a *AssetStore) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(a.fsys, name)
+}
+
+// ServeFile serves one file by its path in the asset tree. Content-hashed paths
+// are cached for good; anything else is revalidated on every load, answering
+// with a 304 when the ETag (or, on disk, the modification time) matches.
+func (a *AssetStore) ServeFile(w http.ResponseWriter, r *http.Request, name string) {
+	if a.dir != "" {
+		a.serveFromDisk(w, r, name)
+		return
+	}
+
+	f, ok := a.assets[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", f.contentType)
+	if name == f.hashedName {
+		header.Set("Cache-Control", immutableCache)
+	} else {
+		header.Set("Cache-Control", "no-cache")
+	}
+
+	body, etag, coding := f.data, f.etag, "identity"
+	if len(f.encoded) > 0 {
+		header.Add("Vary", "Accept-Encoding")
+		if c := negotiateEncoding(r.Header.Get("Accept-Encoding"), f.encoded); c != "" {
+			body, coding = f.encoded[c], c
+			etag = strings.TrimSuffix(etag, `"`) + "-" + c + `"`
+			header.Set("Content-Encoding", c)
+			// ServeContent leaves the length out of encoded responses, but
+			// browsers need it to show download progress
+			if r.Header.Get("Range") == "" {
+				header.Set("Content-Length", strconv.Itoa(len(body)))
+			}
+		}
+	}
+	header.Set("ETag", etag)
+
+	start := time.Now()
+	cw := &countingWriter{ResponseWriter: w, status: http.StatusOK}
+	http.ServeContent(cw, r, "", time.Time{}, bytes.NewReader(body))
+	if cw.status == http.StatusOK || cw.status == http.StatusPartialContent {
+		recordAssetTransfer(r.Context(), f.name, coding, cw.written, time.Since(start))
+	}
+}
+
+// serveFromDisk serves a file from the asset directory as it is now
+func (a *AssetStore) serveFromDisk(w http.ResponseWriter, r *http.Request, name string) {
+	f, err := a.fsys.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), content)
+}
+
+// Handler serves the files under dir, named by the rest of the request path.
+// Use it behind http.StripPrefix. Directories aren't listed.
+func (a *AssetStore) Handler(dir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Join(dir, strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/"))
+		if name == "" {
+			name = "."
+		}
+		a.ServeFile(w, r, name)
+	})
+}
+
+// negotiateEncoding picks the available content coding the client prefers,
+// breaking ties by assetEncodings order. Returns "" for no compression.
+func negotiateEncoding(acceptEncoding string, available map[string][]byte) string {
+	quality := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		quality[strings.ToLower(coding)] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range assetEncodings {
+		if _, ok := available[enc.coding]; !ok {
+			continue
+		}
+		q, ok := quality[enc.coding]
+		if !ok {
+			q = quality["*"]
+		}
+		if q > bestQ {
+			best, bestQ = enc.coding, q
+		}
+	}
+	return best
+}
+
+// countingWriter records the status and body size of a response
+type countingWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (w *countingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// recordAssetTransfer records how many bytes an asset took over the wire and
+// how long writing them took, which tracks the client's download speed for
+// anything bigger than the socket buffers
+func recordAssetTransfer(ctx context.Context, name, coding string, written int64, elapsed time.Duration) {
+	attrs := metric.WithAttributes(
+		attribute.String("asset", name),
+		attribute.String("encoding", coding),
+	)
+	assetTransferBytes.Record(ctx, written, attrs)
+	assetTransferDuration.Record(ctx, elapsed.Seconds(), attrs)
+}
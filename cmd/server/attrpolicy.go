@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// overflowValue replaces attribute values past an attribute's distinct value cap
+const overflowValue = "other"
+
+// attributeRule is what the policy does with one attribute on a metric
+type attributeRule int
+
+const (
+	ruleDrop      attributeRule = iota // Unlisted attributes never reach metrics
+	ruleMetric                         // Kept as is
+	ruleTraceOnly                      // Moved to the request's span
+	ruleHashed                         // Kept as a short hash of the value
+	ruleBucketed                       // Numbers kept as the range they fall in
+)
+
+// AttributePolicy keeps metric series bounded. Only listed attributes reach
+// metrics, some of them hashed or bucketed, and each attribute's distinct
+// values are capped, with the rest recorded as "other".
+type AttributePolicy struct {
+	rules     map[attribute.Key]attributeRule
+	buckets   map[attribute.Key][]float64 // Ascending bounds for bucketed attributes
+	maxValues int
+
+	mu   sync.Mutex
+	seen map[attribute.Key]map[string]bool // Distinct values recorded so far
+}
+
+// attributePolicy applies to metrics derived from client telemetry, created at startup
+var attributePolicy *AttributePolicy
+
+// NewAttributePolicy builds a policy from the configuration
+func NewAttributePolicy(cfg AttributePolicyConfig) *AttributePolicy {
+	p := &AttributePolicy{
+		rules:     make(map[attribute.Key]attributeRule),
+		buckets:   make(map[attribute.Key][]float64),
+		maxValues: cfg.MaxValues,
+		seen:      make(map[attribute.Key]map[string]bool),
+	}
+	for _, list := range []struct {
+		keys []string
+		rule attributeRule
+	}{
+		{cfg.Metric, ruleMetric},
+		{cfg.TraceOnly, ruleTraceOnly},
+		{cfg.Hashed, ruleHashed},
+	} {
+		for _, key := range list.keys {
+			p.rules[attribute.Key(key)] = list.rule
+		}
+	}
+	for key, bounds := range cfg.Bucketed {
+		p.rules[attribute.Key(key)] = ruleBucketed
+		p.buckets[attribute.Key(key)] = bounds
+	}
+	return p
+}
+
+// MetricAttributes filters attributes for a metric measurement. Trace-only
+// attributes are set on ctx's span instead.
+func (p *AttributePolicy) MetricAttributes(ctx context.Context, attrs ...attribute.KeyValue) attribute.Set {
+	kept := make([]attribute.KeyValue, 0, len(attrs))
+	var traceOnly []attribute.KeyValue
+
+	for _, kv := range attrs {
+		switch p.rules[kv.Key] {
+		case ruleMetric:
+			kept = append(kept, p.capped(ctx, kv))
+		case ruleTraceOnly:
+			traceOnly = append(traceOnly, kv)
+		case ruleHashed:
+			sum := sha256.Sum256([]byte(kv.Value.Emit()))
+			kept = append(kept, p.capped(ctx, kv.Key.String(hex.EncodeToString(sum[:4]))))
+		case ruleBucketed:
+			if label, ok := bucketLabel(kv.Value, p.buckets[kv.Key]); ok {
+				kept = append(kept, kv.Key.String(label))
+			}
+		}
+	}
+
+	if len(traceOnly) > 0 {
+		trace.SpanFromContext(ctx).SetAttributes(traceOnly...)
+	}
+	return attribute.NewSet(kept...)
+}
+
+// capped returns kv, or kv with the overflow value once its attribute has
+// reached the cap on distinct values
+func (p *AttributePolicy) capped(ctx context.Context, kv attribute.KeyValue) attribute.KeyValue {
+	value := kv.Value.Emit()
+
+	p.mu.Lock()
+	values := p.seen[kv.Key]
+	if values == nil {
+		values = make(map[string]bool)
+		p.seen[kv.Key] = values
+	}
+	ok := values[value]
+	if !ok && len(values) < p.maxValues {
+		values[value] = true
+		ok = true
+	}
+	p.mu.Unlock()
+
+	if ok {
+		return kv
+	}
+	telemetryAttributeOverflow.Add(ctx, 1, metric.WithAttributes(attribute.String("attribute", string(kv.Key))))
+	return kv.Key.String(overflowValue)
+}
+
+// bucketLabel names the range a numeric value falls in: "<1", "1-5", "5-10"
+// or "10+" for bounds 1, 5, 10. Values that aren't numbers have no bucket.
+func bucketLabel(value attribute.Value, bounds []float64) (string, bool) {
+	var v float64
+	switch value.Type() {
+	case attribute.INT64:
+		v = float64(value.AsInt64())
+	case attribute.FLOAT64:
+		v = value.AsFloat64()
+	default:
+		return "", false
+	}
+
+	format := func(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) }
+	i := sort.SearchFloat64s(bounds, v)
+	if i < len(bounds) && bounds[i] == v {
+		i++ // Bounds are inclusive below
+	}
+	switch {
+	case i == 0:
+		return "<" + format(bounds[0]), true
+	case i == len(bounds):
+		return format(bounds[i-1]) + "+", true
+	default:
+		return format(bounds[i-1]) + "-" + format(bounds[i]), true
+	}
+}
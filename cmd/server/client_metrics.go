@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/NathanNam/incident-commander-game/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Client metric types, and the instrument each becomes
+const (
+	clientCounter       = "counter"       // Float64Counter; values are increments
+	clientUpDownCounter = "updowncounter" // Float64UpDownCounter; values are signed increments
+	clientGauge         = "gauge"         // Float64Gauge
+	clientHistogram     = "histogram"     // Float64Histogram
+)
+
+// Client metrics are exported under this prefix, apart from the server's own
+const clientMetricPrefix = "client_"
+
+// clientMetricSpec is the type and unit of a metric clients may report
+type clientMetricSpec struct {
+	metricType string
+	unit       string
+}
+
+// clientMetricSpecs declares every metric the browser reports. Other names are
+// rejected, so clients can't create instruments or change a metric's type or unit.
+var clientMetricSpecs = map[string]clientMetricSpec{
+	"fps":                               {clientHistogram, "{frame}/s"},
+	"frames_rendered_total":             {clientCounter, "{frame}"},
+	"asset_load_duration_ms":            {clientHistogram, "ms"},
+	"asset_transfer_size_bytes":         {clientHistogram, "By"},
+	"telemetry_batches_delivered_total": {clientCounter, "{batch}"},
+	"telemetry_batches_beaconed_total":  {clientCounter, "{batch}"},
+	"telemetry_batches_retried_total":   {clientCounter, "{batch}"},
+	"telemetry_batches_dropped_total":   {clientCounter, "{batch}"},
+	"telemetry_outbox_batches":          {clientGauge, "{batch}"},
+}
+
+// clientInstrument is the instrument for one declared client metric
+type clientInstrument struct {
+	clientMetricSpec
+	record func(ctx context.Context, value float64, attrs attribute.Set)
+}
+
+// MetricRegistry holds the instrument for each declared client metric. It's
+// filled at startup and only read afterwards.
+type MetricRegistry struct {
+	instruments map[string]*clientInstrument
+}
+
+// clientMetrics is the registry for browser-reported metrics, created at startup
+var clientMetrics *MetricRegistry
+
+// NewMetricRegistry creates an instrument with meter for every metric in clientMetricSpecs
+func NewMetricRegistry(meter metric.Meter) (*MetricRegistry, error) {
+	r := &MetricRegistry{instruments: make(map[string]*clientInstrument, len(clientMetricSpecs))}
+	for name, spec := range clientMetricSpecs {
+		inst, err := newClientInstrument(meter, clientMetricPrefix+name, spec)
+		if err != nil {
+			return nil, fmt.Errorf("client metric %q: %w", name, err)
+		}
+		r.instruments[name] = inst
+	}
+	return r, nil
+}
+
+// newClientInstrument creates the instrument for a client metric's type
+func newClientInstrument(meter metric.Meter, name string, spec clientMetricSpec) (*clientInstrument, error) {
+	description := "Reported by the browser client"
+	inst := &clientInstrument{clientMetricSpec: spec}
+	switch spec.metricType {
+	case clientCounter:
+		counter, err := meter.Float64Counter(name, metric.WithUnit(spec.unit), metric.WithDescription(description))
+		if err != nil {
+			return nil, err
+		}
+		inst.record = func(ctx context.Context, value float64, attrs attribute.Set) {
+			counter.Add(ctx, value, metric.WithAttributeSet(attrs))
+		}
+	case clientUpDownCounter:
+		counter, err := meter.Float64UpDownCounter(name, metric.WithUnit(spec.unit), metric.WithDescription(description))
+		if err != nil {
+			return nil, err
+		}
+		inst.record = func(ctx context.Context, value float64, attrs attribute.Set) {
+			counter.Add(ctx, value, metric.WithAttributeSet(attrs))
+		}
+	case clientGauge:
+		gauge, err := meter.Float64Gauge(name, metric.WithUnit(spec.unit), metric.WithDescription(description))
+		if err != nil {
+			return nil, err
+		}
+		inst.record = func(ctx context.Context, value float64, attrs attribute.Set) {
+			gauge.Record(ctx, value, metric.WithAttributeSet(attrs))
+		}
+	case clientHistogram:
+		histogram, err := meter.Float64Histogram(name, metric.WithUnit(spec.unit), metric.WithDescription(description))
+		if err != nil {
+			return nil, err
+		}
+		inst.record = func(ctx context.Context, value float64, attrs attribute.Set) {
+			histogram.Record(ctx, value, metric.WithAttributeSet(attrs))
+		}
+	default:
+		return nil, fmt.Errorf("unknown metric type %q", spec.metricType)
+	}
+	return inst, nil
+}
+
+// Check validates a client metric against its declaration. It changes nothing,
+// so a rejected report leaves no trace.
+func (r *MetricRegistry) Check(clientMetric telemetry.ClientMetric) error {
+	inst, ok := r.instruments[clientMetric.Name]
+	if !ok {
+		return fmt.Errorf("unknown metric %.64q", clientMetric.Name)
+	}
+	if inst.metricType != clientMetric.Type || inst.unit != clientMetric.Unit {
+		return fmt.Errorf("metric %q is a %s in %q, not a %.32s in %.32q",
+			clientMetric.Name, inst.metricType, inst.unit, clientMetric.Type, clientMetric.Unit)
+	}
+	if inst.metricType == clientCounter && clientMetric.Value < 0 {
+		return fmt.Errorf("counter %q can't decrease", clientMetric.Name)
+	}
+	return nil
+}
+
+// Record adds a checked client metric's value to its instrument, with the
+// labels the attribute policy allows as attributes
+func (r *MetricRegistry) Record(ctx context.Context, clientMetric telemetry.ClientMetric) {
+	if inst, ok := r.instruments[clientMetric.Name]; ok {
+		inst.record(ctx, clientMetric.Value, attributePolicy.MetricAttributes(ctx, clientMetricAttributes(clientMetric.Labels)...))
+	}
+}
+
+// clientMetricAttributes converts a metric's labels to attributes. Whole
+// numbers, which JSON decodes as floats, become integers.
+func clientMetricAttributes(labels map[string]interface{}) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(labels))
+	for key, value := range labels {
+		switch v := value.(type) {
+		case string:
+			kvs = append(kvs, attribute.String(key, v))
+		case bool:
+			kvs = append(kvs, attribute.Bool(key, v))
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				kvs = append(kvs, attribute.Int64(key, int64(v)))
+			} else {
+				kvs = append(kvs, attribute.Float64(key, v))
+			}
+		}
+	}
+	return kvs
+}
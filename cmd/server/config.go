@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the server's configuration. Each setting comes from the first of:
+// a command-line flag, an environment variable, the config file, and the default.
+type Config struct {
+	ListenAddr      string          `yaml:"listen_addr"`
+	AssetDir        string          `yaml:"asset_dir"`       // Serve index.html, static/ etc. from here instead of the embedded copy
+	DataDir         string          `yaml:"data_dir"`        // Persistent game data such as the leaderboard
+	AllowedOrigins  []string        `yaml:"allowed_origins"` // CORS origins, or "*" for any
+	TLSCert         string          `yaml:"tls_cert"`
+	TLSKey          string          `yaml:"tls_key"`
+	ServiceName     string          `yaml:"service_name"`     // OpenTelemetry service name; empty uses OTEL_SERVICE_NAME
+	ShutdownTimeout time.Duration   `yaml:"shutdown_timeout"` // How long to drain connections on SIGTERM
+	Telemetry       TelemetryConfig `yaml:"telemetry"`
+	Features        FeatureConfig   `yaml:"features"`
+}
+
+// TelemetryConfig limits what browsers can send to the telemetry endpoints
+type TelemetryConfig struct {
+	MaxBodyBytes     int64   `yaml:"max_body_bytes"`      // Largest telemetry request body
+	MaxEventDataSize int     `yaml:"max_event_data_size"` // Client event data longer than this is truncated
+	MaxAttributes    int     `yaml:"max_attributes"`      // Most attributes or labels on one event or metric
+	MaxBatchItems    int     `yaml:"max_batch_items"`     // Most events, metrics and spans in one batch
+	RateLimit        float64 `yaml:"rate_limit"`          // Requests per second per client IP
+	RateBurst        int     `yaml:"rate_burst"`
+	SessionRateLimit float64 `yaml:"session_rate_limit"` // Requests per second per browser session
+	SessionRateBurst int     `yaml:"session_rate_burst"`
+
+	Attributes AttributePolicyConfig `yaml:"attributes"`
+}
+
+// AttributePolicyConfig says which attributes may go on metrics derived from
+// client telemetry. Attributes not listed are left off metrics.
+type AttributePolicyConfig struct {
+	Metric    []string             `yaml:"metric"`     // Kept as is
+	TraceOnly []string             `yaml:"trace_only"` // Only on spans and logs
+	Hashed    []string             `yaml:"hashed"`     // Kept as a short hash of the value
+	Bucketed  map[string][]float64 `yaml:"bucketed"`   // Numbers kept as the range between ascending bounds
+	MaxValues int                  `yaml:"max_values"` // Distinct values per attribute; later ones are recorded as "other"
+}
+
+// FeatureConfig turns parts of the game's API on or off
+type FeatureConfig struct {
+	Leaderboard bool `yaml:"leaderboard"` // Score submission and the leaderboard
+	Daily       bool `yaml:"daily"`       // Daily challenge
+	ServerPlay  bool `yaml:"server_play"` // Games played on the server over WebSockets
+	Spectating  bool `yaml:"spectating"`  // Live games and the lobby
+	Rooms       bool `yaml:"rooms"`       // Multiplayer race rooms
+}
+
+// defaultServiceName is the service name when neither service_name nor
+// OTEL_SERVICE_NAME sets one
+const defaultServiceName = "incident-commander-server"
+
+// OTelServiceName returns the service name to export telemetry under: an
+// explicit service_name, then OTEL_SERVICE_NAME, then defaultServiceName
+func (c *Config) OTelServiceName(getenv func(string) string) string {
+	if c.ServiceName != "" {
+		return c.ServiceName
+	}
+	if name := getenv("OTEL_SERVICE_NAME"); name != "" {
+		return name
+	}
+	return defaultServiceName
+}
+
+// defaultConfig returns the settings used when nothing else sets them
+func defaultConfig() Config {
+	return Config{
+		ListenAddr:      ":8080",
+		DataDir:         "data",
+		AllowedOrigins:  []string{"*"},
+		ShutdownTimeout: 15 * time.Second,
+		Telemetry: TelemetryConfig{
+			MaxBodyBytes:     64 << 10,
+			MaxEventDataSize: 1024,
+			MaxAttributes:    32,
+			MaxBatchItems:    100,
+			RateLimit:        50,
+			RateBurst:        100,
+			SessionRateLimit: 20,
+			SessionRateBurst: 40,
+			Attributes: AttributePolicyConfig{
+				Metric:    []string{"event_type", "metric_type", "level", "mode", "difficulty", "source", "asset", "cached"},
+				TraceOnly: []string{"session_id", "correlation_id", "player_id"},
+				MaxValues: 100,
+			},
+		},
+		Features: FeatureConfig{
+			Leaderboard: true,
+			Daily:       true,
+			ServerPlay:  true,
+			Spectating:  true,
+			Rooms:       true,
+		},
+	}
+}
+
+// configEnvPrefix starts every environment variable the server reads
+const configEnvPrefix = "IC_"
+
+// setting is one configuration value that can also be set with a flag and an
+// environment variable. The flag is the file key with dashes, and the
+// environment variable is the key in upper case after the prefix.
+type setting struct {
+	key   string // Key in the config file, with a dot for nested keys
+	usage string
+	parse func(c *Config, value string) error
+}
+
+// settings lists every configurable value
+var settings = []setting{
+	{"listen_addr", "address to listen on, e.g. :8080", stringSetting(func(c *Config) *string { return &c.ListenAddr })},
+	{"asset_dir", "serve the game from this directory instead of the embedded copy, e.g. web", stringSetting(func(c *Config) *string { return &c.AssetDir })},
+	{"data_dir", "directory for persistent game data", stringSetting(func(c *Config) *string { return &c.DataDir })},
+	{"allowed_origins", "comma-separated CORS origins, or * for any", listSetting(func(c *Config) *[]string { return &c.AllowedOrigins })},
+	{"tls_cert", "TLS certificate file; serves HTTPS with tls_key", stringSetting(func(c *Config) *string { return &c.TLSCert })},
+	{"tls_key", "TLS private key file", stringSetting(func(c *Config) *string { return &c.TLSKey })},
+	{"service_name", "OpenTelemetry service name; takes precedence over OTEL_SERVICE_NAME, which is used if this is unset, then " + defaultServiceName, stringSetting(func(c *Config) *string { return &c.ServiceName })},
+	{"shutdown_timeout", "how long to drain connections before exiting, e.g. 15s", func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		c.ShutdownTimeout = d
+		return err
+	}},
+	{"telemetry.max_body_bytes", "largest client telemetry request in bytes", func(c *Config, value string) error {
+		n, err := strconv.ParseInt(value, 10, 64)
+		c.Telemetry.MaxBodyBytes = n
+		return err
+	}},
+	{"telemetry.max_event_data_size", "client event data is truncated to this many bytes", intSetting(func(c *Config) *int { return &c.Telemetry.MaxEventDataSize })},
+	{"telemetry.max_attributes", "most attributes or labels on one client event or metric", intSetting(func(c *Config) *int { return &c.Telemetry.MaxAttributes })},
+	{"telemetry.max_batch_items", "most events, metrics and spans in one client telemetry batch", intSetting(func(c *Config) *int { return &c.Telemetry.MaxBatchItems })},
+	{"telemetry.rate_limit", "client telemetry requests per second per IP", floatSetting(func(c *Config) *float64 { return &c.Telemetry.RateLimit })},
+	{"telemetry.rate_burst", "client telemetry burst per IP", intSetting(func(c *Config) *int { return &c.Telemetry.RateBurst })},
+	{"telemetry.session_rate_limit", "client telemetry requests per second per browser session", floatSetting(func(c *Config) *float64 { return &c.Telemetry.SessionRateLimit })},
+	{"telemetry.session_rate_burst", "client telemetry burst per browser session", intSetting(func(c *Config) *int { return &c.Telemetry.SessionRateBurst })},
+	{"telemetry.attributes.metric", "comma-separated attributes allowed on client telemetry metrics", listSetting(func(c *Config) *[]string { return &c.Telemetry.Attributes.Metric })},
+	{"telemetry.attributes.trace_only", "comma-separated attributes kept only on spans and logs", listSetting(func(c *Config) *[]string { return &c.Telemetry.Attributes.TraceOnly })},
+	{"telemetry.attributes.hashed", "comma-separated attributes put on metrics as a hash", listSetting(func(c *Config) *[]string { return &c.Telemetry.Attributes.Hashed })},
+	{"telemetry.attributes.bucketed", "numeric attributes put on metrics as ranges, e.g. level=5,10;score=100,1000", func(c *Config, value string) error {
+		c.Telemetry.Attributes.Bucketed = make(map[string][]float64)
+		for _, entry := range strings.Split(value, ";") {
+			if strings.TrimSpace(entry) == "" {
+				continue
+			}
+			key, list, ok := strings.Cut(entry, "=")
+			if !ok {
+				return fmt.Errorf("%q has no bounds", entry)
+			}
+			var bounds []float64
+			for _, bound := range strings.Split(list, ",") {
+				f, err := strconv.ParseFloat(strings.TrimSpace(bound), 64)
+				if err != nil {
+					return err
+				}
+				bounds = append(bounds, f)
+			}
+			c.Telemetry.Attributes.Bucketed[strings.TrimSpace(key)] = bounds
+		}
+		return nil
+	}},
+	{"telemetry.attributes.max_values", "distinct values per metric attribute before the rest become other", intSetting(func(c *Config) *int { return &c.Telemetry.Attributes.MaxValues })},
+	{"features.leaderboard", "enable the leaderboard", boolSetting(func(c *Config) *bool { return &c.Features.Leaderboard })},
+	{"features.daily", "enable the daily challenge", boolSetting(func(c *Config) *bool { return &c.Features.Daily })},
+	{"features.server_play", "enable games played on the server", boolSetting(func(c *Config) *bool { return &c.Features.ServerPlay })},
+	{"features.spectating", "enable spectating live games", boolSetting(func(c *Config) *bool { return &c.Features.Spectating })},
+	{"features.rooms", "enable multiplayer race rooms", boolSetting(func(c *Config) *bool { return &c.Features.Rooms })},
+}
+
+// stringSetting parses a string setting
+func stringSetting(field func(c *Config) *string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+// listSetting parses a comma-separated list setting, ignoring empty entries
+func listSetting(field func(c *Config) *[]string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		list := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}
+}
+
+// intSetting parses a whole number setting
+func intSetting(field func(c *Config) *int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		*field(c) = n
+		return err
+	}
+}
+
+// floatSetting parses a decimal number setting
+func floatSetting(field func(c *Config) *float64) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		f, err := strconv.ParseFloat(value, 64)
+		*field(c) = f
+		return err
+	}
+}
+
+// boolSetting parses a true/false setting
+func boolSetting(field func(c *Config) *bool) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		*field(c) = b
+		return err
+	}
+}
+
+// flagName returns the command-line flag for a setting
+func (s setting) flagName() string {
+	return strings.NewReplacer("_", "-", ".", "-").Replace(s.key)
+}
+
+// envName returns the environment variable for a setting
+func (s setting) envName() string {
+	return configEnvPrefix + strings.ToUpper(strings.ReplaceAll(s.key, ".", "_"))
+}
+
+// LoadConfig reads the configuration from the command-line arguments, the
+// environment, and the config file named by -config or IC_CONFIG, and checks it
+func LoadConfig(args []string, getenv func(string) string) (Config, error) {
+	fs := flag.NewFlagSet("incident-commander-server", flag.ContinueOnError)
+	configPath := fs.String("config", getenv(configEnvPrefix+"CONFIG"), "YAML or JSON config file (env "+configEnvPrefix+"CONFIG)")
+	flagValues := make(map[string]string)
+	for _, s := range settings {
+		fs.Func(s.flagName(), s.usage+" (env "+s.envName()+")", func(value string) error {
+			flagValues[s.key] = value
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	cfg := defaultConfig()
+	if *configPath != "" {
+		if err := loadConfigFile(&cfg, *configPath); err != nil {
+			return Config{}, err
+		}
+	}
+
+	// Environment variables override the file, and flags override both
+	var errs []error
+	for _, s := range settings {
+		if value := getenv(s.envName()); value != "" {
+			if err := s.parse(&cfg, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid value %q", s.envName(), value))
+			}
+		}
+	}
+	for _, s := range settings {
+		if value, ok := flagValues[s.key]; ok {
+			if err := s.parse(&cfg, value); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: invalid value %q", s.flagName(), value))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return Config{}, errors.Join(errs...)
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// loadConfigFile reads a YAML or JSON config file over the defaults.
+// Unknown keys are an error so typos don't go unnoticed.
+func loadConfigFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks every setting and reports all the problems at once
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if _, port, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		fail("listen_addr", "%q is not a host:port address", c.ListenAddr)
+	} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		fail("listen_addr", "port %q is not a number from 0 to 65535", port)
+	}
+
+	if c.AssetDir != "" {
+		if info, err := os.Stat(filepath.Join(c.AssetDir, "index.html")); err != nil || info.IsDir() {
+			fail("asset_dir", "%q has no index.html", c.AssetDir)
+		}
+	}
+	if c.DataDir == "" {
+		fail("data_dir", "must not be empty")
+	}
+
+	if len(c.AllowedOrigins) == 0 {
+		fail("allowed_origins", "must list at least one origin, or * for any")
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			fail("allowed_origins", "%q is not an origin like https://example.com", origin)
+		}
+	}
+
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		fail("tls_cert", "tls_cert and tls_key must be set together")
+	}
+	for key, path := range map[string]string{"tls_cert": c.TLSCert, "tls_key": c.TLSKey} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			fail(key, "can't read %q", path)
+		}
+	}
+
+	if c.ServiceName != "" && strings.TrimSpace(c.ServiceName) == "" {
+		fail("service_name", "must not be blank")
+	}
+	if c.ShutdownTimeout < time.Second || c.ShutdownTimeout > 5*time.Minute {
+		fail("shutdown_timeout", "%s is outside 1s to 5m", c.ShutdownTimeout)
+	}
+	if c.Telemetry.MaxBodyBytes < 1<<10 || c.Telemetry.MaxBodyBytes > 10<<20 {
+		fail("telemetry.max_body_bytes", "%d is outside 1024 to 10485760", c.Telemetry.MaxBodyBytes)
+	}
+	if c.Telemetry.MaxEventDataSize < 0 || c.Telemetry.MaxEventDataSize > 64<<10 {
+		fail("telemetry.max_event_data_size", "%d is outside 0 to 65536", c.Telemetry.MaxEventDataSize)
+	}
+	if c.Telemetry.MaxAttributes < 0 || c.Telemetry.MaxAttributes > 256 {
+		fail("telemetry.max_attributes", "%d is outside 0 to 256", c.Telemetry.MaxAttributes)
+	}
+	if c.Telemetry.MaxBatchItems < 1 || c.Telemetry.MaxBatchItems > 1000 {
+		fail("telemetry.max_batch_items", "%d is outside 1 to 1000", c.Telemetry.MaxBatchItems)
+	}
+	for key, limit := range map[string]float64{"telemetry.rate_limit": c.Telemetry.RateLimit, "telemetry.session_rate_limit": c.Telemetry.SessionRateLimit} {
+		if limit <= 0 || math.IsInf(limit, 0) || math.IsNaN(limit) {
+			fail(key, "%v must be a positive number of requests per second", limit)
+		}
+	}
+	for key, burst := range map[string]int{"telemetry.rate_burst": c.Telemetry.RateBurst, "telemetry.session_rate_burst": c.Telemetry.SessionRateBurst} {
+		if burst < 1 {
+			fail(key, "%d must be at least 1", burst)
+		}
+	}
+	c.validateAttributePolicy(fail)
+
+	return errors.Join(errs...)
+}
+
+// validateAttributePolicy checks that each attribute has one rule and that
+// bucket bounds ascend
+func (c *Config) validateAttributePolicy(fail func(key, format string, args ...any)) {
+	policy := c.Telemetry.Attributes
+	listed := make(map[string]string)
+	check := func(key string, attrs []string) {
+		for _, attr := range attrs {
+			if other, ok := listed[attr]; ok {
+				fail(key, "%q is already listed in %s", attr, other)
+			}
+			listed[attr] = key
+		}
+	}
+	check("telemetry.attributes.metric", policy.Metric)
+	check("telemetry.attributes.trace_only", policy.TraceOnly)
+	check("telemetry.attributes.hashed", policy.Hashed)
+
+	for attr, bounds := range policy.Bucketed {
+		check("telemetry.attributes.bucketed", []string{attr})
+		if len(bounds) == 0 {
+			fail("telemetry.attributes.bucketed", "%q has no bounds", attr)
+		}
+		for i := 1; i < len(bounds); i++ {
+			if bounds[i] <= bounds[i-1] {
+				fail("telemetry.attributes.bucketed", "%q bounds must ascend", attr)
+				break
+			}
+		}
+	}
+	if policy.MaxValues < 1 || policy.MaxValues > 10000 {
+		fail("telemetry.attributes.max_values", "%d is outside 1 to 10000", policy.MaxValues)
+	}
+}
+
+// TLS reports whether the server serves HTTPS
+func (c *Config) TLS() bool {
+	return c.TLSCert != ""
+}
+
+// AllowsOrigin reports whether a browser origin may call the API
+func (c *Config) AllowsOrigin(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// OriginHosts returns the allowed origins' hosts as WebSocket origin patterns
+func (c *Config) OriginHosts() []string {
+	hosts := make([]string, 0, len(c.AllowedOrigins))
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			return []string{"*"}
+		}
+		if u, err := url.Parse(origin); err == nil {
+			hosts = append(hosts, u.Host)
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file to a temporary directory and returns its path
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// envFunc returns a getenv that reads from a map
+func envFunc(env map[string]string) func(string) string {
+	return func(key string) string { return env[key] }
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	file := writeConfig(t, "listen_addr: \":7000\"\ndata_dir: from-file\ntelemetry:\n  rate_limit: 5\n")
+
+	tests := []struct {
+		name       string
+		args       []string
+		env        map[string]string
+		wantAddr   string
+		wantData   string
+		wantRate   float64
+		wantOrigin []string
+	}{
+		{
+			name:       "defaults",
+			wantAddr:   ":8080",
+			wantData:   "data",
+			wantRate:   50,
+			wantOrigin: []string{"*"},
+		},
+		{
+			name:       "file over defaults",
+			args:       []string{"-config", file},
+			wantAddr:   ":7000",
+			wantData:   "from-file",
+			wantRate:   5,
+			wantOrigin: []string{"*"},
+		},
+		{
+			name:       "config file from the environment",
+			env:        map[string]string{"IC_CONFIG": file},
+			wantAddr:   ":7000",
+			wantData:   "from-file",
+			wantRate:   5,
+			wantOrigin: []string{"*"},
+		},
+		{
+			name:       "environment over the file",
+			args:       []string{"-config", file},
+			env:        map[string]string{"IC_LISTEN_ADDR": ":7001", "IC_TELEMETRY_RATE_LIMIT": "7.5", "IC_ALLOWED_ORIGINS": "https://a.example, https://b.example"},
+			wantAddr:   ":7001",
+			wantData:   "from-file",
+			wantRate:   7.5,
+			wantOrigin: []string{"https://a.example", "https://b.example"},
+		},
+		{
+			name:       "flags over the environment",
+			args:       []string{"-config", file, "-listen-addr", ":7002", "-telemetry-rate-limit", "9"},
+			env:        map[string]string{"IC_LISTEN_ADDR": ":7001", "IC_TELEMETRY_RATE_LIMIT": "7.5", "IC_DATA_DIR": "from-env"},
+			wantAddr:   ":7002",
+			wantData:   "from-env",
+			wantRate:   9,
+			wantOrigin: []string{"*"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadConfig(tt.args, envFunc(tt.env))
+			if err != nil {
+				t.Fatalf("LoadConfig() = %v", err)
+			}
+			if cfg.ListenAddr != tt.wantAddr || cfg.DataDir != tt.wantData || cfg.Telemetry.RateLimit != tt.wantRate {
+				t.Errorf("got listen_addr %q, data_dir %q, rate_limit %v; want %q, %q, %v",
+					cfg.ListenAddr, cfg.DataDir, cfg.Telemetry.RateLimit, tt.wantAddr, tt.wantData, tt.wantRate)
+			}
+			if !slices.Equal(cfg.AllowedOrigins, tt.wantOrigin) {
+				t.Errorf("allowed_origins = %v, want %v", cfg.AllowedOrigins, tt.wantOrigin)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := writeConfig(t, `
+service_name: incident-commander-staging
+shutdown_timeout: 30s
+allowed_origins:
+  - https://game.example.com
+telemetry:
+  max_batch_items: 50
+  attributes:
+    metric: [event_type, level]
+    hashed: [asset_url]
+    bucketed:
+      score: [100, 1000, 10000]
+features:
+  rooms: false
+`)
+	cfg, err := LoadConfig([]string{"-config", path}, envFunc(nil))
+	if err != nil {
+		t.Fatalf("LoadConfig() = %v", err)
+	}
+
+	if cfg.ServiceName != "incident-commander-staging" || cfg.ShutdownTimeout != 30*time.Second {
+		t.Errorf("service_name %q, shutdown_timeout %s", cfg.ServiceName, cfg.ShutdownTimeout)
+	}
+	if !slices.Equal(cfg.AllowedOrigins, []string{"https://game.example.com"}) {
+		t.Errorf("allowed_origins = %v", cfg.AllowedOrigins)
+	}
+	policy := cfg.Telemetry.Attributes
+	if cfg.Telemetry.MaxBatchItems != 50 || !slices.Equal(policy.Metric, []string{"event_type", "level"}) ||
+		!slices.Equal(policy.Hashed, []string{"asset_url"}) || !slices.Equal(policy.Bucketed["score"], []float64{100, 1000, 10000}) {
+		t.Errorf("telemetry = %+v", cfg.Telemetry)
+	}
+	// Keys the file leaves out keep their defaults
+	if cfg.Features.Rooms || !cfg.Features.Leaderboard || cfg.Telemetry.RateBurst != 100 {
+		t.Errorf("features = %+v, rate_burst %d", cfg.Features, cfg.Telemetry.RateBurst)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		args    []string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "unknown file key", file: "listen_adr: \":8080\"\n", wantErr: "listen_adr"},
+		{name: "bad YAML", file: "listen_addr: [\n", wantErr: "config file"},
+		{name: "missing file", args: []string{"-config", "/no/such/config.yaml"}, wantErr: "config file"},
+		{name: "bad env number", env: map[string]string{"IC_TELEMETRY_RATE_BURST": "lots"}, wantErr: "IC_TELEMETRY_RATE_BURST"},
+		{name: "bad flag duration", args: []string{"-shutdown-timeout", "soon"}, wantErr: "-shutdown-timeout"},
+		{name: "unknown flag", args: []string{"-no-such-flag", "1"}, wantErr: "no-such-flag"},
+		{name: "validation", args: []string{"-listen-addr", "8080"}, wantErr: "listen_addr"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeConfig(t, tt.file)}, args...)
+			}
+			_, err := LoadConfig(args, envFunc(tt.env))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadConfig() = %v, want an error mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr string // Empty if the config is valid
+	}{
+		{"defaults", func(c *Config) {}, ""},
+		{"no port", func(c *Config) { c.ListenAddr = "localhost" }, "listen_addr"},
+		{"port out of range", func(c *Config) { c.ListenAddr = ":70000" }, "listen_addr"},
+		{"asset dir without index.html", func(c *Config) { c.AssetDir = os.TempDir() }, "asset_dir"},
+		{"asset dir", func(c *Config) { c.AssetDir = "../../web" }, ""},
+		{"empty data dir", func(c *Config) { c.DataDir = "" }, "data_dir"},
+		{"no origins", func(c *Config) { c.AllowedOrigins = nil }, "allowed_origins"},
+		{"origin with a path", func(c *Config) { c.AllowedOrigins = []string{"https://example.com/game"} }, "allowed_origins"},
+		{"origin without a scheme", func(c *Config) { c.AllowedOrigins = []string{"example.com"} }, "allowed_origins"},
+		{"TLS cert without a key", func(c *Config) { c.TLSCert = "cert.pem" }, "tls_cert"},
+		{"blank service name", func(c *Config) { c.ServiceName = "  " }, "service_name"},
+		{"short shutdown timeout", func(c *Config) { c.ShutdownTimeout = time.Millisecond }, "shutdown_timeout"},
+		{"tiny body limit", func(c *Config) { c.Telemetry.MaxBodyBytes = 10 }, "telemetry.max_body_bytes"},
+		{"no batch items", func(c *Config) { c.Telemetry.MaxBatchItems = 0 }, "telemetry.max_batch_items"},
+		{"zero rate limit", func(c *Config) { c.Telemetry.SessionRateLimit = 0 }, "telemetry.session_rate_limit"},
+		{"zero burst", func(c *Config) { c.Telemetry.RateBurst = 0 }, "telemetry.rate_burst"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			tt.modify(&cfg)
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want valid", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want an error about %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigValidateAttributePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(p *AttributePolicyConfig)
+		wantErr string
+	}{
+		{"defaults", func(p *AttributePolicyConfig) {}, ""},
+		{"hashed and bucketed", func(p *AttributePolicyConfig) {
+			p.Hashed = []string{"asset_url"}
+			p.Bucketed = map[string][]float64{"score": {100, 1000}}
+		}, ""},
+		{"listed twice", func(p *AttributePolicyConfig) { p.Hashed = []string{"player_id"} }, `"player_id" is already listed in telemetry.attributes.trace_only`},
+		{"bucketed and kept", func(p *AttributePolicyConfig) { p.Bucketed = map[string][]float64{"level": {5}} }, `"level" is already listed`},
+		{"no bounds", func(p *AttributePolicyConfig) { p.Bucketed = map[string][]float64{"score": nil} }, "has no bounds"},
+		{"bounds out of order", func(p *AttributePolicyConfig) { p.Bucketed = map[string][]float64{"score": {1000, 100}} }, "must ascend"},
+		{"repeated bound", func(p *AttributePolicyConfig) { p.Bucketed = map[string][]float64{"score": {100, 100}} }, "must ascend"},
+		{"no values", func(p *AttributePolicyConfig) { p.MaxValues = 0 }, "telemetry.attributes.max_values"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			tt.modify(&cfg.Telemetry.Attributes)
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want valid", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOTelServiceName(t *testing.T) {
+	tests := []struct {
+		name        string
+		serviceName string
+		env         map[string]string
+		want        string
+	}{
+		{"default", "", nil, defaultServiceName},
+		{"environment", "", map[string]string{"OTEL_SERVICE_NAME": "from-env"}, "from-env"},
+		{"explicit setting wins", "from-config", map[string]string{"OTEL_SERVICE_NAME": "from-env"}, "from-config"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			cfg.ServiceName = tt.serviceName
+			if got := cfg.OTelServiceName(envFunc(tt.env)); got != tt.want {
+				t.Errorf("OTelServiceName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
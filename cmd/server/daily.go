@@ -0,0 +1,326 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NathanNam/incident-commander-game/internal/game"
+	"github.com/NathanNam/incident-commander-game/internal/leaderboard"
+	"github.com/NathanNam/incident-commander-game/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// dailyModePrefix prefixes the leaderboard mode of a daily challenge, e.g. "daily:2025-01-31"
+const dailyModePrefix = "daily:"
+
+// dailyAttemptRetention is how many days of daily attempts are kept
+const dailyAttemptRetention = 7
+
+// Daily attempt errors, mapped to rejection reasons by recordDailySubmission
+var (
+	errDailyNotRanked     = errors.New("run is not the player's ranked attempt for the day")
+	errDailyRunFinished   = errors.New("ranked run has already finished")
+	errDailyReplayChanged = errors.New("replay doesn't continue the inputs already submitted")
+)
+
+// DailyAttempt is a player's ranked run on a daily challenge and what the
+// server has already accepted from it. Later submissions of the run must
+// extend the accepted inputs, so a player can't practise and resubmit.
+type DailyAttempt struct {
+	RunID      string `json:"run_id"`
+	InputsHash string `json:"inputs_hash,omitempty"` // Hash of the accepted inputs
+	Inputs     int    `json:"inputs,omitempty"`      // Number of accepted inputs
+	Finished   bool   `json:"finished,omitempty"`    // The run ended with no rollbacks left
+}
+
+// UnmarshalJSON also reads the run ID strings stored before attempts kept their inputs
+func (a *DailyAttempt) UnmarshalJSON(data []byte) error {
+	var runID string
+	if err := json.Unmarshal(data, &runID); err == nil {
+		*a = DailyAttempt{RunID: runID}
+		return nil
+	}
+	type attempt DailyAttempt
+	return json.Unmarshal(data, (*attempt)(a))
+}
+
+// DailyAttemptStore remembers each player's one ranked run per daily challenge
+type DailyAttemptStore struct {
+	mu       sync.Mutex
+	path     string
+	attempts map[string]map[string]*DailyAttempt // date -> player ID -> attempt
+}
+
+// NewDailyAttemptStore loads the store from path, starting empty if the file doesn't exist
+func NewDailyAttemptStore(path string) (*DailyAttemptStore, error) {
+	s := &DailyAttemptStore{
+		path:     path,
+		attempts: make(map[string]map[string]*DailyAttempt),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.attempts); err != nil {
+		return nil, fmt.Errorf("corrupt daily attempt store %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Start registers a player's ranked run for a date. Returns false if the
+// player already started a different run that day.
+func (s *DailyAttemptStore) Start(date, playerID, runID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	players, ok := s.attempts[date]
+	if !ok {
+		players = make(map[string]*DailyAttempt)
+		s.attempts[date] = players
+	}
+	if existing, started := players[playerID]; started {
+		return existing.RunID == runID, nil
+	}
+	players[playerID] = &DailyAttempt{RunID: runID}
+
+	// Attempts for old challenges can't be submitted anymore
+	cutoff := time.Now().UTC().AddDate(0, 0, -dailyAttemptRetention).Format(game.DailyDateFormat)
+	for day := range s.attempts {
+		if day < cutoff {
+			delete(s.attempts, day)
+		}
+	}
+
+	return true, s.save()
+}
+
+// Accept records a verified submission of a player's ranked run. The inputs
+// must extend those accepted before, and nothing is accepted once the run
+// has finished.
+func (s *DailyAttemptStore) Accept(date, playerID, runID string, inputs []game.Input, finished bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt := s.attempts[date][playerID]
+	switch {
+	case attempt == nil || attempt.RunID != runID:
+		return errDailyNotRanked
+	case attempt.Finished:
+		return errDailyRunFinished
+	case attempt.InputsHash != "" && (len(inputs) < attempt.Inputs || inputsHash(inputs[:attempt.Inputs]) != attempt.InputsHash):
+		return errDailyReplayChanged
+	}
+
+	previous := *attempt
+	attempt.InputsHash = inputsHash(inputs)
+	attempt.Inputs = len(inputs)
+	attempt.Finished = finished
+	if err := s.save(); err != nil {
+		*attempt = previous
+		return err
+	}
+	return nil
+}
+
+// RankedRun returns the run a player registered for a date, or ""
+func (s *DailyAttemptStore) RankedRun(date, playerID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if attempt := s.attempts[date][playerID]; attempt != nil {
+		return attempt.RunID
+	}
+	return ""
+}
+
+// save writes the store atomically via a temporary file
+func (s *DailyAttemptStore) save() error {
+	data, err := json.Marshal(s.attempts)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// inputsHash identifies a sequence of replay inputs
+func inputsHash(inputs []game.Input) string {
+	h := sha256.New()
+	for _, input := range inputs {
+		fmt.Fprintf(h, "%d %s\n", input.Tick, input.Action)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// dailyOpen checks if scores can still be submitted for a date. Yesterday's
+// challenge stays open so runs that cross midnight UTC still count.
+func dailyOpen(date string, now time.Time) bool {
+	today := now.UTC().Format(game.DailyDateFormat)
+	yesterday := now.UTC().AddDate(0, 0, -1).Format(game.DailyDateFormat)
+	return date == today || date == yesterday
+}
+
+// checkDailySubmission checks that a daily challenge score is the player's
+// ranked attempt on that day's board. Returns a rejection reason on failure.
+func checkDailySubmission(sub *leaderboard.Submission) (string, error) {
+	challenge, err := game.ParseDailyDate(strings.TrimPrefix(sub.Mode, dailyModePrefix), serverSecret)
+	if err != nil {
+		return rejectUnverifiableMode, err
+	}
+	if !dailyOpen(challenge.Date, time.Now()) {
+		return rejectDailyClosed, fmt.Errorf("daily challenge %s is closed", challenge.Date)
+	}
+	if dailyAttemptStore.RankedRun(challenge.Date, sub.PlayerID) != sub.RunID {
+		return rejectDailyAttemptUsed, errDailyNotRanked
+	}
+	if sub.Replay.Seed != challenge.Seed || sub.Difficulty != challenge.Difficulty {
+		return rejectInvalidReplay, errors.New("replay doesn't match the daily challenge")
+	}
+	return "", nil
+}
+
+// recordDailySubmission locks a verified daily challenge run to the inputs
+// accepted so far. g is the simulated run. Returns a rejection reason on failure.
+func recordDailySubmission(sub *leaderboard.Submission, g *game.Game) (string, error) {
+	date := strings.TrimPrefix(sub.Mode, dailyModePrefix)
+	finished := !g.CanRollback()
+	err := dailyAttemptStore.Accept(date, sub.PlayerID, sub.RunID, sub.Replay.Inputs, finished)
+	switch {
+	case errors.Is(err, errDailyReplayChanged):
+		return rejectDailyReplayChanged, err
+	case errors.Is(err, errDailyNotRanked), errors.Is(err, errDailyRunFinished):
+		return rejectDailyAttemptUsed, err
+	}
+	return "", err
+}
+
+// dailyHandler returns the daily challenge for today or the requested date
+func dailyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tracer := telemetry.GetTracer()
+
+	_, span := tracer.Start(ctx, "get_daily_challenge")
+	defer span.End()
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := time.Now()
+	challenge := game.DailyChallengeFor(now, serverSecret)
+	if date := r.URL.Query().Get("date"); date != "" {
+		var err error
+		if challenge, err = game.ParseDailyDate(date, serverSecret); err != nil {
+			span.SetStatus(codes.Error, "Invalid date")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Future boards stay hidden until their day, so nobody can practise them
+		if challenge.Date > now.UTC().Format(game.DailyDateFormat) {
+			span.SetStatus(codes.Error, "Future date")
+			http.Error(w, fmt.Sprintf("daily challenge %s hasn't started", challenge.Date), http.StatusBadRequest)
+			return
+		}
+	}
+
+	span.SetAttributes(
+		attribute.String("daily.date", challenge.Date),
+		attribute.String("daily.difficulty", challenge.Difficulty),
+		attribute.StringSlice("daily.modifiers", challenge.Modifiers),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(challenge)
+}
+
+// DailyAttemptRequest registers the run a player is about to play on today's challenge
+type DailyAttemptRequest struct {
+	PlayerID string `json:"player_id"`
+	RunID    string `json:"run_id"`
+}
+
+// DailyAttemptResponse tells the client whether the run counts for the daily leaderboard
+type DailyAttemptResponse struct {
+	Date   string `json:"date"`
+	Ranked bool   `json:"ranked"`
+}
+
+// dailyAttemptHandler locks in a player's one ranked attempt on today's challenge
+func dailyAttemptHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := telemetry.GetLogger()
+	tracer := telemetry.GetTracer()
+
+	ctx, span := tracer.Start(ctx, "start_daily_attempt")
+	defer span.End()
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4096))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to read request body")
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	var req DailyAttemptRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to unmarshal daily attempt")
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if !playerIDPattern.MatchString(req.PlayerID) || !playerIDPattern.MatchString(req.RunID) {
+		span.SetStatus(codes.Error, "Invalid player or run ID")
+		http.Error(w, "Invalid player or run ID", http.StatusBadRequest)
+		return
+	}
+	if !authorizePlayer(w, r, req.PlayerID) {
+		span.SetStatus(codes.Error, "Invalid player token")
+		return
+	}
+
+	date := time.Now().UTC().Format(game.DailyDateFormat)
+	ranked, err := dailyAttemptStore.Start(date, req.PlayerID, req.RunID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to save daily attempt")
+		logger.ErrorContext(ctx, "Failed to save daily attempt", "error", err, "player_id", req.PlayerID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("player.id", req.PlayerID),
+		attribute.String("daily.date", date),
+		attribute.Bool("daily.ranked", ranked),
+	)
+	logger.InfoContext(ctx, "Daily attempt started", "player_id", req.PlayerID, "date", date, "ranked", ranked)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DailyAttemptResponse{Date: date, Ranked: ranked})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NathanNam/incident-commander-game/internal/game"
+)
+
+func TestDailyAttemptAccept(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "daily_attempts.json")
+	s, err := NewDailyAttemptStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := time.Now().UTC().Format(game.DailyDateFormat)
+	if ranked, err := s.Start(date, "player_a", "run_ranked"); err != nil || !ranked {
+		t.Fatalf("Start() = %v, %v; want ranked", ranked, err)
+	}
+
+	crashed := []game.Input{{Tick: 3, Action: game.ActionUp}, {Tick: 9, Action: game.ActionLeft}}
+	continued := append(append([]game.Input(nil), crashed...), game.Input{Tick: 12, Action: game.ActionRollback})
+	practised := []game.Input{{Tick: 4, Action: game.ActionUp}, {Tick: 9, Action: game.ActionLeft}, {Tick: 12, Action: game.ActionRollback}}
+
+	steps := []struct {
+		name     string
+		runID    string
+		inputs   []game.Input
+		finished bool
+		wantErr  error
+	}{
+		{"another run", "run_practice", crashed, true, errDailyNotRanked},
+		{"first submission", "run_ranked", crashed, false, nil},
+		{"same replay again", "run_ranked", crashed, false, nil},
+		{"different inputs", "run_ranked", practised, false, errDailyReplayChanged},
+		{"fewer inputs", "run_ranked", crashed[:1], false, errDailyReplayChanged},
+		{"continued after a rollback", "run_ranked", continued, true, nil},
+		{"after the run finished", "run_ranked", continued, true, errDailyRunFinished},
+	}
+	for _, step := range steps {
+		err := s.Accept(date, "player_a", step.runID, step.inputs, step.finished)
+		if !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: Accept() = %v, want %v", step.name, err, step.wantErr)
+		}
+	}
+
+	// The lock survives a restart
+	reloaded, err := NewDailyAttemptStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reloaded.Accept(date, "player_a", "run_ranked", continued, true); !errors.Is(err, errDailyRunFinished) {
+		t.Errorf("Accept() after reloading = %v, want %v", err, errDailyRunFinished)
+	}
+}
+
+func TestDailyAttemptStoreLegacyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "daily_attempts.json")
+	if err := os.WriteFile(path, []byte(`{"2026-10-18":{"player_a":"run_ranked"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewDailyAttemptStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run := s.RankedRun("2026-10-18", "player_a"); run != "run_ranked" {
+		t.Errorf("RankedRun() = %q, want run_ranked", run)
+	}
+	if err := s.Accept("2026-10-18", "player_a", "run_ranked", nil, false); err != nil {
+		t.Errorf("Accept() = %v", err)
+	}
+}
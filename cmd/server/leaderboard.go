@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NathanNam/incident-commander-game/internal/leaderboard"
+	"github.com/NathanNam/incident-commander-game/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ScoreResponse is returned after a score is submitted
+type ScoreResponse struct {
+	Status string `json:"status"`
+	Rank   int    `json:"rank"`
+}
+
+// Score submission limits. Each submission replays up to MaxReplayTicks and
+// syncs the leaderboard file.
+const (
+	maxSubmissionSize = 1 << 20 // Submissions carry the run's input log
+	scoreRateLimit    = 0.1     // Submissions per second per IP and per player
+	scoreRateBurst    = 5
+)
+
+// scoreLimiter rate limits score submissions, keyed by client IP and by player
+var scoreLimiter = NewRateLimiter(scoreRateLimit, scoreRateBurst)
+
+// submitScoreHandler verifies a finished (or rolled back) run by replaying it
+// and records it on the leaderboard
+func submitScoreHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := telemetry.GetLogger()
+	tracer := telemetry.GetTracer()
+
+	ctx, span := tracer.Start(ctx, "submit_score")
+	defer span.End()
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !allowRequest(w, scoreLimiter, "ip:"+clientIP(r)) {
+		span.SetStatus(codes.Error, "Rate limited")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSubmissionSize))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to read request body")
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	var sub leaderboard.Submission
+	if err := json.Unmarshal(body, &sub); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to unmarshal score")
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if !authorizePlayer(w, r, sub.PlayerID) {
+		span.SetStatus(codes.Error, "Invalid player token")
+		return
+	}
+	if !allowRequest(w, scoreLimiter, "player:"+sub.PlayerID) {
+		span.SetStatus(codes.Error, "Rate limited")
+		return
+	}
+	entry := sub.Entry
+	entry.CreatedAt = time.Now().UTC()
+
+	span.SetAttributes(
+		attribute.String("player.id", entry.PlayerID),
+		attribute.String("score.mode", entry.Mode),
+		attribute.String("score.difficulty", entry.Difficulty),
+		attribute.Int("score.value", entry.Score),
+		attribute.Int("score.level", entry.Level),
+	)
+
+	// Only scores the engine reproduces from the seed and inputs are accepted
+	if err := verifySubmission(ctx, &sub); err != nil {
+		reason := "verification_failed"
+		var rejection *ScoreRejection
+		if errors.As(err, &rejection) {
+			reason = rejection.Reason
+		}
+
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Score rejected")
+		span.SetAttributes(attribute.String("score.rejection_reason", reason))
+		scoreRejectionCounter.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("reason", reason),
+			attribute.String("mode", entry.Mode),
+		))
+		logger.WarnContext(ctx, "Score rejected by replay verification",
+			"reason", reason,
+			"error", err,
+			"player_id", entry.PlayerID,
+			"score", entry.Score)
+		http.Error(w, "Score rejected: "+reason, http.StatusUnprocessableEntity)
+		return
+	}
+
+	entry.ReplayHash = sub.ReplayHash
+	rank, err := leaderboardStore.Submit(entry)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to submit score")
+		logger.WarnContext(ctx, "Score rejected", "error", err, "player_id", entry.PlayerID)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(attribute.Int("score.rank", rank))
+
+	scoreSubmissionCounter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("mode", entry.Mode),
+		attribute.String("difficulty", entry.Difficulty),
+	))
+	logger.InfoContext(ctx, "Score submitted",
+		"player_id", entry.PlayerID,
+		"score", entry.Score,
+		"level", entry.Level,
+		"mode", entry.Mode,
+		"rank", rank)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ScoreResponse{Status: "recorded", Rank: rank})
+}
+
+// leaderboardHandler returns a page of the leaderboard, filtered by mode,
+// difficulty, and time window
+func leaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tracer := telemetry.GetTracer()
+
+	_, span := tracer.Start(ctx, "query_leaderboard")
+	defer span.End()
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	query := leaderboard.Query{
+		Mode:       params.Get("mode"),
+		Difficulty: params.Get("difficulty"),
+		Window:     params.Get("window"),
+	}
+	if playerID, ok := requestPlayer(r); ok {
+		query.Player = playerID
+	}
+	if !leaderboard.ValidWindow(query.Window) {
+		span.SetStatus(codes.Error, "Invalid window")
+		http.Error(w, "window must be daily, weekly, or all", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if v := params.Get("offset"); v != "" {
+		if query.Offset, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	page := leaderboardStore.Query(query, time.Now())
+
+	span.SetAttributes(
+		attribute.String("leaderboard.mode", query.Mode),
+		attribute.String("leaderboard.difficulty", query.Difficulty),
+		attribute.String("leaderboard.window", query.Window),
+		attribute.Int("leaderboard.offset", page.Offset),
+		attribute.Int("leaderboard.total", page.Total),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/NathanNam/incident-commander-game/internal/leaderboard"
 	"github.com/NathanNam/incident-commander-game/internal/telemetry"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel/attribute"
@@ -29,6 +37,42 @@ var (
 	healthCheckCount   metric.Int64Counter
 	clientEventCounter metric.Int64Counter
 	gameMetricsGauge   metric.Float64Gauge
+
+	achievementUnlockCounter metric.Int64Counter
+	scoreSubmissionCounter   metric.Int64Counter
+	scoreRejectionCounter    metric.Int64Counter
+
+	playSessionsActive metric.Int64UpDownCounter
+	playFramesSkipped  metric.Int64Counter
+	spectatorsActive   metric.Int64UpDownCounter
+	spectatorResyncs   metric.Int64Counter
+	roomsActive        metric.Int64UpDownCounter
+	racesCompleted     metric.Int64Counter
+
+	assetTransferBytes    metric.Int64Histogram
+	assetTransferDuration metric.Float64Histogram
+
+	telemetryDropped           metric.Int64Counter
+	telemetryThrottled         metric.Int64Counter
+	telemetryAttributeOverflow metric.Int64Counter
+)
+
+// serverConfig is loaded from flags, the environment, and the config file at startup
+var serverConfig Config
+
+// Persistent game data
+var (
+	achievementStore  *AchievementStore
+	leaderboardStore  *leaderboard.Store
+	dailyAttemptStore *DailyAttemptStore
+)
+
+// Games played on the server over WebSockets, live games spectators can watch,
+// and multiplayer race rooms
+var (
+	sessionManager = NewSessionManager()
+	spectateHub    = NewSpectateHub()
+	roomManager    = NewRoomManager()
 )
 
 // healthCheckHandler handles health check requests
@@ -50,12 +94,12 @@ func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	healthCheckCount.Add(ctx, 1)
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	setAllowedOrigin(w, r)
 
 	health := HealthResponse{
 		Status:    "healthy",
 		Timestamp: time.Now(),
-		Service:   "incident-commander-game",
+		Service:   serverConfig.OTelServiceName(os.Getenv),
 	}
 
 	// Add span attributes
@@ -75,15 +119,27 @@ func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	logger.InfoContext(ctx, "Health check completed successfully")
 }
 
+// setAllowedOrigin allows the request's origin if the configuration does
+func setAllowedOrigin(w http.ResponseWriter, r *http.Request) {
+	if slices.Contains(serverConfig.AllowedOrigins, "*") {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	w.Header().Add("Vary", "Origin")
+	if origin := r.Header.Get("Origin"); origin != "" && serverConfig.AllowsOrigin(origin) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+}
+
 // corsMiddleware adds CORS headers for WebAssembly
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		logger := telemetry.GetLogger()
 
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		setAllowedOrigin(w, r)
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, traceparent, tracestate, "+playerTokenHeader)
 
 		if r.Method == "OPTIONS" {
 			logger.InfoContext(ctx, "CORS preflight request",
@@ -114,17 +170,17 @@ func serveIndex(w http.ResponseWriter, r *http.Request) {
 	// Add span attributes
 	span.SetAttributes(
 		attribute.String("http.route", "/"),
-		attribute.String("file.path", "web/index.html"),
+		attribute.String("file.path", "index.html"),
+		attribute.String("file.source", webAssets.Source()),
 	)
 
-	http.ServeFile(w, r, "web/index.html")
+	webAssets.ServeFile(w, r, "index.html")
 	logger.InfoContext(ctx, "Index page served successfully")
 }
 
 // clientTelemetryEventsHandler handles client-side telemetry events
 func clientTelemetryEventsHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	logger := telemetry.GetLogger()
 	tracer := telemetry.GetTracer()
 
 	// Start span for processing client telemetry
@@ -132,22 +188,20 @@ func clientTelemetryEventsHandler(w http.ResponseWriter, r *http.Request) {
 	defer span.End()
 
 	// Read request body
-	body, err := io.ReadAll(r.Body)
+	body, err := readTelemetryBody(w, r)
 	if err != nil {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, "Failed to read request body")
-		logger.ErrorContext(ctx, "Failed to read telemetry event body", "error", err)
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+		rejectTelemetry(ctx, w, r, "events", err)
 		return
 	}
 
-	// Parse client event
+	// Parse and check the client event
 	var clientEvent telemetry.ClientEvent
 	if err := json.Unmarshal(body, &clientEvent); err != nil {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, "Failed to unmarshal client event")
-		logger.ErrorContext(ctx, "Failed to unmarshal client event", "error", err)
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+		rejectTelemetry(ctx, w, r, "events", err)
+		return
+	}
+	if err := checkClientEvent(&clientEvent); err != nil {
+		rejectTelemetry(ctx, w, r, "events", err)
 		return
 	}
 
@@ -164,40 +218,11 @@ func clientTelemetryEventsHandler(w http.ResponseWriter, r *http.Request) {
 		attribute.Int("client.event.score", clientEvent.Score),
 	)
 
-	// Log the client event with correlation info
-	logger.InfoContext(ctx, "Client telemetry event received",
-		"event_type", clientEvent.Type,
-		"session_id", sessionID,
-		"correlation_id", correlationID,
-		"level", clientEvent.Level,
-		"score", clientEvent.Score,
-		"data", clientEvent.Data,
-		"client_timestamp", clientEvent.Timestamp,
-	)
-
-	// Increment client event counter
-	clientEventCounter.Add(ctx, 1, metric.WithAttributes(
-		attribute.String("event_type", clientEvent.Type),
-		attribute.String("session_id", sessionID),
-	))
-
-	// Record business metrics based on event type
-	switch clientEvent.Type {
-	case "level_change":
-		gameMetricsGauge.Record(ctx, float64(clientEvent.Level), metric.WithAttributes(
-			attribute.String("metric_type", "current_level"),
-			attribute.String("session_id", sessionID),
-		))
-	case "score_change":
-		gameMetricsGauge.Record(ctx, float64(clientEvent.Score), metric.WithAttributes(
-			attribute.String("metric_type", "current_score"),
-			attribute.String("session_id", sessionID),
-		))
-	case "game_start":
-		gameMetricsGauge.Record(ctx, 1, metric.WithAttributes(
-			attribute.String("metric_type", "game_sessions"),
-			attribute.String("session_id", sessionID),
-		))
+	recordClientEvent(ctx, clientEvent, sessionID, correlationID)
+	if clientEvent.Type == "span" {
+		if clientSpan := clientSpanFromEvent(clientEvent); checkClientSpan(&clientSpan) == nil {
+			recordClientSpan(ctx, clientSpan, sessionID, correlationID, r.UserAgent())
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -208,7 +233,6 @@ func clientTelemetryEventsHandler(w http.ResponseWriter, r *http.Request) {
 // clientTelemetryMetricsHandler handles client-side metrics
 func clientTelemetryMetricsHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	logger := telemetry.GetLogger()
 	tracer := telemetry.GetTracer()
 
 	// Start span for processing client metrics
@@ -216,22 +240,20 @@ func clientTelemetryMetricsHandler(w http.ResponseWriter, r *http.Request) {
 	defer span.End()
 
 	// Read request body
-	body, err := io.ReadAll(r.Body)
+	body, err := readTelemetryBody(w, r)
 	if err != nil {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, "Failed to read request body")
-		logger.ErrorContext(ctx, "Failed to read telemetry metric body", "error", err)
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+		rejectTelemetry(ctx, w, r, "metrics", err)
 		return
 	}
 
-	// Parse client metric
+	// Parse and check the client metric
 	var clientMetric telemetry.ClientMetric
 	if err := json.Unmarshal(body, &clientMetric); err != nil {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, "Failed to unmarshal client metric")
-		logger.ErrorContext(ctx, "Failed to unmarshal client metric", "error", err)
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+		rejectTelemetry(ctx, w, r, "metrics", err)
+		return
+	}
+	if err := checkClientMetric(&clientMetric); err != nil {
+		rejectTelemetry(ctx, w, r, "metrics", err)
 		return
 	}
 
@@ -248,22 +270,7 @@ func clientTelemetryMetricsHandler(w http.ResponseWriter, r *http.Request) {
 		attribute.String("client.correlation_id", correlationID),
 	)
 
-	// Log the client metric
-	logger.InfoContext(ctx, "Client telemetry metric received",
-		"metric_name", clientMetric.Name,
-		"metric_type", clientMetric.Type,
-		"metric_value", clientMetric.Value,
-		"session_id", sessionID,
-		"correlation_id", correlationID,
-		"client_timestamp", clientMetric.Timestamp,
-	)
-
-	// Record the metric in our telemetry system
-	gameMetricsGauge.Record(ctx, clientMetric.Value, metric.WithAttributes(
-		attribute.String("metric_type", clientMetric.Name),
-		attribute.String("session_id", sessionID),
-		attribute.String("source", "client"),
-	))
+	recordClientMetric(ctx, clientMetric, sessionID, correlationID)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -271,72 +278,315 @@ func clientTelemetryMetricsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
+	// Exit with a failure status only after the deferred cleanups below have run
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
+	// Load the configuration before anything else so mistakes are reported up front
+	var err error
+	serverConfig, err = LoadConfig(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n  %s\n", strings.ReplaceAll(err.Error(), "\n", "\n  "))
+		os.Exit(2)
+	}
+
 	// Initialize OpenTelemetry
-	cleanup := telemetry.SetupInstrumentation("incident-commander-server")
+	cleanup := telemetry.SetupInstrumentation(serverConfig.OTelServiceName(os.Getenv))
 	defer cleanup()
 
+	// Startup failures return through the deferred cleanups so the error is exported
+	fail := func(msg string, err error) {
+		telemetry.GetLogger().Error(msg, "error", err)
+		fmt.Fprintln(os.Stderr, msg+":", err)
+		exitCode = 1
+	}
+
 	// Initialize metrics
 	meter := telemetry.GetMeter()
-	var err error
 
 	requestCounter, err = meter.Int64Counter("http_requests_total",
 		metric.WithDescription("Total number of HTTP requests"))
 	if err != nil {
-		log.Fatal("Failed to create request counter:", err)
+		fail("Failed to create request counter", err)
+		return
 	}
 
 	requestDuration, err = meter.Float64Histogram("http_request_duration_seconds",
 		metric.WithDescription("HTTP request duration in seconds"))
 	if err != nil {
-		log.Fatal("Failed to create request duration histogram:", err)
+		fail("Failed to create request duration histogram", err)
+		return
 	}
 
 	healthCheckCount, err = meter.Int64Counter("health_checks_total",
 		metric.WithDescription("Total number of health check requests"))
 	if err != nil {
-		log.Fatal("Failed to create health check counter:", err)
+		fail("Failed to create health check counter", err)
+		return
 	}
 
 	clientEventCounter, err = meter.Int64Counter("client_events_total",
 		metric.WithDescription("Total number of client telemetry events received"))
 	if err != nil {
-		log.Fatal("Failed to create client event counter:", err)
+		fail("Failed to create client event counter", err)
+		return
 	}
 
 	gameMetricsGauge, err = meter.Float64Gauge("game_metrics",
 		metric.WithDescription("Various game-related metrics"))
 	if err != nil {
-		log.Fatal("Failed to create game metrics gauge:", err)
+		fail("Failed to create game metrics gauge", err)
+		return
+	}
+
+	achievementUnlockCounter, err = meter.Int64Counter("achievement_unlocks_total",
+		metric.WithDescription("Total number of achievements newly unlocked by players"))
+	if err != nil {
+		fail("Failed to create achievement unlock counter", err)
+		return
+	}
+
+	scoreSubmissionCounter, err = meter.Int64Counter("scores_submitted_total",
+		metric.WithDescription("Total number of scores submitted to the leaderboard"))
+	if err != nil {
+		fail("Failed to create score submission counter", err)
+		return
+	}
+
+	scoreRejectionCounter, err = meter.Int64Counter("score_rejections_total",
+		metric.WithDescription("Total number of scores rejected by replay verification, by reason"))
+	if err != nil {
+		fail("Failed to create score rejection counter", err)
+		return
+	}
+
+	playSessionsActive, err = meter.Int64UpDownCounter("play_sessions_active",
+		metric.WithDescription("Number of games currently running on the server"))
+	if err != nil {
+		fail("Failed to create play session counter", err)
+		return
+	}
+
+	playFramesSkipped, err = meter.Int64Counter("play_frames_skipped_total",
+		metric.WithDescription("Total number of state frames replaced before a slow client received them"))
+	if err != nil {
+		fail("Failed to create skipped frame counter", err)
+		return
+	}
+
+	spectatorsActive, err = meter.Int64UpDownCounter("spectators_active",
+		metric.WithDescription("Number of spectators currently watching live games"))
+	if err != nil {
+		fail("Failed to create spectator counter", err)
+		return
+	}
+
+	spectatorResyncs, err = meter.Int64Counter("spectator_resyncs_total",
+		metric.WithDescription("Total number of keyframes sent to spectators that fell behind"))
+	if err != nil {
+		fail("Failed to create spectator resync counter", err)
+		return
+	}
+
+	roomsActive, err = meter.Int64UpDownCounter("rooms_active",
+		metric.WithDescription("Number of open multiplayer race rooms"))
+	if err != nil {
+		fail("Failed to create room counter", err)
+		return
+	}
+
+	racesCompleted, err = meter.Int64Counter("races_completed_total",
+		metric.WithDescription("Total number of multiplayer races finished, by number of players"))
+	if err != nil {
+		fail("Failed to create race counter", err)
+		return
+	}
+
+	assetTransferBytes, err = meter.Int64Histogram("asset_transfer_bytes",
+		metric.WithDescription("Bytes sent per web asset response, by asset and encoding"),
+		metric.WithUnit("By"))
+	if err != nil {
+		fail("Failed to create asset size histogram", err)
+		return
+	}
+
+	assetTransferDuration, err = meter.Float64Histogram("asset_transfer_duration_seconds",
+		metric.WithDescription("Time to send a web asset response, by asset and encoding"),
+		metric.WithUnit("s"))
+	if err != nil {
+		fail("Failed to create asset time histogram", err)
+		return
+	}
+
+	telemetryDropped, err = meter.Int64Counter("client_telemetry_dropped_total",
+		metric.WithDescription("Client telemetry items refused as malformed, oversized or from a disallowed origin, by reason"))
+	if err != nil {
+		fail("Failed to create dropped telemetry counter", err)
+		return
+	}
+
+	telemetryThrottled, err = meter.Int64Counter("client_telemetry_throttled_total",
+		metric.WithDescription("Client telemetry requests rejected by rate limiting, by limit scope"))
+	if err != nil {
+		fail("Failed to create throttled telemetry counter", err)
+		return
+	}
+
+	telemetryAttributeOverflow, err = meter.Int64Counter("telemetry_attribute_overflow_total",
+		metric.WithDescription("Metric attribute values recorded as other because the attribute reached its distinct value cap"))
+	if err != nil {
+		fail("Failed to create attribute overflow counter", err)
+		return
+	}
+
+	// Client metrics get an instrument per declared name, and only the
+	// attributes the policy allows
+	clientMetrics, err = NewMetricRegistry(meter)
+	if err != nil {
+		fail("Failed to create client metric instruments", err)
+		return
 	}
+	attributePolicy = NewAttributePolicy(serverConfig.Telemetry.Attributes)
 
 	logger := telemetry.GetLogger()
 	logger.Info("OpenTelemetry metrics initialized")
 
+	// Load persistent stores
+	serverSecret, err = loadServerSecret(filepath.Join(serverConfig.DataDir, "server_secret"))
+	if err != nil {
+		fail("Failed to load server secret", err)
+		return
+	}
+	achievementStore, err = NewAchievementStore(filepath.Join(serverConfig.DataDir, "achievements.json"))
+	if err != nil {
+		fail("Failed to load achievement store", err)
+		return
+	}
+	leaderboardStore, err = leaderboard.Open(filepath.Join(serverConfig.DataDir, "scores.jsonl"))
+	if err != nil {
+		fail("Failed to load leaderboard", err)
+		return
+	}
+	defer leaderboardStore.Close()
+	dailyAttemptStore, err = NewDailyAttemptStore(filepath.Join(serverConfig.DataDir, "daily_attempts.json"))
+	if err != nil {
+		fail("Failed to load daily attempt store", err)
+		return
+	}
+
+	// Browser files are embedded unless asset_dir points at a directory
+	webAssets, err = NewAssetStore(serverConfig.AssetDir)
+	if err != nil {
+		fail("Failed to load web assets", err)
+		return
+	}
+	if !webAssets.Has("static/game.wasm") {
+		logger.Warn("The game isn't built; run make build before building the server", "assets", webAssets.Source())
+	}
+
 	// Set up instrumented routes
 	http.Handle("/", otelhttp.NewHandler(http.HandlerFunc(serveIndex), "GET /"))
 	http.Handle("/health", otelhttp.NewHandler(http.HandlerFunc(healthCheckHandler), "GET /health"))
 
 	// Client telemetry API endpoints
-	http.Handle("/api/telemetry/events", otelhttp.NewHandler(corsMiddleware(http.HandlerFunc(clientTelemetryEventsHandler)), "POST /api/telemetry/events"))
-	http.Handle("/api/telemetry/metrics", otelhttp.NewHandler(corsMiddleware(http.HandlerFunc(clientTelemetryMetricsHandler)), "POST /api/telemetry/metrics"))
+	telemetryIPLimiter = NewRateLimiter(serverConfig.Telemetry.RateLimit, serverConfig.Telemetry.RateBurst)
+	telemetrySessionLimiter = NewGroupedRateLimiter(serverConfig.Telemetry.SessionRateLimit, serverConfig.Telemetry.SessionRateBurst, maxSessionsPerIP)
+	http.Handle("/api/telemetry/events", otelhttp.NewHandler(corsMiddleware(telemetryGuard("events", http.HandlerFunc(clientTelemetryEventsHandler))), "POST /api/telemetry/events"))
+	http.Handle("/api/telemetry/metrics", otelhttp.NewHandler(corsMiddleware(telemetryGuard("metrics", http.HandlerFunc(clientTelemetryMetricsHandler))), "POST /api/telemetry/metrics"))
+	http.Handle("/api/telemetry/batch", otelhttp.NewHandler(corsMiddleware(telemetryGuard("batch", http.HandlerFunc(clientTelemetryBatchHandler))), "POST /api/telemetry/batch"))
+
+	// Player identities, and achievement progress keyed by player
+	http.Handle("/api/players", otelhttp.NewHandler(corsMiddleware(http.HandlerFunc(newPlayerHandler)), "POST /api/players"))
+	http.Handle("/api/achievements/{player}", otelhttp.NewHandler(corsMiddleware(http.HandlerFunc(achievementsHandler)), "/api/achievements/{player}"))
+
+	// Leaderboard
+	if serverConfig.Features.Leaderboard {
+		http.Handle("/api/scores", otelhttp.NewHandler(corsMiddleware(http.HandlerFunc(submitScoreHandler)), "POST /api/scores"))
+		http.Handle("/api/leaderboard", otelhttp.NewHandler(corsMiddleware(http.HandlerFunc(leaderboardHandler)), "GET /api/leaderboard"))
+	}
+
+	// Daily challenge
+	if serverConfig.Features.Daily {
+		http.Handle("/api/daily", otelhttp.NewHandler(corsMiddleware(http.HandlerFunc(dailyHandler)), "GET /api/daily"))
+		http.Handle("/api/daily/attempts", otelhttp.NewHandler(corsMiddleware(http.HandlerFunc(dailyAttemptHandler)), "POST /api/daily/attempts"))
+	}
+
+	// Server-authoritative play; WebSocket upgrades can't go through the CORS wrapper's preflight
+	if serverConfig.Features.ServerPlay {
+		http.Handle("/ws/play", otelhttp.NewHandler(http.HandlerFunc(playHandler), "GET /ws/play"))
+	}
+
+	// Spectating live games
+	if serverConfig.Features.Spectating {
+		http.Handle("/lobby", otelhttp.NewHandler(http.HandlerFunc(serveLobby), "GET /lobby"))
+		http.Handle("/api/sessions", otelhttp.NewHandler(corsMiddleware(http.HandlerFunc(liveSessionsHandler)), "GET /api/sessions"))
+		http.Handle("/ws/broadcast", otelhttp.NewHandler(http.HandlerFunc(broadcastHandler), "GET /ws/broadcast"))
+		http.Handle("/spectate/{session}", otelhttp.NewHandler(corsMiddleware(http.HandlerFunc(spectateHandler)), "GET /spectate/{session}"))
+	}
+
+	// Multiplayer race rooms
+	if serverConfig.Features.Rooms {
+		http.Handle("/api/rooms", otelhttp.NewHandler(corsMiddleware(http.HandlerFunc(roomsHandler)), "/api/rooms"))
+		http.Handle("/api/rooms/{room}/join", otelhttp.NewHandler(corsMiddleware(http.HandlerFunc(joinRoomHandler)), "POST /api/rooms/{room}/join"))
+		http.Handle("/ws/rooms/{room}", otelhttp.NewHandler(http.HandlerFunc(roomSocketHandler), "GET /ws/rooms/{room}"))
+	}
 
 	// Serve static files with CORS headers and instrumentation
-	fileServer := http.FileServer(http.Dir("web/"))
-	http.Handle("/web/", otelhttp.NewHandler(corsMiddleware(http.StripPrefix("/web/", fileServer)), "GET /web/*"))
-	http.Handle("/static/", otelhttp.NewHandler(corsMiddleware(http.StripPrefix("/static/", http.FileServer(http.Dir("web/static/")))), "GET /static/*"))
-	http.Handle("/images/", otelhttp.NewHandler(corsMiddleware(http.StripPrefix("/images/", http.FileServer(http.Dir("web/images/")))), "GET /images/*"))
-
-	logger.Info("🎮 Incident Commander Game Server starting on :8080")
-	logger.Info("🌐 Open http://localhost:8080 to play!")
-	logger.Info("🔍 Health check available at http://localhost:8080/health")
+	http.Handle("/web/", otelhttp.NewHandler(corsMiddleware(http.StripPrefix("/web/", webAssets.Handler(""))), "GET /web/*"))
+	http.Handle("/static/", otelhttp.NewHandler(corsMiddleware(http.StripPrefix("/static/", webAssets.Handler("static"))), "GET /static/*"))
+	http.Handle("/images/", otelhttp.NewHandler(corsMiddleware(http.StripPrefix("/images/", webAssets.Handler("images"))), "GET /images/*"))
+
+	addr := serverConfig.ListenAddr
+	scheme := "http"
+	if serverConfig.TLS() {
+		scheme = "https"
+	}
+	baseURL := scheme + "://localhost:" + addr[strings.LastIndex(addr, ":")+1:]
+
+	logger.Info("🎮 Incident Commander Game Server starting on " + addr)
+	logger.Info("🌐 Open " + baseURL + " to play!")
+	logger.Info("🔍 Health check available at " + baseURL + "/health")
 	logger.Info("🎯 Each browser session gets its own game instance")
 
 	// Also print to stdout for compatibility
-	fmt.Println("🎮 Incident Commander Game Server starting on :8080")
-	fmt.Println("🌐 Open http://localhost:8080 to play!")
-	fmt.Println("🔍 Health check available at http://localhost:8080/health")
+	fmt.Println("🎮 Incident Commander Game Server starting on " + addr)
+	fmt.Println("🌐 Open " + baseURL + " to play!")
+	fmt.Println("🔍 Health check available at " + baseURL + "/health")
 	fmt.Println("🎯 Each browser session gets its own game instance")
 
-	logger.Info("Server starting to listen on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	// Serve until SIGINT or SIGTERM, then drain so the deferred cleanups run
+	// and buffered telemetry is flushed
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	server := &http.Server{Addr: addr}
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Info("Server starting to listen", "addr", addr, "tls", serverConfig.TLS(), "assets", webAssets.Source())
+		if serverConfig.TLS() {
+			serveErr <- server.ListenAndServeTLS(serverConfig.TLSCert, serverConfig.TLSKey)
+		} else {
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		logger.Error("Server failed", "error", err)
+		fmt.Fprintln(os.Stderr, "Server failed:", err)
+		exitCode = 1
+	case <-signals.Done():
+		// A second signal kills the process without waiting for the drain
+		stopSignals()
+		logger.Info("Shutting down", "timeout", serverConfig.ShutdownTimeout.String())
+		fmt.Println("🛑 Shutting down, draining connections...")
+		shutdown(server)
+	}
 }
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NathanNam/incident-commander-game/internal/game"
+	"github.com/NathanNam/incident-commander-game/internal/leaderboard"
+	"github.com/NathanNam/incident-commander-game/internal/netplay"
+	"github.com/NathanNam/incident-commander-game/internal/telemetry"
+	"github.com/coder/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Backpressure limits for slow clients
+const (
+	frameWriteTimeout = 5 * time.Second // A single write taking longer disconnects the client
+	maxSkippedFrames  = 16              // Frames replaced before being sent; about 2s at the fastest tick rate
+	maxClientMessage  = 1024
+)
+
+// frameConn is a player's WebSocket connection to a game running on the
+// server. Only the latest frame is kept for a slow client; skipped frames hand
+// their events on to the next one. A client that stays too far behind is
+// disconnected and resyncs when it reconnects.
+type frameConn[M any] struct {
+	ws      *websocket.Conn
+	cancel  context.CancelFunc
+	isFrame func(*M) bool
+	merge   func(skipped, next *M) // Carries a skipped frame's events into the next frame
+
+	mu      sync.Mutex
+	control []M // Messages that are never skipped, such as the welcome
+	frame   *M  // Latest frame not yet sent
+	skipped int // Frames replaced since the last write
+	notify  chan struct{}
+}
+
+// playConn is a connection to a play session
+type playConn = frameConn[netplay.ServerMessage]
+
+// newPlayConn wraps a WebSocket; cancel stops the connection's handler
+func newPlayConn(ws *websocket.Conn, cancel context.CancelFunc) *playConn {
+	return &playConn{
+		ws:      ws,
+		cancel:  cancel,
+		isFrame: func(msg *netplay.ServerMessage) bool { return msg.Type == netplay.TypeFrame },
+		merge: func(skipped, next *netplay.ServerMessage) {
+			next.Frame.Events = append(skipped.Frame.Events, next.Frame.Events...)
+		},
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// send queues a message without blocking the game's tick goroutine
+func (c *frameConn[M]) send(msg M) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.isFrame(&msg) {
+		// A frame sent earlier stays ahead of the message, e.g. a race's last frame and its results
+		if c.frame != nil {
+			c.control = append(c.control, *c.frame)
+			c.frame = nil
+		}
+		c.control = append(c.control, msg)
+	} else {
+		if c.frame != nil {
+			c.merge(c.frame, &msg)
+			c.skipped++
+			playFramesSkipped.Add(context.Background(), 1)
+		}
+		c.frame = &msg
+		if c.skipped > maxSkippedFrames {
+			c.cancel()
+			return
+		}
+	}
+
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// next takes the queued messages to write
+func (c *frameConn[M]) next() []M {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	msgs := c.control
+	c.control = nil
+	if c.frame != nil {
+		msgs = append(msgs, *c.frame)
+		c.frame = nil
+	}
+	c.skipped = 0
+	return msgs
+}
+
+// writeLoop writes queued messages until the connection's context ends
+func (c *frameConn[M]) writeLoop(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.notify:
+		}
+
+		for _, msg := range c.next() {
+			data, err := json.Marshal(msg)
+			if err != nil {
+				return err
+			}
+			writeCtx, cancel := context.WithTimeout(ctx, frameWriteTimeout)
+			err = c.ws.Write(writeCtx, websocket.MessageText, data)
+			cancel()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// close stops the connection, e.g. when the player reconnects elsewhere
+func (c *frameConn[M]) close() {
+	c.cancel()
+}
+
+// end closes the connection with status because its session ended. Cancelling
+// the handler would drop the connection before the status is sent.
+func (c *frameConn[M]) end(status websocket.StatusCode) {
+	go func() {
+		c.ws.Close(status, "")
+		c.cancel()
+	}()
+}
+
+// playHandler upgrades to a WebSocket and plays a game on the server. A new
+// session is created from the mode, difficulty, player, and name query
+// parameters; a dropped connection resumes with the session and token.
+func playHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := telemetry.GetLogger()
+	tracer := telemetry.GetTracer()
+
+	ctx, span := tracer.Start(ctx, "play_connection")
+	defer span.End()
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// New sessions are started by the player; resuming takes the session token
+	params := r.URL.Query()
+	if params.Get("session") == "" && !authorizePlayer(w, r, params.Get("player")) {
+		span.SetStatus(codes.Error, "Invalid player token")
+		return
+	}
+	session, resync, err := playSession(ctx, params.Get("session"), params.Get("token"),
+		params.Get("player"), params.Get("name"), params.Get("mode"), params.Get("difficulty"))
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, errTooManySessions) || errors.Is(err, errShuttingDown):
+			status = http.StatusServiceUnavailable
+		case errors.Is(err, errTooManyPlayerSessions):
+			status = http.StatusTooManyRequests
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to start play session")
+		http.Error(w, err.Error(), status)
+		return
+	}
+	span.SetAttributes(
+		attribute.String("play.session_id", session.ID),
+		attribute.String("player.id", session.PlayerID),
+		attribute.Bool("play.resync", resync),
+	)
+
+	defer trackStream()()
+
+	ws, err := websocket.Accept(w, r, &websocket.AcceptOptions{OriginPatterns: serverConfig.OriginHosts()})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "WebSocket upgrade failed")
+		logger.WarnContext(ctx, "WebSocket upgrade failed", "error", err, "session_id", session.ID)
+		return
+	}
+	ws.SetReadLimit(maxClientMessage)
+	defer closeOnShutdown(ws)()
+
+	connCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	conn := newPlayConn(ws, cancel)
+	session.attach(conn, resync)
+	defer session.detach(conn)
+
+	logger.InfoContext(ctx, "Play connection opened", "session_id", session.ID, "resync", resync)
+
+	go func() {
+		if err := conn.writeLoop(connCtx); err != nil && connCtx.Err() == nil {
+			logger.WarnContext(ctx, "Play connection write failed", "error", err, "session_id", session.ID)
+		}
+		cancel()
+	}()
+
+	for {
+		_, data, err := ws.Read(connCtx)
+		if err != nil {
+			break
+		}
+		var msg netplay.ClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		session.handle(msg)
+	}
+
+	ws.Close(websocket.StatusNormalClosure, "")
+	logger.InfoContext(ctx, "Play connection closed", "session_id", session.ID)
+}
+
+// playSession resumes the session a reconnecting player was in, or creates a
+// new one. Returns true for a resumed session.
+func playSession(ctx context.Context, id, token, playerID, name, mode, difficulty string) (*PlaySession, bool, error) {
+	if id != "" {
+		session, ok := sessionManager.Get(id, token)
+		if !ok {
+			return nil, false, errors.New("unknown session or token")
+		}
+		return session, true, nil
+	}
+
+	if !playerIDPattern.MatchString(playerID) {
+		return nil, false, errors.New("invalid player ID")
+	}
+	// Today's daily challenge sets its own difficulty
+	if mode == "daily" {
+		challenge := game.DailyChallengeFor(time.Now(), serverSecret)
+		mode = dailyModePrefix + challenge.Date
+		difficulty = challenge.Difficulty
+	}
+	if mode == "" {
+		mode = "classic"
+	}
+	if difficulty == "" {
+		difficulty = leaderboard.DifficultyNormal
+	}
+	if !strings.HasPrefix(mode, dailyModePrefix) && difficulty != leaderboard.DifficultyNormal {
+		return nil, false, fmt.Errorf("difficulty %q is only ranked for daily challenges", difficulty)
+	}
+
+	// Reject names and modes the leaderboard wouldn't accept before the game starts
+	entry := leaderboard.Entry{RunID: "run", PlayerID: playerID, Name: name, Level: 1, Mode: mode, Difficulty: difficulty}
+	if err := entry.Validate(); err != nil {
+		return nil, false, err
+	}
+	opts, err := replayOptions(mode)
+	if err != nil {
+		return nil, false, err
+	}
+
+	session, err := sessionManager.Create(trace.LinkFromContext(ctx), playerID, entry.Name, mode, difficulty, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	return session, false, nil
+}
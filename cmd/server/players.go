@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/NathanNam/incident-commander-game/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Players have a public ID and a secret token the server issued for it: the
+// ID and an HMAC of it under the server secret. Endpoints that act for a
+// player check the token, so knowing a player's ID isn't enough to be them.
+const (
+	playerTokenHeader = "X-Player-Token"
+	playerTokenParam  = "player_token" // WebSockets can't send headers
+	serverSecretSize  = 32
+	playerRateLimit   = 0.1 // New players per second per IP
+	playerRateBurst   = 5
+)
+
+// serverSecret keys player tokens, loaded from the data directory at startup
+var serverSecret []byte
+
+// playerLimiter rate limits new players per client IP
+var playerLimiter = NewRateLimiter(playerRateLimit, playerRateBurst)
+
+// loadServerSecret reads the server secret from path, creating a random one
+// if the file doesn't exist
+func loadServerSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		secret, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(secret) < serverSecretSize {
+			return nil, fmt.Errorf("server secret %s must be at least %d hex-encoded bytes", path, serverSecretSize)
+		}
+		return secret, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	secret := make([]byte, serverSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(secret)+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// playerToken returns the token proving a request comes from playerID
+func playerToken(playerID string) string {
+	mac := hmac.New(sha256.New, serverSecret)
+	mac.Write([]byte("player:" + playerID))
+	return playerID + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// requestPlayer returns the player whose token a request carries, if it's valid
+func requestPlayer(r *http.Request) (string, bool) {
+	token := r.Header.Get(playerTokenHeader)
+	if token == "" {
+		token = r.URL.Query().Get(playerTokenParam)
+	}
+	playerID, _, ok := strings.Cut(token, ".")
+	if !ok || !playerIDPattern.MatchString(playerID) {
+		return "", false
+	}
+	return playerID, hmac.Equal([]byte(token), []byte(playerToken(playerID)))
+}
+
+// authorizePlayer checks that a request carries playerID's token, answering
+// 401 if it doesn't
+func authorizePlayer(w http.ResponseWriter, r *http.Request, playerID string) bool {
+	if id, ok := requestPlayer(r); ok && id == playerID {
+		return true
+	}
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return false
+}
+
+// PlayerIdentity is a new player's ID and the token that proves it
+type PlayerIdentity struct {
+	PlayerID string `json:"player_id"`
+	Token    string `json:"token"`
+}
+
+// newPlayerHandler issues a new player ID and its token
+func newPlayerHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := telemetry.GetLogger()
+	tracer := telemetry.GetTracer()
+
+	ctx, span := tracer.Start(ctx, "new_player")
+	defer span.End()
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !allowRequest(w, playerLimiter, clientIP(r)) {
+		span.SetStatus(codes.Error, "Rate limited")
+		return
+	}
+
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to generate player ID")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	playerID := "player_" + hex.EncodeToString(id)
+
+	span.SetAttributes(attribute.String("player.id", playerID))
+	logger.InfoContext(ctx, "Player registered", "player_id", playerID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(PlayerIdentity{PlayerID: playerID, Token: playerToken(playerID)})
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NathanNam/incident-commander-game/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+// Rate limiter bookkeeping
+const (
+	limiterIdleTimeout = 10 * time.Minute // Buckets unused this long are dropped
+	limiterSweepEvery  = time.Minute
+	maxLimitedClients  = 100_000 // Past this, new clients share one bucket
+	maxSessionsPerIP   = 20      // Telemetry session buckets per client IP; more sessions share one
+)
+
+// Limits on the attribute maps of client events and metrics
+const (
+	maxAttributeKeyLength   = 64
+	maxAttributeValueLength = 256
+)
+
+// RateLimiter gives every key, such as a client IP, its own token bucket.
+// Keys can belong to a group, such as the IP a session connects from, that
+// holds a limited number of buckets.
+type RateLimiter struct {
+	limit       rate.Limit
+	burst       int
+	maxPerGroup int // Buckets per group before its new keys share one; 0 for no limit
+
+	mu        sync.Mutex
+	clients   map[string]*limitedClient
+	groups    map[string]int // Buckets per group
+	overflow  *rate.Limiter  // Shared by new keys while the map is full
+	lastSweep time.Time
+}
+
+// limitedClient is one key's bucket
+type limitedClient struct {
+	limiter  *rate.Limiter
+	group    string
+	lastSeen time.Time
+}
+
+// NewRateLimiter allows each key perSecond requests on average, in bursts of up to burst
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		limit:     rate.Limit(perSecond),
+		burst:     burst,
+		clients:   make(map[string]*limitedClient),
+		groups:    make(map[string]int),
+		overflow:  rate.NewLimiter(rate.Limit(perSecond), burst),
+		lastSweep: time.Now(),
+	}
+}
+
+// NewGroupedRateLimiter is like NewRateLimiter, but once a group has
+// maxPerGroup buckets its new keys share the group's overflow bucket
+func NewGroupedRateLimiter(perSecond float64, burst, maxPerGroup int) *RateLimiter {
+	l := NewRateLimiter(perSecond, burst)
+	l.maxPerGroup = maxPerGroup
+	return l
+}
+
+// Allow takes a token from key's bucket. If the bucket is empty it returns
+// false and how long until a token is available.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	return l.AllowIn("", key)
+}
+
+// AllowIn is Allow for a key that belongs to a group
+func (l *RateLimiter) AllowIn(group, key string) (bool, time.Duration) {
+	now := time.Now()
+	limiter := l.limiter(group, key, now)
+
+	reservation := limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// limiter returns key's bucket, creating it if needed
+func (l *RateLimiter) limiter(group, key string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > limiterSweepEvery {
+		for k, c := range l.clients {
+			if now.Sub(c.lastSeen) > limiterIdleTimeout {
+				delete(l.clients, k)
+				if l.groups[c.group]--; l.groups[c.group] <= 0 {
+					delete(l.groups, c.group)
+				}
+			}
+		}
+		l.lastSweep = now
+	}
+
+	c, ok := l.clients[key]
+	if !ok && group != "" && l.maxPerGroup > 0 && l.groups[group] >= l.maxPerGroup {
+		// The group is full, so its new keys share one bucket
+		key = "group:" + group
+		c, ok = l.clients[key]
+	}
+	if !ok {
+		if len(l.clients) >= maxLimitedClients {
+			return l.overflow
+		}
+		c = &limitedClient{limiter: rate.NewLimiter(l.limit, l.burst), group: group}
+		l.clients[key] = c
+		l.groups[group]++
+	}
+	c.lastSeen = now
+	return c.limiter
+}
+
+// Telemetry rate limiters, created from the configuration at startup
+var (
+	telemetryIPLimiter      *RateLimiter
+	telemetrySessionLimiter *RateLimiter
+)
+
+// telemetryGuard protects a client telemetry endpoint: only POSTs from allowed
+// origins get through, and each client IP and browser session is rate limited.
+// Throttled requests get a 429 with Retry-After.
+func telemetryGuard(endpoint string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		span := trace.SpanFromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" && !serverConfig.AllowsOrigin(origin) {
+			dropTelemetry(ctx, endpoint, "origin", 1)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		// Sessions are keyed by IP too, so rotating X-Session-ID only ever
+		// reaches the IP's few session buckets. Requests without the header
+		// share one bucket per IP.
+		ip := clientIP(r)
+		checks := []struct {
+			scope   string
+			limiter *RateLimiter
+			group   string
+			key     string
+		}{
+			{"ip", telemetryIPLimiter, "", ip},
+			{"session", telemetrySessionLimiter, ip, ip + "/" + r.Header.Get("X-Session-ID")},
+		}
+		for _, check := range checks {
+			if ok, retryAfter := check.limiter.AllowIn(check.group, check.key); !ok {
+				telemetryThrottled.Add(ctx, 1, metric.WithAttributes(
+					attribute.String("endpoint", endpoint),
+					attribute.String("scope", check.scope),
+				))
+				span.SetAttributes(attribute.String("telemetry.throttled", check.scope))
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowRequest takes a token from key's bucket, or answers 429 with
+// Retry-After and returns false when it's empty
+func allowRequest(w http.ResponseWriter, limiter *RateLimiter, key string) bool {
+	ok, retryAfter := limiter.Allow(key)
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+	}
+	return ok
+}
+
+// clientIP returns the address the request came from, without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// errTelemetryTooLarge is returned for request bodies over the configured limit
+var errTelemetryTooLarge = errors.New("telemetry request too large")
+
+// readTelemetryBody reads a telemetry request body up to the configured limit
+func readTelemetryBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, serverConfig.Telemetry.MaxBodyBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, errTelemetryTooLarge
+	}
+	return body, err
+}
+
+// validateAttributes checks a client's attribute map: a bounded number of
+// short keys, and only flat string, number and boolean values
+func validateAttributes(attributes map[string]interface{}) error {
+	if len(attributes) > serverConfig.Telemetry.MaxAttributes {
+		return fmt.Errorf("%d attributes, at most %d allowed", len(attributes), serverConfig.Telemetry.MaxAttributes)
+	}
+	for key, value := range attributes {
+		if key == "" || len(key) > maxAttributeKeyLength {
+			return fmt.Errorf("attribute key %.64q must be 1 to %d bytes", key, maxAttributeKeyLength)
+		}
+		switch v := value.(type) {
+		case string:
+			if len(v) > maxAttributeValueLength {
+				return fmt.Errorf("attribute %q is longer than %d bytes", key, maxAttributeValueLength)
+			}
+		case float64, bool:
+		default:
+			return fmt.Errorf("attribute %q must be a string, number or boolean", key)
+		}
+	}
+	return nil
+}
+
+// dropTelemetry counts telemetry items the server refused, by reason
+func dropTelemetry(ctx context.Context, endpoint, reason string, items int) {
+	telemetryDropped.Add(ctx, int64(items), metric.WithAttributes(
+		attribute.String("endpoint", endpoint),
+		attribute.String("reason", reason),
+	))
+}
+
+// rejectTelemetry drops a telemetry request and tells the client why. ctx
+// carries the handler's span.
+func rejectTelemetry(ctx context.Context, w http.ResponseWriter, r *http.Request, endpoint string, err error) {
+	span := trace.SpanFromContext(ctx)
+
+	reason, status := "malformed", http.StatusBadRequest
+	if errors.Is(err, errTelemetryTooLarge) {
+		reason, status = "too_large", http.StatusRequestEntityTooLarge
+	}
+	dropTelemetry(ctx, endpoint, reason, 1)
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, "Rejected client telemetry")
+	telemetry.GetLogger().WarnContext(ctx, "Rejected client telemetry",
+		"endpoint", endpoint, "reason", reason, "error", err, "remote_addr", clientIP(r))
+	http.Error(w, err.Error(), status)
+}
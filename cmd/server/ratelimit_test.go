@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/NathanNam/incident-commander-game/internal/telemetry"
+)
+
+func TestRateLimiterBurstAndRefill(t *testing.T) {
+	l := NewRateLimiter(20, 3)
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d of the burst was throttled", i+1)
+		}
+	}
+	ok, retryAfter := l.Allow("a")
+	if ok {
+		t.Fatal("request past the burst was allowed")
+	}
+	if retryAfter <= 0 || retryAfter > 50*time.Millisecond {
+		t.Errorf("retry after %s, want up to one token's worth (50ms)", retryAfter)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("another key shared the throttled bucket")
+	}
+
+	time.Sleep(retryAfter + 10*time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("request after the bucket refilled was throttled")
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	l := NewGroupedRateLimiter(1, 1, 2)
+	start := time.Now()
+	l.limiter("", "idle", start)
+	l.limiter("10.0.0.1", "10.0.0.1/s1", start)
+	l.limiter("", "busy", start)
+
+	later := start.Add(limiterIdleTimeout - time.Second)
+	l.limiter("", "busy", later)
+
+	// The sweep runs on the next lookup limiterSweepEvery after the last one
+	l.limiter("", "new", later.Add(limiterSweepEvery+time.Second))
+	for key, want := range map[string]bool{"idle": false, "10.0.0.1/s1": false, "busy": true, "new": true} {
+		if _, ok := l.clients[key]; ok != want {
+			t.Errorf("bucket %q kept = %v, want %v", key, ok, want)
+		}
+	}
+	if n := l.groups["10.0.0.1"]; n != 0 {
+		t.Errorf("swept group still counts %d buckets", n)
+	}
+}
+
+func TestRateLimiterOverflow(t *testing.T) {
+	l := NewRateLimiter(1, 1)
+	now := time.Now()
+	for i := 0; i < maxLimitedClients; i++ {
+		l.limiter("", strconv.Itoa(i), now)
+	}
+
+	// New keys share the overflow bucket, while known keys keep their own
+	if ok, _ := l.Allow("new-1"); !ok {
+		t.Fatal("first overflow request was throttled")
+	}
+	if ok, _ := l.Allow("new-2"); ok {
+		t.Error("second new key didn't share the overflow bucket")
+	}
+	if ok, _ := l.Allow("0"); !ok {
+		t.Error("known key was throttled by the overflow bucket")
+	}
+}
+
+func TestRateLimiterGroups(t *testing.T) {
+	l := NewGroupedRateLimiter(1, 1, 2)
+	for _, key := range []string{"ip1/a", "ip1/b"} {
+		if ok, _ := l.AllowIn("ip1", key); !ok {
+			t.Fatalf("%s was throttled", key)
+		}
+	}
+
+	// Past the group's limit, new keys share one bucket
+	if ok, _ := l.AllowIn("ip1", "ip1/c"); !ok {
+		t.Fatal("first key past the group limit was throttled")
+	}
+	if ok, _ := l.AllowIn("ip1", "ip1/d"); ok {
+		t.Error("rotated key past the group limit got a fresh bucket")
+	}
+	if ok, _ := l.AllowIn("ip2", "ip2/a"); !ok {
+		t.Error("another group was throttled")
+	}
+}
+
+func TestTelemetryGuardThrottles(t *testing.T) {
+	var err error
+	if telemetryThrottled, err = telemetry.GetMeter().Int64Counter("client_telemetry_throttled_total"); err != nil {
+		t.Fatal(err)
+	}
+	telemetryIPLimiter = NewRateLimiter(1000, 1000)
+	telemetrySessionLimiter = NewGroupedRateLimiter(1, 2, maxSessionsPerIP)
+	guard := telemetryGuard("events", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	post := func(ip, session string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/telemetry/events", nil)
+		r.RemoteAddr = ip + ":1234"
+		if session != "" {
+			r.Header.Set("X-Session-ID", session)
+		}
+		w := httptest.NewRecorder()
+		guard.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		name       string
+		ip         string
+		session    string
+		wantStatus int
+	}{
+		{"first request", "10.0.0.1", "s1", http.StatusAccepted},
+		{"second request", "10.0.0.1", "s1", http.StatusAccepted},
+		{"past the session burst", "10.0.0.1", "s1", http.StatusTooManyRequests},
+		{"same session from another IP", "10.0.0.2", "s1", http.StatusAccepted},
+		{"no session header", "10.0.0.1", "", http.StatusAccepted},
+		{"no session header again", "10.0.0.1", "", http.StatusAccepted},
+		{"no session header past the burst", "10.0.0.1", "", http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		w := post(tt.ip, tt.session)
+		if w.Code != tt.wantStatus {
+			t.Fatalf("%s: status %d, want %d", tt.name, w.Code, tt.wantStatus)
+		}
+		if w.Code == http.StatusTooManyRequests {
+			if retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || retryAfter < 1 {
+				t.Errorf("%s: Retry-After %q, want whole seconds", tt.name, w.Header().Get("Retry-After"))
+			}
+		}
+	}
+
+	// Rotating the session header doesn't get past the IP's session buckets
+	throttled := false
+	for i := 0; i < maxSessionsPerIP*3 && !throttled; i++ {
+		for j := 0; j < 3; j++ {
+			throttled = throttled || post("10.0.0.3", fmt.Sprintf("rotated-%d", i)).Code == http.StatusTooManyRequests
+		}
+	}
+	if !throttled {
+		t.Error("rotating X-Session-ID was never throttled")
+	}
+	if n := len(telemetrySessionLimiter.clients); n > maxSessionsPerIP+5 {
+		t.Errorf("rotating X-Session-ID created %d session buckets", n)
+	}
+}
@@ -0,0 +1,870 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/NathanNam/incident-commander-game/internal/game"
+	"github.com/NathanNam/incident-commander-game/internal/netplay"
+	"github.com/NathanNam/incident-commander-game/internal/race"
+	"github.com/NathanNam/incident-commander-game/internal/telemetry"
+	"github.com/coder/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Race room limits
+const (
+	maxRooms           = 100
+	raceBoardSize      = 24
+	countdownSeconds   = 3
+	lobbyLeaveTimeout  = 30 * time.Second // A disconnected player loses their lobby seat after this
+	raceForfeitTimeout = 10 * time.Second // A disconnected racer forfeits after this
+	resultsTimeout     = 60 * time.Second // Finished rooms stay open this long for the results screen
+	maxRoomRequestSize = 1024
+	roomRateLimit      = 0.05 // New rooms per second per client IP and per player
+	roomRateBurst      = 3
+)
+
+// Room errors, mapped to HTTP statuses by roomErrorStatus
+var (
+	errTooManyRooms = errors.New("too many open rooms")
+	errRoomOpen     = errors.New("player already has an open room")
+	errUnknownRoom  = errors.New("unknown room")
+	errNotInRoom    = errors.New("player is not in this room")
+	errRoomFull     = errors.New("room is full")
+	errRoomStarted  = errors.New("race has already started")
+)
+
+// roomLimiter rate limits new rooms, keyed by client IP and by player
+var roomLimiter = NewRateLimiter(roomRateLimit, roomRateBurst)
+
+// RoomManager owns the multiplayer race rooms
+type RoomManager struct {
+	mu       sync.Mutex
+	rooms    map[string]*Room
+	stopping bool // No new rooms once the server is shutting down
+}
+
+// NewRoomManager creates an empty room manager
+func NewRoomManager() *RoomManager {
+	return &RoomManager{rooms: make(map[string]*Room)}
+}
+
+// Room is a lobby of two to four players that races once on a shared board.
+// A housekeeping goroutine drops absent players and closes the room; a tick
+// goroutine drives the race itself.
+type Room struct {
+	ID      string
+	owner   string // Player who created the room
+	created time.Time
+	manager *RoomManager
+
+	mu           sync.Mutex
+	phase        string
+	players      []*roomPlayer // Seated in join order; seats close up when someone leaves the lobby
+	race         *race.Race
+	results      []race.Result
+	phaseStarted time.Time
+	countdown    int // Bumped to stop a running countdown
+	closed       bool
+
+	// The room span covers the room's life, with a child span per phase and per player
+	ctx       context.Context
+	span      trace.Span
+	phaseSpan trace.Span
+}
+
+// roomPlayer is a seat in a room
+type roomPlayer struct {
+	ID             string
+	Name           string
+	Ready          bool
+	conn           *roomConn
+	disconnectedAt time.Time
+	span           trace.Span
+}
+
+// roomConn is a connection to a room; race frames from a slow client are skipped
+type roomConn = frameConn[netplay.RoomMessage]
+
+// newRoomConn wraps a WebSocket; cancel stops the connection's handler
+func newRoomConn(ws *websocket.Conn, cancel context.CancelFunc) *roomConn {
+	return &roomConn{
+		ws:      ws,
+		cancel:  cancel,
+		isFrame: func(msg *netplay.RoomMessage) bool { return msg.Type == netplay.TypeRace },
+		merge: func(skipped, next *netplay.RoomMessage) {
+			next.Events = append(skipped.Events, next.Events...)
+		},
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// Create opens a room with its creator in the first seat. Each player can
+// have one open room at a time.
+func (m *RoomManager) Create(link trace.Link, playerID, name string) (*Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stopping {
+		return nil, errShuttingDown
+	}
+	if len(m.rooms) >= maxRooms {
+		return nil, errTooManyRooms
+	}
+	for _, r := range m.rooms {
+		if r.owner == playerID {
+			return nil, errRoomOpen
+		}
+	}
+
+	r := &Room{
+		ID:           "room_" + randomHex(4),
+		owner:        playerID,
+		created:      time.Now(),
+		manager:      m,
+		phase:        netplay.PhaseLobby,
+		phaseStarted: time.Now(),
+	}
+
+	// Rooms outlive the request that created them, so they get their own trace
+	r.ctx, r.span = telemetry.GetTracer().Start(context.Background(), "room",
+		trace.WithNewRoot(),
+		trace.WithLinks(link),
+		trace.WithAttributes(attribute.String("room.id", r.ID)))
+	r.startPhase(netplay.PhaseLobby)
+	r.addPlayer(playerID, name)
+
+	m.rooms[r.ID] = r
+	roomsActive.Add(r.ctx, 1)
+	go r.housekeeping()
+
+	telemetry.GetLogger().InfoContext(r.ctx, "Room created", "room_id", r.ID, "player_id", playerID)
+	return r, nil
+}
+
+// Get returns an open room
+func (m *RoomManager) Get(id string) (*Room, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.rooms[id]
+	return r, ok
+}
+
+// List describes every open room, newest first
+func (m *RoomManager) List() []netplay.RoomSummary {
+	m.mu.Lock()
+	rooms := make([]*Room, 0, len(m.rooms))
+	for _, r := range m.rooms {
+		rooms = append(rooms, r)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].created.After(rooms[j].created) })
+	summaries := make([]netplay.RoomSummary, 0, len(rooms))
+	for _, r := range rooms {
+		summaries = append(summaries, r.summary())
+	}
+	return summaries
+}
+
+// Shutdown closes every room and stops new ones from opening
+func (m *RoomManager) Shutdown() {
+	m.mu.Lock()
+	m.stopping = true
+	rooms := make([]*Room, 0, len(m.rooms))
+	for _, r := range m.rooms {
+		rooms = append(rooms, r)
+	}
+	m.mu.Unlock()
+
+	for _, r := range rooms {
+		r.mu.Lock()
+		if !r.closed {
+			r.close(endReasonShutdown)
+		}
+		r.mu.Unlock()
+	}
+}
+
+// remove drops a closed room
+func (m *RoomManager) remove(r *Room) {
+	m.mu.Lock()
+	delete(m.rooms, r.ID)
+	m.mu.Unlock()
+
+	roomsActive.Add(r.ctx, -1)
+}
+
+// summary describes the room for the room list
+func (r *Room) summary() netplay.RoomSummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, len(r.players))
+	for i, p := range r.players {
+		names[i] = p.Name
+	}
+	return netplay.RoomSummary{ID: r.ID, Phase: r.phase, Players: names, Seats: race.MaxPlayers}
+}
+
+// state describes the room's lobby to the player in a seat
+func (r *Room) state(seat int) *netplay.RoomState {
+	players := make([]netplay.RoomPlayer, len(r.players))
+	for i, p := range r.players {
+		players[i] = netplay.RoomPlayer{Seat: i, Name: p.Name, Ready: p.Ready, Connected: p.conn != nil}
+	}
+	return &netplay.RoomState{ID: r.ID, Phase: r.phase, Players: players, You: seat}
+}
+
+// seat returns a player's seat, or -1 if they're not in the room
+func (r *Room) seat(playerID string) int {
+	return slices.IndexFunc(r.players, func(p *roomPlayer) bool { return p.ID == playerID })
+}
+
+// Join seats a player in the lobby. Joining a room the player is already in is a no-op.
+func (r *Room) Join(playerID, name string) (*netplay.RoomState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil, errUnknownRoom
+	}
+	if seat := r.seat(playerID); seat >= 0 {
+		return r.state(seat), nil
+	}
+	if r.phase != netplay.PhaseLobby {
+		return nil, errRoomStarted
+	}
+	if len(r.players) >= race.MaxPlayers {
+		return nil, errRoomFull
+	}
+
+	r.addPlayer(playerID, name)
+	r.sendState()
+	return r.state(len(r.players) - 1), nil
+}
+
+// addPlayer seats a new player, who has until lobbyLeaveTimeout to connect.
+// Callers hold r.mu or haven't published the room yet.
+func (r *Room) addPlayer(playerID, name string) {
+	_, span := telemetry.GetTracer().Start(r.ctx, "room.player", trace.WithAttributes(
+		attribute.String("player.id", playerID),
+		attribute.Int("room.seat", len(r.players)),
+	))
+	r.players = append(r.players, &roomPlayer{ID: playerID, Name: name, disconnectedAt: time.Now(), span: span})
+	r.span.AddEvent("player_joined", trace.WithAttributes(
+		attribute.String("player.id", playerID),
+		attribute.Int("room.players", len(r.players)),
+	))
+}
+
+// removePlayer gives up a lobby seat. Callers hold r.mu.
+func (r *Room) removePlayer(seat int, reason string) {
+	p := r.players[seat]
+	r.players = slices.Delete(r.players, seat, seat+1)
+	if p.conn != nil {
+		p.conn.close()
+	}
+	p.span.SetAttributes(attribute.String("room.leave_reason", reason))
+	p.span.End()
+	r.span.AddEvent("player_left", trace.WithAttributes(
+		attribute.String("player.id", p.ID),
+		attribute.String("room.leave_reason", reason),
+	))
+
+	if r.phase == netplay.PhaseCountdown {
+		r.cancelCountdown("player_left")
+	}
+	r.sendState()
+}
+
+// startPhase ends the current phase's span and starts the next. Callers hold r.mu.
+func (r *Room) startPhase(phase string, attrs ...attribute.KeyValue) {
+	if r.phaseSpan != nil {
+		r.phaseSpan.End()
+	}
+	r.phase = phase
+	r.phaseStarted = time.Now()
+	_, r.phaseSpan = telemetry.GetTracer().Start(r.ctx, "room."+phase, trace.WithAttributes(attrs...))
+}
+
+// attach connects a seated player, replacing any previous connection, and
+// resyncs them with the room's current phase
+func (r *Room) attach(playerID string, conn *roomConn) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seat := r.seat(playerID)
+	if r.closed || seat < 0 {
+		return errNotInRoom
+	}
+	p := r.players[seat]
+	if p.conn != nil {
+		p.conn.close()
+	}
+	p.conn = conn
+	p.span.AddEvent("connected")
+
+	r.sendState()
+	switch r.phase {
+	case netplay.PhaseRacing:
+		frame := r.race.Frame()
+		conn.send(netplay.RoomMessage{Type: netplay.TypeRace, Race: &frame})
+	case netplay.PhaseFinished:
+		conn.send(netplay.RoomMessage{Type: netplay.TypeResults, Results: r.results})
+	}
+	return nil
+}
+
+// detach removes conn if it's still the player's connection
+func (r *Room) detach(playerID string, conn *roomConn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seat := r.seat(playerID)
+	if seat < 0 || r.players[seat].conn != conn {
+		return
+	}
+	p := r.players[seat]
+	p.conn = nil
+	p.disconnectedAt = time.Now()
+	p.span.AddEvent("disconnected")
+	r.sendState()
+}
+
+// handle applies a command from the player in a seat. Callers don't hold r.mu.
+func (r *Room) handle(playerID string, cmd netplay.RoomCommand) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seat := r.seat(playerID)
+	if r.closed || seat < 0 {
+		return
+	}
+	p := r.players[seat]
+
+	switch cmd.Type {
+	case netplay.TypeReady:
+		if r.phase != netplay.PhaseLobby && r.phase != netplay.PhaseCountdown {
+			return
+		}
+		if p.Ready == cmd.Ready {
+			return
+		}
+		p.Ready = cmd.Ready
+		p.span.AddEvent("ready", trace.WithAttributes(attribute.Bool("room.ready", cmd.Ready)))
+		if !cmd.Ready && r.phase == netplay.PhaseCountdown {
+			r.cancelCountdown("player_unready")
+		}
+		r.sendState()
+		r.maybeStartCountdown()
+
+	case netplay.TypeInput:
+		if r.phase != netplay.PhaseRacing {
+			return
+		}
+		switch cmd.Action {
+		case game.ActionUp:
+			r.race.SetDirection(seat, game.Up)
+		case game.ActionDown:
+			r.race.SetDirection(seat, game.Down)
+		case game.ActionLeft:
+			r.race.SetDirection(seat, game.Left)
+		case game.ActionRight:
+			r.race.SetDirection(seat, game.Right)
+		}
+
+	case netplay.TypeLeave:
+		switch r.phase {
+		case netplay.PhaseLobby, netplay.PhaseCountdown:
+			r.removePlayer(seat, "left")
+		case netplay.PhaseRacing:
+			r.race.Forfeit(seat)
+			if p.conn != nil {
+				p.conn.close()
+			}
+		}
+	}
+}
+
+// maybeStartCountdown starts the countdown once enough players are all ready. Callers hold r.mu.
+func (r *Room) maybeStartCountdown() {
+	if r.phase != netplay.PhaseLobby || len(r.players) < race.MinPlayers {
+		return
+	}
+	for _, p := range r.players {
+		if !p.Ready {
+			return
+		}
+	}
+
+	r.startPhase(netplay.PhaseCountdown, attribute.Int("room.players", len(r.players)))
+	r.countdown++
+	r.sendState()
+	go r.runCountdown(r.countdown)
+}
+
+// cancelCountdown returns to the lobby. Callers hold r.mu.
+func (r *Room) cancelCountdown(reason string) {
+	r.phaseSpan.SetAttributes(attribute.String("room.cancel_reason", reason))
+	r.countdown++
+	r.startPhase(netplay.PhaseLobby)
+}
+
+// runCountdown counts down to the race unless the countdown is cancelled
+func (r *Room) runCountdown(countdown int) {
+	for remaining := countdownSeconds; remaining > 0; remaining-- {
+		r.mu.Lock()
+		if r.closed || r.countdown != countdown {
+			r.mu.Unlock()
+			return
+		}
+		r.sendAll(netplay.RoomMessage{Type: netplay.TypeCountdown, Countdown: remaining})
+		r.mu.Unlock()
+		time.Sleep(time.Second)
+	}
+
+	r.mu.Lock()
+	if r.closed || r.countdown != countdown {
+		r.mu.Unlock()
+		return
+	}
+	r.startRace()
+	r.mu.Unlock()
+
+	r.runRace()
+}
+
+// startRace seats the ready players on a freshly seeded board. Callers hold r.mu.
+func (r *Room) startRace() {
+	seed := time.Now().UnixNano()
+	names := make([]string, len(r.players))
+	for i, p := range r.players {
+		names[i] = p.Name
+	}
+	r.race = race.New(raceBoardSize, raceBoardSize, seed, names)
+
+	r.startPhase(netplay.PhaseRacing,
+		attribute.Int64("race.seed", seed),
+		attribute.Int("room.players", len(r.players)))
+	telemetry.GetLogger().InfoContext(r.ctx, "Race started", "room_id", r.ID, "players", len(r.players))
+	r.sendState()
+	r.sendFrame(nil)
+}
+
+// runRace ticks the race until it finishes or the room closes
+func (r *Room) runRace() {
+	ticker := time.NewTicker(time.Second / race.TickRate)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !r.tick() {
+			return
+		}
+	}
+}
+
+// tick advances the race and sends the new frame. Returns false once the race is over.
+func (r *Room) tick() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return false
+	}
+
+	// Racers who've been gone too long forfeit; the rest of the field keeps going
+	for seat, p := range r.players {
+		if p.conn == nil && time.Since(p.disconnectedAt) > raceForfeitTimeout {
+			r.race.Forfeit(seat)
+		}
+	}
+
+	r.race.Update()
+	events := r.race.TakeEvents()
+	r.recordEvents(events)
+	r.sendFrame(events)
+
+	if r.race.Finished {
+		r.finish()
+		return false
+	}
+	return true
+}
+
+// recordEvents adds collections and crashes to the race's span. Callers hold r.mu.
+func (r *Room) recordEvents(events []race.Event) {
+	for _, event := range events {
+		if event.Type == race.EventFinished {
+			continue
+		}
+		attrs := []attribute.KeyValue{
+			attribute.Int("room.seat", event.Seat),
+			attribute.Int("race.tick", event.Tick),
+		}
+		if event.Crash != "" {
+			attrs = append(attrs, attribute.String("race.crash", event.Crash))
+			r.players[event.Seat].span.AddEvent("crashed", trace.WithAttributes(attribute.String("race.crash", event.Crash)))
+		}
+		r.phaseSpan.AddEvent(event.Type, trace.WithAttributes(attrs...))
+	}
+}
+
+// finish moves on to the results screen. Callers hold r.mu.
+func (r *Room) finish() {
+	r.results = r.race.Results()
+	r.phaseSpan.SetAttributes(attribute.Int("race.ticks", r.race.Tick))
+
+	winner := r.results[0]
+	r.startPhase(netplay.PhaseFinished,
+		attribute.String("race.winner", r.players[winner.Seat].ID),
+		attribute.Int("race.winning_score", winner.Score))
+	racesCompleted.Add(r.ctx, 1, metric.WithAttributes(attribute.Int("players", len(r.players))))
+
+	r.sendState()
+	r.sendAll(netplay.RoomMessage{Type: netplay.TypeResults, Results: r.results})
+	telemetry.GetLogger().InfoContext(r.ctx, "Race finished",
+		"room_id", r.ID,
+		"winner", winner.Name,
+		"score", winner.Score,
+		"ticks", r.race.Tick)
+}
+
+// housekeeping drops players who left the lobby without saying so, and closes
+// the room once it's empty or its results have been up long enough
+func (r *Room) housekeeping() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			return
+		}
+
+		switch r.phase {
+		case netplay.PhaseLobby, netplay.PhaseCountdown:
+			for seat := len(r.players) - 1; seat >= 0; seat-- {
+				p := r.players[seat]
+				if p.conn == nil && time.Since(p.disconnectedAt) > lobbyLeaveTimeout {
+					r.removePlayer(seat, "disconnected")
+				}
+			}
+			if len(r.players) == 0 {
+				r.close("empty")
+			}
+		case netplay.PhaseFinished:
+			connected := slices.ContainsFunc(r.players, func(p *roomPlayer) bool { return p.conn != nil })
+			if !connected || time.Since(r.phaseStarted) > resultsTimeout {
+				r.close("finished")
+			}
+		}
+		r.mu.Unlock()
+	}
+}
+
+// close disconnects everyone and ends the room's spans. Callers hold r.mu.
+func (r *Room) close(reason string) {
+	r.closed = true
+	for _, p := range r.players {
+		if p.conn != nil {
+			p.conn.close()
+		}
+		p.span.End()
+	}
+	r.phaseSpan.End()
+	r.span.SetAttributes(attribute.String("room.close_reason", reason))
+	r.span.End()
+	r.manager.remove(r)
+
+	telemetry.GetLogger().InfoContext(r.ctx, "Room closed", "room_id", r.ID, "reason", reason)
+}
+
+// sendState sends every connected player the lobby as they see it. Callers hold r.mu.
+func (r *Room) sendState() {
+	for seat, p := range r.players {
+		if p.conn != nil {
+			p.conn.send(netplay.RoomMessage{Type: netplay.TypeRoom, Room: r.state(seat)})
+		}
+	}
+}
+
+// sendFrame sends the race's current state to every connected player. Callers hold r.mu.
+func (r *Room) sendFrame(events []race.Event) {
+	frame := r.race.Frame()
+	r.sendAll(netplay.RoomMessage{Type: netplay.TypeRace, Race: &frame, Events: events})
+}
+
+// sendAll sends a message to every connected player. Callers hold r.mu.
+func (r *Room) sendAll(msg netplay.RoomMessage) {
+	for _, p := range r.players {
+		if p.conn != nil {
+			p.conn.send(msg)
+		}
+	}
+}
+
+// roomRequest creates or joins a room
+type roomRequest struct {
+	PlayerID string `json:"player_id"`
+	Name     string `json:"name"`
+}
+
+// validate checks the player and normalizes their name
+func (req *roomRequest) validate() error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		req.Name = "Anonymous"
+	}
+	if !playerIDPattern.MatchString(req.PlayerID) || !utf8.ValidString(req.Name) || utf8.RuneCountInString(req.Name) > 24 {
+		return errors.New("invalid player or name")
+	}
+	return nil
+}
+
+// roomErrorStatus maps a room error to an HTTP status
+func roomErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errTooManyRooms), errors.Is(err, errShuttingDown):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, errUnknownRoom):
+		return http.StatusNotFound
+	case errors.Is(err, errNotInRoom):
+		return http.StatusForbidden
+	case errors.Is(err, errRoomFull), errors.Is(err, errRoomStarted), errors.Is(err, errRoomOpen):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// readRoomRequest decodes and validates a create or join request
+func readRoomRequest(r *http.Request) (roomRequest, error) {
+	var req roomRequest
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRoomRequestSize))
+	if err != nil {
+		return req, err
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return req, err
+	}
+	return req, req.validate()
+}
+
+// roomsHandler lists open rooms on GET and creates one on POST
+func roomsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := telemetry.GetLogger()
+	tracer := telemetry.GetTracer()
+
+	switch r.Method {
+	case http.MethodGet:
+		ctx, span := tracer.Start(ctx, "list_rooms")
+		defer span.End()
+
+		rooms := roomManager.List()
+		span.SetAttributes(attribute.Int("rooms.count", len(rooms)))
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(rooms); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Failed to encode rooms")
+			logger.ErrorContext(ctx, "Failed to encode rooms", "error", err)
+		}
+
+	case http.MethodPost:
+		ctx, span := tracer.Start(ctx, "create_room")
+		defer span.End()
+
+		req, err := readRoomRequest(r)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Invalid room request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		span.SetAttributes(attribute.String("player.id", req.PlayerID))
+		if !authorizePlayer(w, r, req.PlayerID) {
+			span.SetStatus(codes.Error, "Invalid player token")
+			return
+		}
+		if !allowRequest(w, roomLimiter, "ip:"+clientIP(r)) || !allowRequest(w, roomLimiter, "player:"+req.PlayerID) {
+			span.SetStatus(codes.Error, "Rate limited")
+			return
+		}
+
+		room, err := roomManager.Create(trace.LinkFromContext(ctx), req.PlayerID, req.Name)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Failed to create room")
+			http.Error(w, err.Error(), roomErrorStatus(err))
+			return
+		}
+		span.SetAttributes(attribute.String("room.id", room.ID))
+
+		room.mu.Lock()
+		state := room.state(0)
+		room.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(state); err != nil {
+			span.RecordError(err)
+			logger.ErrorContext(ctx, "Failed to encode room", "error", err)
+		}
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// joinRoomHandler seats a player in a room's lobby
+func joinRoomHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := telemetry.GetLogger()
+	tracer := telemetry.GetTracer()
+
+	ctx, span := tracer.Start(ctx, "join_room")
+	defer span.End()
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, err := readRoomRequest(r)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Invalid room request")
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	roomID := r.PathValue("room")
+	span.SetAttributes(
+		attribute.String("room.id", roomID),
+		attribute.String("player.id", req.PlayerID),
+	)
+	if !authorizePlayer(w, r, req.PlayerID) {
+		span.SetStatus(codes.Error, "Invalid player token")
+		return
+	}
+
+	room, ok := roomManager.Get(roomID)
+	if !ok {
+		http.Error(w, errUnknownRoom.Error(), http.StatusNotFound)
+		return
+	}
+	state, err := room.Join(req.PlayerID, req.Name)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to join room")
+		http.Error(w, err.Error(), roomErrorStatus(err))
+		return
+	}
+
+	logger.InfoContext(ctx, "Player joined room", "room_id", roomID, "player_id", req.PlayerID, "seat", state.You)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(state); err != nil {
+		span.RecordError(err)
+		logger.ErrorContext(ctx, "Failed to encode room", "error", err)
+	}
+}
+
+// roomSocketHandler upgrades to a WebSocket for a seated player. A dropped
+// connection reconnects the same way and is resynced.
+func roomSocketHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := telemetry.GetLogger()
+	tracer := telemetry.GetTracer()
+
+	ctx, span := tracer.Start(ctx, "room_connection")
+	defer span.End()
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	roomID := r.PathValue("room")
+	playerID := r.URL.Query().Get("player")
+	span.SetAttributes(
+		attribute.String("room.id", roomID),
+		attribute.String("player.id", playerID),
+	)
+	if !authorizePlayer(w, r, playerID) {
+		span.SetStatus(codes.Error, "Invalid player token")
+		return
+	}
+
+	room, ok := roomManager.Get(roomID)
+	if !ok {
+		http.Error(w, errUnknownRoom.Error(), http.StatusNotFound)
+		return
+	}
+	room.mu.Lock()
+	seated := room.seat(playerID) >= 0
+	room.mu.Unlock()
+	if !seated {
+		http.Error(w, errNotInRoom.Error(), http.StatusForbidden)
+		return
+	}
+
+	defer trackStream()()
+
+	ws, err := websocket.Accept(w, r, &websocket.AcceptOptions{OriginPatterns: serverConfig.OriginHosts()})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "WebSocket upgrade failed")
+		logger.WarnContext(ctx, "WebSocket upgrade failed", "error", err, "room_id", roomID)
+		return
+	}
+	ws.SetReadLimit(maxClientMessage)
+	defer closeOnShutdown(ws)()
+
+	connCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	conn := newRoomConn(ws, cancel)
+	if err := room.attach(playerID, conn); err != nil {
+		ws.Close(websocket.StatusPolicyViolation, err.Error())
+		return
+	}
+	defer room.detach(playerID, conn)
+
+	logger.InfoContext(ctx, "Room connection opened", "room_id", roomID, "player_id", playerID)
+
+	go func() {
+		if err := conn.writeLoop(connCtx); err != nil && connCtx.Err() == nil {
+			logger.WarnContext(ctx, "Room connection write failed", "error", err, "room_id", roomID)
+		}
+		cancel()
+	}()
+
+	for {
+		_, data, err := ws.Read(connCtx)
+		if err != nil {
+			break
+		}
+		var cmd netplay.RoomCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			continue
+		}
+		room.handle(playerID, cmd)
+	}
+
+	ws.Close(websocket.StatusNormalClosure, "")
+	logger.InfoContext(ctx, "Room connection closed", "room_id", roomID, "player_id", playerID)
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NathanNam/incident-commander-game/internal/game"
+	"github.com/NathanNam/incident-commander-game/internal/leaderboard"
+	"github.com/NathanNam/incident-commander-game/internal/netplay"
+	"github.com/NathanNam/incident-commander-game/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Server-authoritative play limits
+const (
+	maxPlaySessions   = 200
+	maxPlayerSessions = 3                // Sessions one player can have open at once
+	reconnectTimeout  = 60 * time.Second // How long a disconnected session waits for its player
+	finishedTimeout   = 30 * time.Second // How long a finished run waits for a restart or rollback
+)
+
+var (
+	// errTooManySessions is returned when the server is at maxPlaySessions
+	errTooManySessions = errors.New("too many active play sessions")
+	// errTooManyPlayerSessions is returned when a player is at maxPlayerSessions
+	errTooManyPlayerSessions = errors.New("too many play sessions for this player")
+)
+
+// SessionManager owns the games running on the server, one per play session
+type SessionManager struct {
+	mu       sync.Mutex
+	sessions map[string]*PlaySession
+	stopping bool
+	done     chan struct{}  // Closed to stop every session's tick goroutine
+	running  sync.WaitGroup // Tick goroutines that haven't ended their session yet
+}
+
+// NewSessionManager creates an empty session manager
+func NewSessionManager() *SessionManager {
+	return &SessionManager{sessions: make(map[string]*PlaySession), done: make(chan struct{})}
+}
+
+// PlaySession is one player's game running on the server. A tick goroutine
+// advances the game and streams frames to the player's connection.
+type PlaySession struct {
+	ID         string
+	token      string // Secret the player reconnects with
+	PlayerID   string
+	Name       string
+	Mode       string // Leaderboard mode, e.g. "classic" or "daily:2025-01-31"
+	Difficulty string
+
+	manager *SessionManager
+
+	mu             sync.Mutex
+	game           *game.Game
+	ranked         bool // Whether the current run counts for the leaderboard
+	conn           *playConn
+	disconnectedAt time.Time
+	finishedAt     time.Time  // When the current run ended; zero while it's running
+	broadcast      *Broadcast // Spectators' view of the game; nil if the hub is full
+
+	// The session span covers the whole session, with a child span per run
+	ctx     context.Context
+	span    trace.Span
+	runSpan trace.Span
+}
+
+// Create starts a new session and its tick goroutine. The game waits for the
+// player's connection to attach before it starts ticking.
+func (m *SessionManager) Create(link trace.Link, playerID, name, mode, difficulty string, opts game.Options) (*PlaySession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stopping {
+		return nil, errShuttingDown
+	}
+	if len(m.sessions) >= maxPlaySessions {
+		return nil, errTooManySessions
+	}
+	open := 0
+	for _, s := range m.sessions {
+		if s.PlayerID == playerID {
+			open++
+		}
+	}
+	if open >= maxPlayerSessions {
+		return nil, errTooManyPlayerSessions
+	}
+
+	s := &PlaySession{
+		ID:             "play_" + randomHex(8),
+		token:          randomHex(16),
+		PlayerID:       playerID,
+		Name:           name,
+		Mode:           mode,
+		Difficulty:     difficulty,
+		manager:        m,
+		game:           game.NewWithOptions(game.BoardSize, game.BoardSize, opts),
+		disconnectedAt: time.Now(),
+	}
+
+	// Sessions outlive the request that created them, so they get their own trace
+	tracer := telemetry.GetTracer()
+	s.ctx, s.span = tracer.Start(context.Background(), "play_session",
+		trace.WithNewRoot(),
+		trace.WithLinks(link),
+		trace.WithAttributes(
+			attribute.String("play.session_id", s.ID),
+			attribute.String("player.id", playerID),
+			attribute.String("play.mode", mode),
+			attribute.String("play.difficulty", difficulty),
+		))
+	s.startRun()
+	if broadcast, err := spectateHub.Start(playerID, "", name, mode, true); err == nil {
+		s.broadcast = broadcast
+	}
+
+	m.sessions[s.ID] = s
+	playSessionsActive.Add(s.ctx, 1, metric.WithAttributes(attribute.String("mode", modeLabel(mode))))
+	m.running.Add(1)
+	go s.run()
+
+	telemetry.GetLogger().InfoContext(s.ctx, "Play session created",
+		"session_id", s.ID, "player_id", playerID, "mode", mode, "difficulty", difficulty)
+	return s, nil
+}
+
+// Get returns a session if the token matches
+func (m *SessionManager) Get(id, token string) (*PlaySession, bool) {
+	m.mu.Lock()
+	s, ok := m.sessions[id]
+	m.mu.Unlock()
+	if !ok || subtle.ConstantTimeCompare([]byte(s.token), []byte(token)) != 1 {
+		return nil, false
+	}
+	return s, true
+}
+
+// Shutdown ends every session and waits for them to finish, or for ctx to end.
+// No new sessions start afterwards.
+func (m *SessionManager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	if !m.stopping {
+		m.stopping = true
+		close(m.done)
+	}
+	m.mu.Unlock()
+
+	ended := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(ended)
+	}()
+	select {
+	case <-ended:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// remove drops a session once its tick goroutine has stopped
+func (m *SessionManager) remove(s *PlaySession) {
+	m.mu.Lock()
+	delete(m.sessions, s.ID)
+	m.mu.Unlock()
+
+	playSessionsActive.Add(s.ctx, -1, metric.WithAttributes(attribute.String("mode", modeLabel(s.Mode))))
+}
+
+// run ticks the game at the current level's tick rate until the session
+// expires or the server shuts down
+func (s *PlaySession) run() {
+	defer s.manager.running.Done()
+
+	timer := time.NewTimer(s.interval())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			if reason := s.tick(); reason != "" {
+				s.end(reason)
+				return
+			}
+			timer.Reset(s.interval())
+		case <-s.manager.done:
+			s.end(endReasonShutdown)
+			return
+		}
+	}
+}
+
+// interval returns the time between ticks at the current level
+func (s *PlaySession) interval() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Duration(float64(time.Second) / game.TickRate(s.game.GetLevel()))
+}
+
+// tick advances the game and sends the new frame. The game is frozen while the
+// player is disconnected. Returns why the session should end: the player has
+// been gone too long, or left a finished run without restarting it.
+func (s *PlaySession) tick() string {
+	s.mu.Lock()
+
+	if s.conn == nil {
+		s.mu.Unlock()
+		if time.Since(s.disconnectedAt) >= reconnectTimeout {
+			return "reconnect_timeout"
+		}
+		return ""
+	}
+
+	if !s.game.IsFinished() {
+		s.finishedAt = time.Time{}
+	} else if s.finishedAt.IsZero() {
+		s.finishedAt = time.Now()
+	} else if time.Since(s.finishedAt) >= finishedTimeout {
+		s.mu.Unlock()
+		return "run_finished"
+	}
+
+	s.game.Update()
+	events := s.game.TakeEvents()
+	scores := s.recordEvents(events)
+	s.sendFrame(events)
+	s.mu.Unlock()
+
+	// Submitting writes the leaderboard to disk, so inputs don't wait on it
+	for _, score := range scores {
+		s.submitScore(score)
+	}
+	return ""
+}
+
+// sendFrame queues the current state for the player and spectators. Callers hold s.mu.
+func (s *PlaySession) sendFrame(events []game.Event) {
+	frame := s.game.Frame()
+	if s.broadcast != nil {
+		s.broadcast.PublishFrame(frame)
+	}
+	if s.conn == nil {
+		return
+	}
+	frame.Events = events
+	s.conn.send(netplay.ServerMessage{Type: netplay.TypeFrame, Ranked: s.ranked, Frame: &frame})
+}
+
+// handle applies a message from the player. Callers don't hold s.mu.
+func (s *PlaySession) handle(msg netplay.ClientMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch msg.Type {
+	case netplay.TypeInput:
+		switch msg.Action {
+		case game.ActionUp, game.ActionDown, game.ActionLeft, game.ActionRight, game.ActionPause, game.ActionRollback:
+			s.game.Apply(msg.Action)
+		default:
+			return
+		}
+	case netplay.TypeRestart:
+		s.endRun("restarted")
+		s.game.Restart()
+		s.startRun()
+	default:
+		return
+	}
+
+	// Pauses, rollbacks, and restarts show up without waiting for the next tick
+	s.sendFrame(s.game.TakeEvents())
+}
+
+// attach makes conn the session's connection, replacing any previous one,
+// and resyncs it with the full current state
+func (s *PlaySession) attach(conn *playConn, resync bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil {
+		s.conn.close()
+	}
+	s.conn = conn
+	s.span.AddEvent("connected", trace.WithAttributes(attribute.Bool("play.resync", resync)))
+
+	conn.send(netplay.ServerMessage{
+		Type:      netplay.TypeWelcome,
+		SessionID: s.ID,
+		Token:     s.token,
+		Ranked:    s.ranked,
+		Resync:    resync,
+	})
+	s.sendFrame(nil)
+}
+
+// detach removes conn if it's still the session's connection
+func (s *PlaySession) detach(conn *playConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == conn {
+		s.conn = nil
+		s.disconnectedAt = time.Now()
+		s.span.AddEvent("disconnected")
+	}
+}
+
+// startRun starts a span for the game's current run and decides whether it's
+// ranked. Only the player's first run on a daily challenge is. Callers hold s.mu
+// or haven't started the session yet.
+func (s *PlaySession) startRun() {
+	runID := s.game.GetRunID()
+	s.ranked = true
+	if daily := s.game.GetDaily(); daily != nil {
+		ranked, err := dailyAttemptStore.Start(daily.Date, s.PlayerID, runID)
+		if err != nil {
+			s.span.RecordError(err)
+			telemetry.GetLogger().ErrorContext(s.ctx, "Failed to save daily attempt", "error", err, "player_id", s.PlayerID)
+		}
+		s.ranked = ranked && err == nil
+	}
+
+	_, s.runSpan = telemetry.GetTracer().Start(s.ctx, "play_run", trace.WithAttributes(
+		attribute.String("run.id", runID),
+		attribute.Bool("run.ranked", s.ranked),
+	))
+}
+
+// endRun ends the current run's span. Callers hold s.mu.
+func (s *PlaySession) endRun(reason string) {
+	s.runSpan.SetAttributes(
+		attribute.String("run.end_reason", reason),
+		attribute.Int("run.score", s.game.GetScore()),
+		attribute.Int("run.level", s.game.GetLevel()),
+	)
+	s.runSpan.End()
+}
+
+// finishedRun is a ranked run's entry waiting to be submitted once s.mu is released
+type finishedRun struct {
+	entry leaderboard.Entry
+	span  trace.Span // The run's span
+}
+
+// recordEvents adds gameplay events to the run's span and returns the entries
+// of finished ranked runs to submit. Callers hold s.mu.
+func (s *PlaySession) recordEvents(events []game.Event) []finishedRun {
+	var runs []finishedRun
+	for _, event := range events {
+		// Turns are too frequent to be useful span events
+		if event.Type == game.EventTurn {
+			continue
+		}
+		s.runSpan.AddEvent(string(event.Type), trace.WithAttributes(
+			attribute.Int("game.level", event.Level),
+			attribute.Int("game.score", event.Score),
+		))
+
+		ended := event.Type == game.EventGameOver || event.Type == game.EventGameComplete
+		if !ended || !s.ranked {
+			continue
+		}
+		if daily := s.game.GetDaily(); daily != nil && !dailyOpen(daily.Date, time.Now()) {
+			continue
+		}
+		runs = append(runs, finishedRun{
+			entry: leaderboard.Entry{
+				RunID:      s.game.GetRunID(),
+				PlayerID:   s.PlayerID,
+				Name:       s.Name,
+				Score:      event.Score,
+				Level:      event.Level,
+				Mode:       s.Mode,
+				Difficulty: s.Difficulty,
+				CreatedAt:  time.Now().UTC(),
+			},
+			span: s.runSpan,
+		})
+	}
+	return runs
+}
+
+// submitScore records a finished run on the leaderboard. The server played the
+// run itself, so there's no replay to verify. Runs continued after a rollback
+// resubmit under the same run ID. Callers don't hold s.mu.
+func (s *PlaySession) submitScore(run finishedRun) {
+	ctx := trace.ContextWithSpan(s.ctx, run.span)
+	logger := telemetry.GetLogger()
+
+	entry := run.entry
+	rank, err := leaderboardStore.Submit(entry)
+	if err != nil {
+		run.span.RecordError(err)
+		run.span.SetStatus(codes.Error, "Failed to submit score")
+		logger.WarnContext(ctx, "Score rejected", "error", err, "player_id", s.PlayerID)
+		return
+	}
+
+	run.span.SetAttributes(attribute.Int("score.rank", rank))
+	scoreSubmissionCounter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("mode", s.Mode),
+		attribute.String("difficulty", s.Difficulty),
+	))
+	logger.InfoContext(ctx, "Score submitted by play session",
+		"session_id", s.ID,
+		"player_id", s.PlayerID,
+		"score", entry.Score,
+		"level", entry.Level,
+		"mode", s.Mode,
+		"rank", rank)
+}
+
+// end stops the session when its tick goroutine exits
+func (s *PlaySession) end(reason string) {
+	s.mu.Lock()
+	if s.conn != nil {
+		// After a shutdown the client reconnects to a new session once the server is back
+		if reason == endReasonShutdown {
+			s.conn.close()
+		} else {
+			s.conn.end(netplay.CloseSessionEnded)
+		}
+		s.conn = nil
+	}
+	s.endRun(reason)
+	s.mu.Unlock()
+
+	if s.broadcast != nil {
+		spectateHub.End(s.broadcast)
+	}
+
+	s.manager.remove(s)
+	s.span.SetAttributes(attribute.String("play.end_reason", reason))
+	s.span.End()
+	telemetry.GetLogger().InfoContext(s.ctx, "Play session ended", "session_id", s.ID, "player_id", s.PlayerID, "reason", reason)
+}
+
+// modeLabel drops the date from daily modes to keep metric attributes low-cardinality
+func modeLabel(mode string) string {
+	if strings.HasPrefix(mode, dailyModePrefix) {
+		return "daily"
+	}
+	return mode
+}
+
+// randomHex returns n random bytes as hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
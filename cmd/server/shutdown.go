@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/NathanNam/incident-commander-game/internal/telemetry"
+	"github.com/coder/websocket"
+)
+
+// endReasonShutdown is the end reason of sessions and rooms closed by a shutdown
+const endReasonShutdown = "server_shutdown"
+
+// errShuttingDown is returned for new games and rooms once shutdown has started
+var errShuttingDown = errors.New("server is shutting down")
+
+// WebSocket and event-stream handlers run until their peer leaves, so
+// http.Server.Shutdown can't drain them on its own. They register here and
+// are told to stop once the server starts shutting down.
+var (
+	serverStopping, stopServing = context.WithCancel(context.Background())
+	activeStreams               sync.WaitGroup
+)
+
+// trackStream counts a long-lived handler as active until the returned func
+// is called. Call it before upgrading, while the server still tracks the request.
+func trackStream() func() {
+	activeStreams.Add(1)
+	return activeStreams.Done
+}
+
+// closeOnShutdown closes a WebSocket with a going-away status when the server
+// shuts down, so clients can tell a restart from the game ending. The returned
+// func stops watching.
+func closeOnShutdown(ws *websocket.Conn) func() bool {
+	return context.AfterFunc(serverStopping, func() {
+		ws.Close(websocket.StatusGoingAway, "server shutting down")
+	})
+}
+
+// cancelOnShutdown returns a context that's cancelled when the server shuts
+// down, for streams that aren't WebSockets
+func cancelOnShutdown(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(serverStopping, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// waitForStreams waits for every tracked handler to return, or for ctx to end
+func waitForStreams(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		activeStreams.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shutdown stops accepting connections and drains the server within the
+// configured timeout: in-flight requests finish, streams are closed, and
+// games and rooms end so their spans are complete before telemetry is flushed.
+func shutdown(server *http.Server) {
+	logger := telemetry.GetLogger()
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), serverConfig.ShutdownTimeout)
+	defer cancel()
+
+	// Shutdown closes the listeners, then runs stopServing, then waits for
+	// ordinary requests; streams are cancelled and waited for separately
+	server.RegisterOnShutdown(stopServing)
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Warn("Requests still running at shutdown deadline", "error", err)
+	}
+	if err := waitForStreams(ctx); err != nil {
+		logger.Warn("Connections still open at shutdown deadline", "error", err)
+	}
+
+	roomManager.Shutdown()
+	if err := sessionManager.Shutdown(ctx); err != nil {
+		logger.Warn("Play sessions still running at shutdown deadline", "error", err)
+	}
+
+	logger.Info("Server drained", "duration_ms", time.Since(start).Milliseconds())
+}
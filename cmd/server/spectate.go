@@ -0,0 +1,595 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/NathanNam/incident-commander-game/internal/game"
+	"github.com/NathanNam/incident-commander-game/internal/netplay"
+	"github.com/NathanNam/incident-commander-game/internal/telemetry"
+	"github.com/coder/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Spectator limits
+const (
+	maxBroadcasts       = 500             // Games broadcast from browsers
+	maxServerBroadcasts = maxPlaySessions // Server play has its own budget, so browsers can't crowd it out
+	maxPlayerBroadcasts = 3               // Browser broadcasts one player can have open at once
+	maxIPBroadcasts     = 10              // Browser broadcasts one client IP can have open at once
+	maxSpectators       = 100             // Per session
+	spectatorBuffer     = 64              // Messages queued for a spectator before it's resynced with a keyframe
+	maxStreamMessage    = 1 << 16         // Largest keyframe a browser may send
+)
+
+// topSession is the session ID that watches the highest scoring live game
+const topSession = "top"
+
+// broadcastModePattern matches the modes browsers report for their games
+var broadcastModePattern = regexp.MustCompile(`^[a-z0-9:_-]{1,64}$`)
+
+var (
+	// errTooManySpectators is returned when a session has maxSpectators watching
+	errTooManySpectators = errors.New("too many spectators for this session")
+	// errTooManyBroadcasts is returned when the hub is at maxBroadcasts or maxServerBroadcasts
+	errTooManyBroadcasts = errors.New("too many live sessions")
+	// errTooManyClientBroadcasts is returned when a player or client IP has too many broadcasts open
+	errTooManyClientBroadcasts = errors.New("too many live sessions from this player or address")
+)
+
+// stateNames describes game states in the lobby
+var stateNames = map[game.GameState]string{
+	game.Playing:       "playing",
+	game.Paused:        "paused",
+	game.GameOver:      "game_over",
+	game.LevelComplete: "level_complete",
+	game.Rewinding:     "rewinding",
+}
+
+// SpectateHub tracks live games and fans their state out to spectators
+type SpectateHub struct {
+	mu         sync.Mutex
+	broadcasts map[string]*Broadcast
+}
+
+// NewSpectateHub creates an empty hub
+func NewSpectateHub() *SpectateHub {
+	return &SpectateHub{broadcasts: make(map[string]*Broadcast)}
+}
+
+// Broadcast is one live game that spectators can watch. Its latest frame is
+// kept so new spectators start from a keyframe.
+type Broadcast struct {
+	ID        string
+	PlayerID  string
+	Name      string
+	Mode      string
+	Server    bool // Played on the server rather than in a browser
+	StartedAt time.Time
+	ip        string // Client IP of a browser broadcast
+
+	mu         sync.Mutex
+	frame      game.StateFrame
+	hasFrame   bool
+	spectators map[*spectator]bool
+	ended      bool
+}
+
+// spectator is one watcher's queue of stream messages. The channel is closed
+// when the broadcast ends.
+type spectator struct {
+	ch chan netplay.StreamMessage
+}
+
+// LiveSession describes a live game in the lobby
+type LiveSession struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Mode       string    `json:"mode"`
+	Level      int       `json:"level"`
+	Score      int       `json:"score"`
+	State      string    `json:"state"`
+	Spectators int       `json:"spectators"`
+	Server     bool      `json:"server"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+// Start registers a new live game. Browser broadcasts are limited per player
+// and per client IP; server play is limited by the session manager.
+func (h *SpectateHub) Start(playerID, ip, name, mode string, server bool) (*Broadcast, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	servers, players, ips := 0, 0, 0
+	for _, b := range h.broadcasts {
+		if b.Server {
+			servers++
+			continue
+		}
+		if b.PlayerID == playerID {
+			players++
+		}
+		if b.ip == ip {
+			ips++
+		}
+	}
+	if server {
+		if servers >= maxServerBroadcasts {
+			return nil, errTooManyBroadcasts
+		}
+	} else {
+		if len(h.broadcasts)-servers >= maxBroadcasts {
+			return nil, errTooManyBroadcasts
+		}
+		if players >= maxPlayerBroadcasts || ips >= maxIPBroadcasts {
+			return nil, errTooManyClientBroadcasts
+		}
+	}
+
+	b := &Broadcast{
+		ID:         "live_" + randomHex(8),
+		PlayerID:   playerID,
+		Name:       name,
+		Mode:       mode,
+		Server:     server,
+		StartedAt:  time.Now().UTC(),
+		ip:         ip,
+		spectators: make(map[*spectator]bool),
+	}
+	h.broadcasts[b.ID] = b
+	return b, nil
+}
+
+// Get returns a live game by ID, or the highest scoring one for topSession
+func (h *SpectateHub) Get(id string) (*Broadcast, bool) {
+	if id == topSession {
+		sessions := h.List()
+		if len(sessions) == 0 {
+			return nil, false
+		}
+		id = sessions[0].ID
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	b, ok := h.broadcasts[id]
+	return b, ok
+}
+
+// List returns the live games that have sent a frame, highest score first
+func (h *SpectateHub) List() []LiveSession {
+	h.mu.Lock()
+	broadcasts := make([]*Broadcast, 0, len(h.broadcasts))
+	for _, b := range h.broadcasts {
+		broadcasts = append(broadcasts, b)
+	}
+	h.mu.Unlock()
+
+	sessions := make([]LiveSession, 0, len(broadcasts))
+	for _, b := range broadcasts {
+		if session, ok := b.summary(); ok {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].Score != sessions[j].Score {
+			return sessions[i].Score > sessions[j].Score
+		}
+		return sessions[i].StartedAt.Before(sessions[j].StartedAt)
+	})
+	return sessions
+}
+
+// End removes a live game and tells its spectators
+func (h *SpectateHub) End(b *Broadcast) {
+	h.mu.Lock()
+	delete(h.broadcasts, b.ID)
+	h.mu.Unlock()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ended = true
+	b.fanOut(netplay.StreamMessage{Type: netplay.TypeEnd})
+	for sp := range b.spectators {
+		close(sp.ch)
+	}
+	b.spectators = nil
+}
+
+// summary describes the game for the lobby; false until its first keyframe
+func (b *Broadcast) summary() (LiveSession, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.hasFrame {
+		return LiveSession{}, false
+	}
+	return LiveSession{
+		ID:         b.ID,
+		Name:       b.Name,
+		Mode:       b.Mode,
+		Level:      b.frame.Level,
+		Score:      b.frame.Score,
+		State:      stateNames[b.frame.State],
+		Spectators: len(b.spectators),
+		Server:     b.Server,
+		StartedAt:  b.StartedAt,
+	}, true
+}
+
+// Publish applies a keyframe or delta streamed from a browser and forwards it to spectators
+func (b *Broadcast) Publish(msg netplay.StreamMessage) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch msg.Type {
+	case netplay.TypeKeyframe:
+		if msg.Frame == nil {
+			return errors.New("keyframe has no frame")
+		}
+		if err := netplay.CheckFrame(msg.Frame); err != nil {
+			return err
+		}
+		msg.Frame.Events = nil
+		b.frame = *msg.Frame
+		b.hasFrame = true
+		b.fanOut(b.keyframe())
+
+	case netplay.TypeDelta:
+		if msg.Delta == nil || !b.hasFrame {
+			return errors.New("delta without a keyframe")
+		}
+		if err := msg.Delta.Apply(&b.frame); err != nil {
+			// Wait for the next keyframe rather than show spectators a wrong board
+			b.hasFrame = false
+			return err
+		}
+		b.fanOut(netplay.StreamMessage{Type: netplay.TypeDelta, Delta: msg.Delta})
+
+	default:
+		return fmt.Errorf("unknown stream message %q", msg.Type)
+	}
+	return nil
+}
+
+// PublishFrame forwards a frame of a game played on the server to spectators as a delta
+func (b *Broadcast) PublishFrame(frame game.StateFrame) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	frame.Events = nil
+	delta, ok := netplay.Diff(b.frame, frame)
+	b.frame = frame
+	if !ok || !b.hasFrame {
+		b.hasFrame = true
+		b.fanOut(b.keyframe())
+		return
+	}
+	if !delta.Empty() {
+		b.fanOut(netplay.StreamMessage{Type: netplay.TypeDelta, Delta: &delta})
+	}
+}
+
+// keyframe returns the current frame for spectators. Callers hold b.mu.
+func (b *Broadcast) keyframe() netplay.StreamMessage {
+	frame := b.frame
+	return netplay.StreamMessage{Type: netplay.TypeKeyframe, SessionID: b.ID, Name: b.Name, Frame: &frame}
+}
+
+// fanOut queues a message for every spectator. A spectator whose queue is full
+// has fallen behind, so its queue is replaced with a keyframe. Callers hold b.mu.
+func (b *Broadcast) fanOut(msg netplay.StreamMessage) {
+	for sp := range b.spectators {
+		select {
+		case sp.ch <- msg:
+			continue
+		default:
+		}
+
+	drain:
+		for {
+			select {
+			case <-sp.ch:
+			default:
+				break drain
+			}
+		}
+		if msg.Type == netplay.TypeEnd {
+			sp.ch <- msg
+		} else {
+			sp.ch <- b.keyframe()
+		}
+		spectatorResyncs.Add(context.Background(), 1)
+	}
+}
+
+// subscribe adds a spectator, starting it with a keyframe if there is one
+func (b *Broadcast) subscribe() (*spectator, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.ended {
+		return nil, errors.New("session has ended")
+	}
+	if len(b.spectators) >= maxSpectators {
+		return nil, errTooManySpectators
+	}
+	sp := &spectator{ch: make(chan netplay.StreamMessage, spectatorBuffer)}
+	if b.hasFrame {
+		sp.ch <- b.keyframe()
+	}
+	b.spectators[sp] = true
+	return sp, nil
+}
+
+// unsubscribe removes a spectator that stopped watching
+func (b *Broadcast) unsubscribe(sp *spectator) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.spectators, sp)
+}
+
+// broadcastHandler receives the state of a game played in a browser over a
+// WebSocket: a keyframe first, then a delta per tick
+func broadcastHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := telemetry.GetLogger()
+	tracer := telemetry.GetTracer()
+
+	ctx, span := tracer.Start(ctx, "broadcast_session")
+	defer span.End()
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	playerID := params.Get("player")
+	name := strings.TrimSpace(params.Get("name"))
+	mode := params.Get("mode")
+	if name == "" {
+		name = "Anonymous"
+	}
+	if !playerIDPattern.MatchString(playerID) || !broadcastModePattern.MatchString(mode) ||
+		!utf8.ValidString(name) || utf8.RuneCountInString(name) > 24 {
+		span.SetStatus(codes.Error, "Invalid broadcast parameters")
+		http.Error(w, "Invalid player, name, or mode", http.StatusBadRequest)
+		return
+	}
+
+	if !authorizePlayer(w, r, playerID) {
+		span.SetStatus(codes.Error, "Invalid player token")
+		return
+	}
+
+	b, err := spectateHub.Start(playerID, clientIP(r), name, mode, false)
+	if err != nil {
+		status := http.StatusServiceUnavailable
+		if errors.Is(err, errTooManyClientBroadcasts) {
+			status = http.StatusTooManyRequests
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to start broadcast")
+		http.Error(w, err.Error(), status)
+		return
+	}
+	defer spectateHub.End(b)
+
+	span.SetAttributes(
+		attribute.String("spectate.session_id", b.ID),
+		attribute.String("player.id", playerID),
+		attribute.String("spectate.mode", mode),
+	)
+
+	defer trackStream()()
+
+	ws, err := websocket.Accept(w, r, &websocket.AcceptOptions{OriginPatterns: serverConfig.OriginHosts()})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "WebSocket upgrade failed")
+		return
+	}
+	defer ws.CloseNow()
+	defer closeOnShutdown(ws)()
+	ws.SetReadLimit(maxStreamMessage)
+
+	welcome, _ := json.Marshal(netplay.StreamMessage{Type: netplay.TypeWelcome, SessionID: b.ID})
+	if err := ws.Write(ctx, websocket.MessageText, welcome); err != nil {
+		return
+	}
+	logger.InfoContext(ctx, "Broadcast started", "session_id", b.ID, "player_id", playerID, "mode", mode)
+
+	messages, rejected := 0, 0
+	for {
+		_, data, err := ws.Read(ctx)
+		if err != nil {
+			break
+		}
+		var msg netplay.StreamMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			rejected++
+			continue
+		}
+		if err := b.Publish(msg); err != nil {
+			rejected++
+			continue
+		}
+		messages++
+	}
+
+	span.SetAttributes(
+		attribute.Int("spectate.messages", messages),
+		attribute.Int("spectate.rejected", rejected),
+	)
+	logger.InfoContext(ctx, "Broadcast ended", "session_id", b.ID, "messages", messages, "rejected", rejected)
+}
+
+// spectateHandler streams a live game to a spectator over a WebSocket, or as
+// Server-Sent Events for clients that don't upgrade
+func spectateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := telemetry.GetLogger()
+	tracer := telemetry.GetTracer()
+
+	ctx, span := tracer.Start(ctx, "spectate")
+	defer span.End()
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.PathValue("session")
+	b, ok := spectateHub.Get(id)
+	if !ok {
+		span.SetStatus(codes.Error, "Unknown session")
+		http.Error(w, "No such live session", http.StatusNotFound)
+		return
+	}
+	sp, err := b.subscribe()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to subscribe")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer b.unsubscribe(sp)
+
+	transport := "sse"
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		transport = "websocket"
+	}
+	span.SetAttributes(
+		attribute.String("spectate.session_id", b.ID),
+		attribute.String("spectate.transport", transport),
+	)
+	spectatorsActive.Add(ctx, 1)
+	defer spectatorsActive.Add(ctx, -1)
+	logger.InfoContext(ctx, "Spectator joined", "session_id", b.ID, "transport", transport)
+
+	defer trackStream()()
+	if transport == "websocket" {
+		err = spectateWebSocket(ctx, w, r, sp)
+	} else {
+		streamCtx, stop := cancelOnShutdown(ctx)
+		err = spectateEvents(streamCtx, w, sp)
+		stop()
+	}
+	if err != nil && ctx.Err() == nil {
+		logger.InfoContext(ctx, "Spectator disconnected", "session_id", b.ID, "error", err)
+	}
+}
+
+// spectateWebSocket writes a spectator's messages to a WebSocket until the game ends
+func spectateWebSocket(ctx context.Context, w http.ResponseWriter, r *http.Request, sp *spectator) error {
+	// Watching is public and read-only, so wall displays may connect from any allowed origin
+	ws, err := websocket.Accept(w, r, &websocket.AcceptOptions{OriginPatterns: serverConfig.OriginHosts()})
+	if err != nil {
+		return err
+	}
+	defer ws.CloseNow()
+	defer closeOnShutdown(ws)()
+
+	// Spectators only listen; the read side just notices when they leave
+	ctx = ws.CloseRead(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-sp.ch:
+			if !ok {
+				return ws.Close(websocket.StatusNormalClosure, "session ended")
+			}
+			data, err := json.Marshal(msg)
+			if err != nil {
+				return err
+			}
+			writeCtx, cancel := context.WithTimeout(ctx, frameWriteTimeout)
+			err = ws.Write(writeCtx, websocket.MessageText, data)
+			cancel()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// spectateEvents writes a spectator's messages as Server-Sent Events until the game ends
+func spectateEvents(ctx context.Context, w http.ResponseWriter, sp *spectator) error {
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-sp.ch:
+			if !ok {
+				return nil
+			}
+			data, err := json.Marshal(msg)
+			if err != nil {
+				return err
+			}
+			rc.SetWriteDeadline(time.Now().Add(frameWriteTimeout))
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, data); err != nil {
+				return err
+			}
+			if err := rc.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// liveSessionsHandler lists live games for the lobby, highest score first
+func liveSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tracer := telemetry.GetTracer()
+
+	_, span := tracer.Start(ctx, "list_live_sessions")
+	defer span.End()
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessions := spectateHub.List()
+	span.SetAttributes(attribute.Int("spectate.live_sessions", len(sessions)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// serveLobby serves the page listing live games to watch
+func serveLobby(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tracer := telemetry.GetTracer()
+
+	_, span := tracer.Start(ctx, "serve_lobby")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("http.route", "/lobby"),
+		attribute.String("file.path", "lobby.html"),
+		attribute.String("file.source", webAssets.Source()),
+	)
+	webAssets.ServeFile(w, r, "lobby.html")
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestSpectateHubStartLimits(t *testing.T) {
+	h := NewSpectateHub()
+	start := func(playerID, ip string, server bool) error {
+		_, err := h.Start(playerID, ip, "Name", "classic", server)
+		return err
+	}
+
+	for i := 0; i < maxPlayerBroadcasts; i++ {
+		if err := start("player_a", "10.0.0.1", false); err != nil {
+			t.Fatalf("broadcast %d: %v", i, err)
+		}
+	}
+	if err := start("player_a", "10.0.0.2", false); !errors.Is(err, errTooManyClientBroadcasts) {
+		t.Errorf("broadcast over the player limit: err = %v, want %v", err, errTooManyClientBroadcasts)
+	}
+
+	for i := maxPlayerBroadcasts; i < maxIPBroadcasts; i++ {
+		if err := start(fmt.Sprintf("player_%d", i), "10.0.0.1", false); err != nil {
+			t.Fatalf("broadcast %d: %v", i, err)
+		}
+	}
+	if err := start("player_b", "10.0.0.1", false); !errors.Is(err, errTooManyClientBroadcasts) {
+		t.Errorf("broadcast over the IP limit: err = %v, want %v", err, errTooManyClientBroadcasts)
+	}
+
+	// Server play isn't counted against the player or against browser broadcasts
+	if err := start("player_a", "", true); err != nil {
+		t.Errorf("server play broadcast: %v", err)
+	}
+	for i := len(h.broadcasts) - 1; i < maxBroadcasts; i++ {
+		if err := start(fmt.Sprintf("filler_%d", i), fmt.Sprintf("10.1.%d.%d", i/256, i%256), false); err != nil {
+			t.Fatalf("broadcast %d: %v", i, err)
+		}
+	}
+	if err := start("player_c", "10.0.0.3", false); !errors.Is(err, errTooManyBroadcasts) {
+		t.Errorf("broadcast over the hub limit: err = %v, want %v", err, errTooManyBroadcasts)
+	}
+	if err := start("player_c", "", true); err != nil {
+		t.Errorf("server play broadcast with browsers at the limit: %v", err)
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NathanNam/incident-commander-game/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Limits on client timestamps, so a wrong clock or a forged item can't put
+// spans far into the past or future
+const (
+	maxClientClockSkew    = 24 * time.Hour // Client timestamps must be this close to server time
+	maxClientSpanDuration = 12 * time.Hour // Longer spans are cut short
+)
+
+// checkClientTime checks that a client timestamp is within maxClientClockSkew of now
+func checkClientTime(what string, t, now time.Time) error {
+	if t.Before(now.Add(-maxClientClockSkew)) || t.After(now.Add(maxClientClockSkew)) {
+		return fmt.Errorf("%s %s is more than %s from server time", what, t.UTC().Format(time.RFC3339), maxClientClockSkew)
+	}
+	return nil
+}
+
+// checkClientEvent validates an event from the browser and truncates long data
+func checkClientEvent(clientEvent *telemetry.ClientEvent) error {
+	if clientEvent.Type == "" {
+		return errors.New("event has no type")
+	}
+	if err := checkClientTime("event timestamp", clientEvent.Timestamp, time.Now()); err != nil {
+		return err
+	}
+	if err := validateAttributes(clientEvent.Attributes); err != nil {
+		return err
+	}
+	if len(clientEvent.Data) > serverConfig.Telemetry.MaxEventDataSize {
+		clientEvent.Data = strings.ToValidUTF8(clientEvent.Data[:serverConfig.Telemetry.MaxEventDataSize], "")
+	}
+	return nil
+}
+
+// checkClientMetric validates a metric from the browser against its declaration
+func checkClientMetric(clientMetric *telemetry.ClientMetric) error {
+	if clientMetric.Name == "" {
+		return errors.New("metric has no name")
+	}
+	if err := clientMetrics.Check(*clientMetric); err != nil {
+		return err
+	}
+	return validateAttributes(clientMetric.Labels)
+}
+
+// checkClientSpan validates a finished span from the browser and cuts it
+// short at maxClientSpanDuration
+func checkClientSpan(clientSpan *telemetry.ClientSpanData) error {
+	if clientSpan.Name == "" {
+		return errors.New("span has no name")
+	}
+	if clientSpan.EndTime.Before(clientSpan.StartTime) {
+		return errors.New("span ends before it starts")
+	}
+	now := time.Now()
+	if err := checkClientTime("span start", clientSpan.StartTime, now); err != nil {
+		return err
+	}
+	if err := checkClientTime("span end", clientSpan.EndTime, now); err != nil {
+		return err
+	}
+	if clientSpan.EndTime.Sub(clientSpan.StartTime) > maxClientSpanDuration {
+		clientSpan.EndTime = clientSpan.StartTime.Add(maxClientSpanDuration)
+	}
+	if _, err := trace.TraceIDFromHex(clientSpan.TraceID); err != nil {
+		return errors.New("span trace ID must be 32 hex digits, not all zero")
+	}
+	if _, err := trace.SpanIDFromHex(clientSpan.SpanID); err != nil {
+		return errors.New("span ID must be 16 hex digits, not all zero")
+	}
+	if clientSpan.ParentSpanID != "" {
+		if _, err := trace.SpanIDFromHex(clientSpan.ParentSpanID); err != nil {
+			return errors.New("parent span ID must be 16 hex digits, not all zero")
+		}
+	}
+	switch clientSpan.Status {
+	case "", telemetry.SpanStatusOK, telemetry.SpanStatusError:
+	default:
+		return fmt.Errorf("unknown span status %.32q", clientSpan.Status)
+	}
+	if len(clientSpan.StatusMessage) > maxAttributeValueLength {
+		clientSpan.StatusMessage = strings.ToValidUTF8(clientSpan.StatusMessage[:maxAttributeValueLength], "")
+	}
+	if len(clientSpan.Events) > telemetry.MaxSpanEvents {
+		return fmt.Errorf("%d span events, at most %d allowed", len(clientSpan.Events), telemetry.MaxSpanEvents)
+	}
+	for _, event := range clientSpan.Events {
+		if event.Name == "" || len(event.Name) > maxAttributeKeyLength {
+			return fmt.Errorf("span event name %.64q must be 1 to %d bytes", event.Name, maxAttributeKeyLength)
+		}
+		if err := checkClientTime("span event "+event.Name, event.Timestamp, now); err != nil {
+			return err
+		}
+		if err := validateAttributes(event.Attributes); err != nil {
+			return fmt.Errorf("span event %q: %w", event.Name, err)
+		}
+	}
+	return validateAttributes(clientSpan.Attributes)
+}
+
+// clientSpanFromEvent converts a "span" event, which older clients send when a
+// span ends, into span data. The event's timestamp is the span's start and its
+// duration_ms attribute gives the end.
+func clientSpanFromEvent(clientEvent telemetry.ClientEvent) telemetry.ClientSpanData {
+	attributes := make(map[string]interface{}, len(clientEvent.Attributes))
+	for k, v := range clientEvent.Attributes {
+		attributes[k] = v
+	}
+	duration, _ := attributes["duration_ms"].(float64)
+	delete(attributes, "duration_ms")
+	delete(attributes, "operation_name")
+
+	return telemetry.ClientSpanData{
+		TraceID:    clientEvent.TraceID,
+		SpanID:     clientEvent.SpanID,
+		Name:       clientEvent.Data,
+		StartTime:  clientEvent.Timestamp,
+		EndTime:    clientEvent.Timestamp.Add(time.Duration(duration * float64(time.Millisecond))),
+		SessionID:  clientEvent.SessionID,
+		Attributes: attributes,
+	}
+}
+
+// recordClientEvent logs a checked client event and records its metrics.
+// Beacons carry no session header, so the event's own IDs are preferred.
+func recordClientEvent(ctx context.Context, clientEvent telemetry.ClientEvent, sessionID, correlationID string) {
+	if clientEvent.SessionID != "" {
+		sessionID = clientEvent.SessionID
+	}
+	if clientEvent.CorrelationID != "" {
+		correlationID = clientEvent.CorrelationID
+	}
+	logger := telemetry.GetLogger()
+
+	// Log the client event with correlation info
+	logger.InfoContext(ctx, "Client telemetry event received",
+		"event_type", clientEvent.Type,
+		"session_id", sessionID,
+		"correlation_id", correlationID,
+		"level", clientEvent.Level,
+		"score", clientEvent.Score,
+		"data", clientEvent.Data,
+		"client_timestamp", clientEvent.Timestamp,
+	)
+
+	// Increment client event counter
+	clientEventCounter.Add(ctx, 1, metric.WithAttributeSet(attributePolicy.MetricAttributes(ctx,
+		attribute.String("event_type", clientEvent.Type),
+		attribute.String("session_id", sessionID),
+	)))
+
+	// Record business metrics based on event type
+	var metricType string
+	var value float64
+	switch clientEvent.Type {
+	case "level_change":
+		metricType, value = "current_level", float64(clientEvent.Level)
+	case "score_change":
+		metricType, value = "current_score", float64(clientEvent.Score)
+	case "game_start":
+		metricType, value = "game_sessions", 1
+	default:
+		return
+	}
+	gameMetricsGauge.Record(ctx, value, metric.WithAttributeSet(attributePolicy.MetricAttributes(ctx,
+		attribute.String("metric_type", metricType),
+		attribute.String("session_id", sessionID),
+	)))
+}
+
+// recordClientMetric logs a checked client metric and records it. Beacons
+// carry no session header, so the metric's own session ID is preferred.
+func recordClientMetric(ctx context.Context, clientMetric telemetry.ClientMetric, sessionID, correlationID string) {
+	if clientMetric.SessionID != "" {
+		sessionID = clientMetric.SessionID
+	}
+	logger := telemetry.GetLogger()
+
+	// Log the client metric
+	logger.InfoContext(ctx, "Client telemetry metric received",
+		"metric_name", clientMetric.Name,
+		"metric_type", clientMetric.Type,
+		"metric_unit", clientMetric.Unit,
+		"metric_value", clientMetric.Value,
+		"session_id", sessionID,
+		"correlation_id", correlationID,
+		"client_timestamp", clientMetric.Timestamp,
+	)
+
+	// Record the metric on its own instrument
+	clientMetrics.Record(ctx, clientMetric)
+}
+
+// recordClientSpan exports a checked client span as a span of the client
+// service and logs it. Beacons carry no session header, so the span's own
+// session ID is preferred.
+func recordClientSpan(ctx context.Context, clientSpan telemetry.ClientSpanData, sessionID, correlationID, userAgent string) {
+	if clientSpan.SessionID != "" {
+		sessionID = clientSpan.SessionID
+	}
+	if err := telemetry.RecordClientSpan(clientSpan, sessionID, userAgent); err != nil {
+		telemetry.GetLogger().WarnContext(ctx, "Failed to export client span",
+			"span_name", clientSpan.Name, "error", err, "session_id", sessionID)
+	}
+
+	telemetry.GetLogger().InfoContext(ctx, "Client span received",
+		"span_name", clientSpan.Name,
+		"trace_id", clientSpan.TraceID,
+		"span_id", clientSpan.SpanID,
+		"parent_span_id", clientSpan.ParentSpanID,
+		"duration_ms", clientSpan.EndTime.Sub(clientSpan.StartTime).Milliseconds(),
+		"session_id", sessionID,
+		"correlation_id", correlationID,
+	)
+}
+
+// clientTelemetryBatchHandler takes a client's buffered events, metrics and
+// spans in one request. Bad items are rejected one by one; the rest are kept.
+func clientTelemetryBatchHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tracer := telemetry.GetTracer()
+
+	ctx, span := tracer.Start(ctx, "process_client_telemetry_batch")
+	defer span.End()
+
+	body, err := readTelemetryBody(w, r)
+	if err != nil {
+		rejectTelemetry(ctx, w, r, "batch", err)
+		return
+	}
+
+	var batch telemetry.TelemetryBatch
+	if err := json.Unmarshal(body, &batch); err != nil {
+		rejectTelemetry(ctx, w, r, "batch", err)
+		return
+	}
+	if len(batch.Items) > serverConfig.Telemetry.MaxBatchItems {
+		rejectTelemetry(ctx, w, r, "batch", fmt.Errorf("%d items, at most %d allowed", len(batch.Items), serverConfig.Telemetry.MaxBatchItems))
+		return
+	}
+
+	sessionID := r.Header.Get("X-Session-ID")
+	correlationID := r.Header.Get("X-Correlation-ID")
+
+	var result telemetry.BatchResult
+	for i, item := range batch.Items {
+		if err := recordBatchItem(ctx, item, sessionID, correlationID, r.UserAgent()); err != nil {
+			result.Rejected++
+			result.Errors = append(result.Errors, telemetry.BatchError{Index: i, Error: err.Error()})
+			continue
+		}
+		result.Accepted++
+	}
+	if result.Rejected > 0 {
+		dropTelemetry(ctx, "batch", "invalid_item", result.Rejected)
+		span.SetStatus(codes.Error, "Rejected some batch items")
+		telemetry.GetLogger().WarnContext(ctx, "Rejected client telemetry batch items",
+			"rejected", result.Rejected, "first_error", result.Errors[0].Error, "session_id", sessionID)
+	}
+
+	span.SetAttributes(
+		attribute.String("client.session_id", sessionID),
+		attribute.String("client.correlation_id", correlationID),
+		attribute.Int("client.batch.items", len(batch.Items)),
+		attribute.Int("client.batch.accepted", result.Accepted),
+		attribute.Int("client.batch.rejected", result.Rejected),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// errMissingItem is returned for a batch item without the field its kind names
+var errMissingItem = errors.New("item has no data for its kind")
+
+// recordBatchItem checks and records one item of a batch
+func recordBatchItem(ctx context.Context, item telemetry.BatchItem, sessionID, correlationID, userAgent string) error {
+	switch item.Kind {
+	case telemetry.BatchEvent:
+		if item.Event == nil {
+			return errMissingItem
+		}
+		if err := checkClientEvent(item.Event); err != nil {
+			return err
+		}
+		recordClientEvent(ctx, *item.Event, sessionID, correlationID)
+	case telemetry.BatchMetric:
+		if item.Metric == nil {
+			return errMissingItem
+		}
+		if err := checkClientMetric(item.Metric); err != nil {
+			return err
+		}
+		recordClientMetric(ctx, *item.Metric, sessionID, correlationID)
+	case telemetry.BatchSpan:
+		if item.Span == nil {
+			return errMissingItem
+		}
+		if err := checkClientSpan(item.Span); err != nil {
+			return err
+		}
+		recordClientSpan(ctx, *item.Span, sessionID, correlationID, userAgent)
+	default:
+		return fmt.Errorf("unknown item kind %.32q", item.Kind)
+	}
+	return nil
+}
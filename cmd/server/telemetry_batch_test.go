@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NathanNam/incident-commander-game/internal/telemetry"
+)
+
+func TestCheckClientSpanTimes(t *testing.T) {
+	now := time.Now()
+	valid := func() telemetry.ClientSpanData {
+		return telemetry.ClientSpanData{
+			TraceID:   "4bf92f3577b34da6a3ce929d0e0e4736",
+			SpanID:    "00f067aa0ba902b7",
+			Name:      "level",
+			StartTime: now.Add(-time.Minute),
+			EndTime:   now,
+			Events:    []telemetry.ClientSpanEvent{{Name: "alert_collected", Timestamp: now.Add(-30 * time.Second)}},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(s *telemetry.ClientSpanData)
+		wantErr string // Empty if the span is accepted
+		wantEnd time.Duration
+	}{
+		{"valid", func(s *telemetry.ClientSpanData) {}, "", time.Minute},
+		{"clock a few hours fast", func(s *telemetry.ClientSpanData) {
+			s.StartTime, s.EndTime = s.StartTime.Add(3*time.Hour), s.EndTime.Add(3*time.Hour)
+			s.Events[0].Timestamp = s.Events[0].Timestamp.Add(3 * time.Hour)
+		}, "", time.Minute},
+		{"ends before it starts", func(s *telemetry.ClientSpanData) { s.EndTime = s.StartTime.Add(-time.Second) }, "ends before it starts", 0},
+		{"starts days ago", func(s *telemetry.ClientSpanData) { s.StartTime = now.AddDate(0, 0, -3) }, "span start", 0},
+		{"no start time", func(s *telemetry.ClientSpanData) { s.StartTime = time.Time{} }, "span start", 0},
+		{"ends in the future", func(s *telemetry.ClientSpanData) { s.EndTime = now.Add(48 * time.Hour) }, "span end", 0},
+		{"event long ago", func(s *telemetry.ClientSpanData) { s.Events[0].Timestamp = now.AddDate(-1, 0, 0) }, "span event alert_collected", 0},
+		{"longer than the cap", func(s *telemetry.ClientSpanData) { s.StartTime = now.Add(-20 * time.Hour) }, "", maxClientSpanDuration},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span := valid()
+			tt.modify(&span)
+			err := checkClientSpan(&span)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("checkClientSpan() = %v, want an error about %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkClientSpan() = %v, want accepted", err)
+			}
+			if d := span.EndTime.Sub(span.StartTime); d != tt.wantEnd {
+				t.Errorf("span lasts %s, want %s", d, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestCheckClientEventTime(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		timestamp time.Time
+		wantErr   bool
+	}{
+		{"now", now, false},
+		{"clock an hour slow", now.Add(-time.Hour), false},
+		{"no timestamp", time.Time{}, true},
+		{"two days ahead", now.Add(48 * time.Hour), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := telemetry.ClientEvent{Type: "game_start", Timestamp: tt.timestamp}
+			if err := checkClientEvent(&event); (err != nil) != tt.wantErr {
+				t.Errorf("checkClientEvent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/NathanNam/incident-commander-game/internal/game"
+	"github.com/NathanNam/incident-commander-game/internal/leaderboard"
+	"github.com/NathanNam/incident-commander-game/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Reasons a score submission is rejected
+const (
+	rejectUnverifiableMode       = "unverifiable_mode"
+	rejectUnverifiableDifficulty = "unverifiable_difficulty"
+	rejectInvalidReplay          = "invalid_replay"
+	rejectBoardSize              = "board_size"
+	rejectRunNotFinished         = "run_not_finished"
+	rejectScoreMismatch          = "score_mismatch"
+	rejectLevelMismatch          = "level_mismatch"
+	rejectDailyClosed            = "daily_closed"
+	rejectDailyAttemptUsed       = "daily_attempt_used"
+	rejectDailyReplayChanged     = "daily_replay_changed"
+	rejectDuplicateReplay        = "duplicate_replay"
+)
+
+// scenarioNamePattern matches scenario file names under web/scenarios
+var scenarioNamePattern = regexp.MustCompile(`^[a-z0-9-]{1,40}$`)
+
+// ScoreRejection explains why a submitted score failed verification
+type ScoreRejection struct {
+	Reason string
+	Err    error
+}
+
+func (r *ScoreRejection) Error() string {
+	return fmt.Sprintf("score rejected (%s): %v", r.Reason, r.Err)
+}
+
+// replayOptions returns the game modes a leaderboard mode was played with.
+// Fog of war doesn't change the simulation, so it's left out.
+func replayOptions(mode string) (game.Options, error) {
+	opts := game.Options{}
+
+	switch {
+	case mode == "classic":
+		return opts, nil
+
+	case strings.HasPrefix(mode, "scenario:"):
+		name := strings.TrimPrefix(mode, "scenario:")
+		if !scenarioNamePattern.MatchString(name) {
+			return opts, fmt.Errorf("invalid scenario name %q", name)
+		}
+		data, err := webAssets.ReadFile("scenarios/" + name + ".json")
+		if err != nil {
+			return opts, fmt.Errorf("unknown scenario %q", name)
+		}
+		scenario, err := game.ParseScenario(data)
+		if err != nil {
+			return opts, err
+		}
+		opts.Scenario = scenario
+		return opts, nil
+
+	case strings.HasPrefix(mode, dailyModePrefix):
+		challenge, err := game.ParseDailyDate(strings.TrimPrefix(mode, dailyModePrefix), serverSecret)
+		if err != nil {
+			return opts, err
+		}
+		opts.Daily = &challenge
+		return opts, nil
+
+	default:
+		return opts, fmt.Errorf("mode %q can't be replayed", mode)
+	}
+}
+
+// replayHash identifies a replay by its mode, difficulty, seed, board and inputs.
+// The tick count is left out since the inputs already decide how the run plays out.
+func replayHash(sub *leaderboard.Submission) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%d\n%dx%d\n", sub.Mode, sub.Difficulty, sub.Replay.Seed, sub.Replay.Width, sub.Replay.Height)
+	for _, input := range sub.Replay.Inputs {
+		fmt.Fprintf(h, "%d %s\n", input.Tick, input.Action)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// verifySubmission re-runs a submission's replay through the game engine and
+// checks that it ends with the submitted score and level
+func verifySubmission(ctx context.Context, sub *leaderboard.Submission) error {
+	tracer := telemetry.GetTracer()
+	_, span := tracer.Start(ctx, "verify_replay")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("replay.ticks", sub.Replay.Ticks),
+		attribute.Int("replay.inputs", len(sub.Replay.Inputs)),
+	)
+
+	reject := func(reason string, err error) error {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, reason)
+		span.SetAttributes(attribute.String("score.rejection_reason", reason))
+		return &ScoreRejection{Reason: reason, Err: err}
+	}
+
+	// A replay is bound to the first run that submitted it, so a verified run
+	// can't be posted again under new run IDs
+	sub.ReplayHash = replayHash(sub)
+	if run, ok := leaderboardStore.ReplayRun(sub.ReplayHash); ok && run != sub.RunID {
+		return reject(rejectDuplicateReplay, fmt.Errorf("replay was already submitted for run %s", run))
+	}
+
+	// Daily challenge scores must be the player's one ranked attempt. Other
+	// modes are only ranked as normal, since a replay can't show the player
+	// had fog of war.
+	if strings.HasPrefix(sub.Mode, dailyModePrefix) {
+		if reason, err := checkDailySubmission(sub); err != nil {
+			return reject(reason, err)
+		}
+	} else if sub.Difficulty != leaderboard.DifficultyNormal {
+		return reject(rejectUnverifiableDifficulty, fmt.Errorf("difficulty %q is only ranked for daily challenges", sub.Difficulty))
+	}
+
+	opts, err := replayOptions(sub.Mode)
+	if err != nil {
+		return reject(rejectUnverifiableMode, err)
+	}
+
+	// Every mode is played on the same board; scenarios don't have a size of
+	// their own. A bigger board has more room and more alerts.
+	if sub.Replay.Width != game.BoardSize || sub.Replay.Height != game.BoardSize {
+		return reject(rejectBoardSize, fmt.Errorf("replay board is %dx%d, not %dx%d",
+			sub.Replay.Width, sub.Replay.Height, game.BoardSize, game.BoardSize))
+	}
+
+	g, err := game.Simulate(sub.Replay, opts)
+	if err != nil {
+		return reject(rejectInvalidReplay, err)
+	}
+
+	span.SetAttributes(
+		attribute.Int("replay.score", g.GetScore()),
+		attribute.Int("replay.level", g.GetLevel()),
+	)
+
+	switch {
+	case !g.IsFinished():
+		return reject(rejectRunNotFinished, fmt.Errorf("replay is still running at tick %d", sub.Replay.Ticks))
+	case g.GetScore() != sub.Score:
+		return reject(rejectScoreMismatch, fmt.Errorf("replay scored %d, submitted %d", g.GetScore(), sub.Score))
+	case g.GetLevel() != sub.Level:
+		return reject(rejectLevelMismatch, fmt.Errorf("replay reached level %d, submitted %d", g.GetLevel(), sub.Level))
+	}
+
+	// A verified daily run is locked to what it has submitted so far
+	if strings.HasPrefix(sub.Mode, dailyModePrefix) {
+		reason, err := recordDailySubmission(sub, g)
+		if reason != "" {
+			return reject(reason, err)
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Failed to save daily attempt")
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NathanNam/incident-commander-game/internal/game"
+	"github.com/NathanNam/incident-commander-game/internal/leaderboard"
+	"github.com/NathanNam/incident-commander-game/internal/telemetry"
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv("OTEL_SDK_DISABLED", "true")
+	shutdown := telemetry.SetupInstrumentation("incident-commander-test")
+
+	serverConfig = defaultConfig()
+	var err error
+	if webAssets, err = NewAssetStore("../../web"); err != nil {
+		panic(err)
+	}
+	dataDir, err := os.MkdirTemp("", "incident-commander-test")
+	if err != nil {
+		panic(err)
+	}
+	if leaderboardStore, err = leaderboard.Open(filepath.Join(dataDir, "leaderboard.jsonl")); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	leaderboardStore.Close()
+	os.RemoveAll(dataDir)
+	shutdown()
+	os.Exit(code)
+}
+
+// wallRun plays a run on a size x size board where the commander never turns
+// and crashes into the right-hand wall
+func wallRun(t *testing.T, size int, opts game.Options) *leaderboard.Submission {
+	t.Helper()
+	opts.Seed = 42
+	g := game.NewWithOptions(size, size, opts)
+	for i := 0; i < size*2 && !g.IsFinished(); i++ {
+		g.Update()
+	}
+	if !g.IsFinished() {
+		t.Fatalf("%dx%d run didn't end", size, size)
+	}
+	return &leaderboard.Submission{
+		Entry: leaderboard.Entry{
+			Score:      g.GetScore(),
+			Level:      g.GetLevel(),
+			Difficulty: leaderboard.DifficultyNormal,
+		},
+		Replay: g.GetReplay(),
+	}
+}
+
+func TestVerifySubmissionBoardSize(t *testing.T) {
+	scenarioData, err := webAssets.ReadFile("scenarios/api-db.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scenario, err := game.ParseScenario(scenarioData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		mode       string
+		opts       game.Options
+		size       int
+		wantReason string
+	}{
+		{"classic", "classic", game.Options{}, game.BoardSize, ""},
+		{"classic on a larger board", "classic", game.Options{}, 30, rejectBoardSize},
+		{"classic on a smaller board", "classic", game.Options{}, 10, rejectBoardSize},
+		{"scenario", "scenario:api-db", game.Options{Scenario: scenario}, game.BoardSize, ""},
+		{"scenario on a larger board", "scenario:api-db", game.Options{Scenario: scenario}, 30, rejectBoardSize},
+		{"unknown scenario", "scenario:no-such-outage", game.Options{}, game.BoardSize, rejectUnverifiableMode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := wallRun(t, tt.size, tt.opts)
+			sub.Mode = tt.mode
+
+			err := verifySubmission(context.Background(), sub)
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Fatalf("verifySubmission() = %v, want accepted", err)
+				}
+				return
+			}
+			var rejection *ScoreRejection
+			if !errors.As(err, &rejection) || rejection.Reason != tt.wantReason {
+				t.Fatalf("verifySubmission() = %v, want rejection %q", err, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestVerifySubmissionDuplicateReplay(t *testing.T) {
+	sub := wallRun(t, game.BoardSize, game.Options{})
+	sub.RunID, sub.PlayerID, sub.Mode = "run_original", "player_a", "classic"
+	if err := verifySubmission(context.Background(), sub); err != nil {
+		t.Fatalf("verifySubmission() = %v, want accepted", err)
+	}
+	entry := sub.Entry
+	if _, err := leaderboardStore.Submit(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		runID      string
+		playerID   string
+		wantReason string
+	}{
+		{"same run again", "run_original", "player_a", ""},
+		{"new run ID", "run_copy", "player_a", rejectDuplicateReplay},
+		{"another player", "run_stolen", "player_b", rejectDuplicateReplay},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			again := wallRun(t, game.BoardSize, game.Options{})
+			again.RunID, again.PlayerID, again.Mode = tt.runID, tt.playerID, "classic"
+
+			err := verifySubmission(context.Background(), again)
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Fatalf("verifySubmission() = %v, want accepted", err)
+				}
+				return
+			}
+			var rejection *ScoreRejection
+			if !errors.As(err, &rejection) || rejection.Reason != tt.wantReason {
+				t.Fatalf("verifySubmission() = %v, want rejection %q", err, tt.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package achievements
+
+import (
+	"fmt"
+	"time"
+)
+
+// Condition compares a numeric event field against a value
+type Condition struct {
+	Field string // Event field name, e.g. "turns", "combo", "level", "pauses", "score"
+	Op    string // One of "<=", ">=", "=="
+	Value int
+}
+
+// Definition declares an achievement and the event that unlocks it
+type Definition struct {
+	ID          string
+	Icon        string
+	Name        string
+	Description string
+	On          string      // Event type that can unlock the achievement
+	When        []Condition // All conditions must hold for the event
+}
+
+// Definitions lists every achievement in the game
+var Definitions = []Definition{
+	{
+		ID: "first_response", Icon: "🚨", Name: "First Response",
+		Description: "Collect your first alert",
+		On:          "alert_collected",
+	},
+	{
+		ID: "steady_hands", Icon: "🧘", Name: "Steady Hands",
+		Description: "Clear a level without turning more than 10 times",
+		On:          "level_complete",
+		When:        []Condition{{Field: "turns", Op: "<=", Value: 10}},
+	},
+	{
+		ID: "combo_10", Icon: "🔥", Name: "Alert Storm",
+		Description: "Reach a 10x combo",
+		On:          "alert_collected",
+		When:        []Condition{{Field: "combo", Op: ">=", Value: 10}},
+	},
+	{
+		ID: "halfway_there", Icon: "🏔️", Name: "Halfway There",
+		Description: "Clear level 5",
+		On:          "level_complete",
+		When:        []Condition{{Field: "level", Op: ">=", Value: 5}},
+	},
+	{
+		ID: "no_coffee_break", Icon: "☕", Name: "No Coffee Break",
+		Description: "Finish level 10 without pausing",
+		On:          "game_complete",
+		When:        []Condition{{Field: "pauses", Op: "==", Value: 0}},
+	},
+	{
+		ID: "rollback_hero", Icon: "⏪", Name: "Rollback Hero",
+		Description: "Roll back a failed deploy",
+		On:          "rollback",
+	},
+}
+
+// Lookup returns the definition with the given ID
+func Lookup(id string) (Definition, bool) {
+	for _, def := range Definitions {
+		if def.ID == id {
+			return def, true
+		}
+	}
+	return Definition{}, false
+}
+
+// Matches checks if an event unlocks the achievement
+func (d Definition) Matches(eventType string, fields map[string]int) bool {
+	if eventType != d.On {
+		return false
+	}
+	for _, cond := range d.When {
+		value, ok := fields[cond.Field]
+		if !ok {
+			return false
+		}
+		switch cond.Op {
+		case "<=":
+			if value > cond.Value {
+				return false
+			}
+		case ">=":
+			if value < cond.Value {
+				return false
+			}
+		case "==":
+			if value != cond.Value {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Progress records unlocked achievements for one player
+type Progress struct {
+	PlayerID string               `json:"player_id"`
+	Unlocked map[string]time.Time `json:"unlocked"` // Achievement ID to unlock time
+}
+
+// NewProgress creates empty progress for a player
+func NewProgress(playerID string) *Progress {
+	return &Progress{PlayerID: playerID, Unlocked: make(map[string]time.Time)}
+}
+
+// Process checks an event against every definition and returns newly unlocked achievements
+func (p *Progress) Process(eventType string, fields map[string]int) []Definition {
+	var unlocked []Definition
+	for _, def := range Definitions {
+		if _, done := p.Unlocked[def.ID]; done {
+			continue
+		}
+		if def.Matches(eventType, fields) {
+			p.Unlocked[def.ID] = time.Now()
+			unlocked = append(unlocked, def)
+		}
+	}
+	return unlocked
+}
+
+// Merge adds achievements from other, keeping the earliest unlock time
+func (p *Progress) Merge(other *Progress) {
+	if p.Unlocked == nil {
+		p.Unlocked = make(map[string]time.Time)
+	}
+	for id, at := range other.Unlocked {
+		if existing, ok := p.Unlocked[id]; !ok || at.Before(existing) {
+			p.Unlocked[id] = at
+		}
+	}
+}
+
+// Validate rejects unknown achievement IDs and unlock times in the future
+func (p *Progress) Validate() error {
+	for id, at := range p.Unlocked {
+		if _, ok := Lookup(id); !ok {
+			return fmt.Errorf("unknown achievement %q", id)
+		}
+		if at.After(time.Now().Add(5 * time.Minute)) {
+			return fmt.Errorf("achievement %q unlocked in the future", id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package editor
+
+import (
+	"encoding/json"
+
+	"github.com/NathanNam/incident-commander-game/internal/game"
+)
+
+// Tool is what a click or drag paints on the board
+type Tool string
+
+const (
+	ToolObstacle   Tool = "obstacle"
+	ToolSpawn      Tool = "spawn"
+	ToolAlertZone  Tool = "alert_zone"
+	ToolSlowZone   Tool = "slow_zone"
+	ToolGate       Tool = "gate"
+	ToolTeleporter Tool = "teleporter"
+	ToolErase      Tool = "erase"
+)
+
+// Editor holds a level being edited
+type Editor struct {
+	Level         game.LevelDefinition
+	Tool          Tool
+	GateDirection game.Direction
+
+	pendingPad  *game.Position // First pad of a teleporter pair being placed
+	lastPainted *game.Position // Last cell painted during a drag
+}
+
+// New creates an editor with an empty level of the given size
+func New(width, height int) *Editor {
+	return Load(&game.LevelDefinition{
+		Version:      game.LevelFormatVersion,
+		Name:         "Untitled incident",
+		Width:        width,
+		Height:       height,
+		Spawn:        game.Position{X: width / 2, Y: height / 2},
+		Direction:    game.Right,
+		AlertsNeeded: 5,
+	})
+}
+
+// Load creates an editor for an existing level
+func Load(def *game.LevelDefinition) *Editor {
+	return &Editor{
+		Level:         *def,
+		Tool:          ToolObstacle,
+		GateDirection: game.Right,
+	}
+}
+
+// SetTool switches the active tool, abandoning a half-placed teleporter
+func (e *Editor) SetTool(tool Tool) {
+	e.Tool = tool
+	e.pendingPad = nil
+}
+
+// GridSize returns the board size in cells
+func (e *Editor) GridSize() (int, int) {
+	return e.Level.Width, e.Level.Height
+}
+
+// PaintCell applies the active tool to a cell. Drags only paint area tools and
+// skip the cell that was just painted.
+func (e *Editor) PaintCell(x, y int, dragging bool) {
+	pos := game.Position{X: x, Y: y}
+	if x < 0 || x >= e.Level.Width || y < 0 || y >= e.Level.Height {
+		return
+	}
+
+	if dragging {
+		if e.lastPainted != nil && *e.lastPainted == pos {
+			return
+		}
+		switch e.Tool {
+		case ToolObstacle, ToolAlertZone, ToolSlowZone, ToolErase:
+		default:
+			return
+		}
+	}
+	e.lastPainted = &pos
+
+	switch e.Tool {
+	case ToolObstacle:
+		if !dragging && contains(e.Level.Obstacles, pos) {
+			e.clear(pos)
+			return
+		}
+		e.clear(pos)
+		e.Level.Obstacles = append(e.Level.Obstacles, pos)
+
+	case ToolAlertZone:
+		if !dragging && contains(e.Level.AlertZones, pos) {
+			e.clear(pos)
+			return
+		}
+		e.clear(pos)
+		e.Level.AlertZones = append(e.Level.AlertZones, pos)
+
+	case ToolSlowZone:
+		if !dragging && contains(e.Level.SlowZones, pos) {
+			e.clear(pos)
+			return
+		}
+		e.clear(pos)
+		e.Level.SlowZones = append(e.Level.SlowZones, pos)
+
+	case ToolSpawn:
+		// Clicking the spawn point again rotates the starting direction
+		if e.Level.Spawn == pos {
+			e.Level.Direction = rotate(e.Level.Direction)
+			return
+		}
+		e.clear(pos)
+		e.Level.Spawn = pos
+
+	case ToolGate:
+		// Clicking a gate again rotates it
+		for i, gate := range e.Level.Gates {
+			if gate.Position == pos {
+				e.Level.Gates[i].Direction = rotate(gate.Direction)
+				return
+			}
+		}
+		e.clear(pos)
+		e.Level.Gates = append(e.Level.Gates, game.Gate{Position: pos, Direction: e.GateDirection})
+
+	case ToolTeleporter:
+		if e.pendingPad == nil {
+			e.clear(pos)
+			e.pendingPad = &pos
+			return
+		}
+		if *e.pendingPad == pos {
+			return
+		}
+		e.clear(pos)
+		e.Level.Teleporters = append(e.Level.Teleporters, game.Teleporter{A: *e.pendingPad, B: pos})
+		e.pendingPad = nil
+
+	case ToolErase:
+		e.clear(pos)
+	}
+}
+
+// EndStroke finishes a click or drag
+func (e *Editor) EndStroke() {
+	e.lastPainted = nil
+}
+
+// PendingPad returns the first pad of a teleporter pair being placed, if any
+func (e *Editor) PendingPad() *game.Position {
+	return e.pendingPad
+}
+
+// clear removes everything at a cell; removing one teleporter pad removes its pair
+func (e *Editor) clear(pos game.Position) {
+	e.Level.Obstacles = without(e.Level.Obstacles, pos)
+	e.Level.AlertZones = without(e.Level.AlertZones, pos)
+	e.Level.SlowZones = without(e.Level.SlowZones, pos)
+
+	gates := e.Level.Gates[:0]
+	for _, gate := range e.Level.Gates {
+		if gate.Position != pos {
+			gates = append(gates, gate)
+		}
+	}
+	e.Level.Gates = gates
+
+	teleporters := e.Level.Teleporters[:0]
+	for _, tp := range e.Level.Teleporters {
+		if tp.A != pos && tp.B != pos {
+			teleporters = append(teleporters, tp)
+		}
+	}
+	e.Level.Teleporters = teleporters
+
+	if e.pendingPad != nil && *e.pendingPad == pos {
+		e.pendingPad = nil
+	}
+}
+
+// Preview returns a paused game showing the level layout, for rendering
+func (e *Editor) Preview() *game.Game {
+	return game.PreviewLevel(&e.Level)
+}
+
+// Validate runs the solvability checks on the level
+func (e *Editor) Validate() error {
+	return game.ValidateLevel(&e.Level)
+}
+
+// Export validates the level and encodes it in the shareable level format
+func (e *Editor) Export() ([]byte, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(e.Level, "", "  ")
+}
+
+// rotate turns a direction clockwise
+func rotate(d game.Direction) game.Direction {
+	switch d {
+	case game.Up:
+		return game.Right
+	case game.Right:
+		return game.Down
+	case game.Down:
+		return game.Left
+	default:
+		return game.Up
+	}
+}
+
+func contains(cells []game.Position, pos game.Position) bool {
+	for _, c := range cells {
+		if c == pos {
+			return true
+		}
+	}
+	return false
+}
+
+func without(cells []game.Position, pos game.Position) []game.Position {
+	result := cells[:0]
+	for _, c := range cells {
+		if c != pos {
+			result = append(result, c)
+		}
+	}
+	return result
+}
@@ -0,0 +1,107 @@
+package game
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// DailyDateFormat is the layout of daily challenge dates (UTC)
+const DailyDateFormat = "2006-01-02"
+
+// Daily challenge difficulty presets
+const (
+	DailyNormal = "normal"
+	DailyHard   = "hard" // Fog of war
+)
+
+// Daily challenge rule modifiers
+const (
+	ModifierNoRollbacks = "no_rollbacks" // The run has no rollbacks
+	ModifierHeadStart   = "head_start"   // The run starts at level 3
+)
+
+// headStartLevel is the level a head start begins on
+const headStartLevel = 3
+
+// DailyChallenge is the shared board for one day. Everyone playing it gets the
+// same seed, difficulty, and rule modifiers.
+type DailyChallenge struct {
+	Date       string   `json:"date"`
+	Seed       int64    `json:"seed"`
+	Difficulty string   `json:"difficulty"`
+	Modifiers  []string `json:"modifiers"`
+}
+
+// DailyChallengeFor derives the challenge for a date from an HMAC of the date
+// under the server's secret, so nobody can work out a future day's board
+func DailyChallengeFor(date time.Time, secret []byte) DailyChallenge {
+	day := date.UTC().Format(DailyDateFormat)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("incident-commander-daily:" + day))
+	sum := mac.Sum(nil)
+
+	d := DailyChallenge{
+		Date:       day,
+		Seed:       int64(binary.BigEndian.Uint64(sum[:8])>>1) | 1, // Positive and never 0
+		Difficulty: DailyNormal,
+		Modifiers:  []string{},
+	}
+	if sum[8]%3 == 0 {
+		d.Difficulty = DailyHard
+	}
+	if sum[9]&1 != 0 {
+		d.Modifiers = append(d.Modifiers, ModifierNoRollbacks)
+	}
+	if sum[9]&2 != 0 {
+		d.Modifiers = append(d.Modifiers, ModifierHeadStart)
+	}
+	return d
+}
+
+// ParseDailyDate parses a challenge date and returns its challenge
+func ParseDailyDate(day string, secret []byte) (DailyChallenge, error) {
+	date, err := time.Parse(DailyDateFormat, day)
+	if err != nil {
+		return DailyChallenge{}, fmt.Errorf("invalid daily challenge date %q", day)
+	}
+	return DailyChallengeFor(date, secret), nil
+}
+
+// HasModifier checks if the challenge uses a rule modifier
+func (d *DailyChallenge) HasModifier(modifier string) bool {
+	for _, m := range d.Modifiers {
+		if m == modifier {
+			return true
+		}
+	}
+	return false
+}
+
+// options fixes the seed and fog of war for the challenge
+func (d *DailyChallenge) options(opts Options) Options {
+	opts.Seed = d.Seed
+	if d.Difficulty == DailyHard {
+		opts.FogRadius = DefaultFogRadius
+	}
+	return opts
+}
+
+// applyDailyModifiers changes the starting conditions before the first level is laid out
+func (g *Game) applyDailyModifiers(d *DailyChallenge) {
+	if d.HasModifier(ModifierNoRollbacks) {
+		g.RollbacksLeft = 0
+	}
+	if d.HasModifier(ModifierHeadStart) {
+		g.Level = headStartLevel
+		g.AlertsNeeded = 5 + (g.Level - 1)
+	}
+
+	g.logGameMetric("daily_challenge", d.Date,
+		fmt.Sprintf("Difficulty: %s, modifiers: %v", d.Difficulty, d.Modifiers))
+}
+
+// GetDaily returns the daily challenge being played, or nil outside daily mode
+func (g *Game) GetDaily() *DailyChallenge { return g.options.Daily }
@@ -0,0 +1,58 @@
+package game
+
+// EventType identifies a gameplay event
+type EventType string
+
+const (
+	EventAlertCollected EventType = "alert_collected"
+	EventTurn           EventType = "turn"
+	EventPause          EventType = "pause"
+	EventLevelComplete  EventType = "level_complete"
+	EventGameComplete   EventType = "game_complete"
+	EventGameOver       EventType = "game_over"
+	EventRollback       EventType = "rollback"
+)
+
+// Event is a gameplay event for consumers such as achievements
+type Event struct {
+	Type   EventType `json:"type"`
+	Level  int       `json:"level"`
+	Score  int       `json:"score"`
+	Combo  int       `json:"combo,omitempty"` // Combo multiplier of a collected alert
+	Turns  int       `json:"turns"`           // Turns made so far on the current level
+	Pauses int       `json:"pauses"`          // Pauses made so far in this run
+}
+
+// Fields returns the event's numeric values by name for declarative matching
+func (e Event) Fields() map[string]int {
+	return map[string]int{
+		"level":  e.Level,
+		"score":  e.Score,
+		"combo":  e.Combo,
+		"turns":  e.Turns,
+		"pauses": e.Pauses,
+	}
+}
+
+// maxPendingEvents bounds the event queue when nobody drains it
+const maxPendingEvents = 256
+
+// emit queues an event, filling in the current level, score, and run statistics
+func (g *Game) emit(e Event) {
+	e.Level = g.Level
+	e.Score = g.Score
+	e.Turns = g.turnsThisLevel
+	e.Pauses = g.pauseCount
+
+	if len(g.events) >= maxPendingEvents {
+		g.events = g.events[1:]
+	}
+	g.events = append(g.events, e)
+}
+
+// TakeEvents returns and clears the events queued since the last call
+func (g *Game) TakeEvents() []Event {
+	events := g.events
+	g.events = nil
+	return events
+}
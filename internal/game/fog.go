@@ -0,0 +1,149 @@
+package game
+
+import "math"
+
+// DefaultFogRadius is the visibility radius used when fog of war is enabled without a radius
+const DefaultFogRadius = 4
+
+// PagerPing marks an alert outside the visible area at the board edge
+type PagerPing struct {
+	Edge   Position // Board edge cell between the commander and the alert
+	DX, DY float64  // Unit vector from the commander toward the alert
+}
+
+// visibility caches the visible cells for one commander position, direction, and level
+type visibility struct {
+	commander Position
+	direction Direction
+	level     int
+	cells     []bool
+}
+
+// SetFogRadius enables fog of war with the given visibility radius; 0 disables it
+func (g *Game) SetFogRadius(radius int) {
+	g.FogRadius = max(0, radius)
+	g.options.FogRadius = g.FogRadius
+	g.fog = nil
+
+	g.logGameMetric("fog_of_war", g.FogRadius, "Visibility radius updated (0 = disabled)")
+}
+
+// FogEnabled reports whether fog of war limits what the player can see
+func (g *Game) FogEnabled() bool { return g.FogRadius > 0 }
+
+// IsVisible checks if a cell is within the visibility radius or the commander's line of sight.
+// Every cell is visible when fog of war is disabled.
+func (g *Game) IsVisible(pos Position) bool {
+	if !g.FogEnabled() {
+		return true
+	}
+	if pos.X < 0 || pos.X >= g.Width || pos.Y < 0 || pos.Y >= g.Height {
+		return false
+	}
+	return g.visibleCells()[pos.Y*g.Width+pos.X]
+}
+
+// VisibleAlerts returns the alerts the player can currently see
+func (g *Game) VisibleAlerts() []Position {
+	visible := make([]Position, 0, len(g.Alerts))
+	for _, alert := range g.Alerts {
+		if g.IsVisible(alert) {
+			visible = append(visible, alert)
+		}
+	}
+	return visible
+}
+
+// PagerPings returns edge markers pointing toward alerts hidden by fog of war
+func (g *Game) PagerPings() []PagerPing {
+	if !g.FogEnabled() {
+		return nil
+	}
+
+	pings := make([]PagerPing, 0, len(g.Alerts))
+	for _, alert := range g.Alerts {
+		if g.IsVisible(alert) {
+			continue
+		}
+
+		dx := float64(alert.X - g.Commander.X)
+		dy := float64(alert.Y - g.Commander.Y)
+		length := math.Hypot(dx, dy)
+		if length == 0 {
+			continue
+		}
+		dx, dy = dx/length, dy/length
+
+		pings = append(pings, PagerPing{Edge: g.edgeCell(dx, dy), DX: dx, DY: dy})
+	}
+	return pings
+}
+
+// edgeCell projects a ray from the commander onto the board edge
+func (g *Game) edgeCell(dx, dy float64) Position {
+	cx, cy := float64(g.Commander.X), float64(g.Commander.Y)
+
+	// Distance along the ray to the nearest vertical and horizontal edge
+	t := math.Inf(1)
+	if dx > 0 {
+		t = math.Min(t, (float64(g.Width-1)-cx)/dx)
+	} else if dx < 0 {
+		t = math.Min(t, -cx/dx)
+	}
+	if dy > 0 {
+		t = math.Min(t, (float64(g.Height-1)-cy)/dy)
+	} else if dy < 0 {
+		t = math.Min(t, -cy/dy)
+	}
+
+	x := int(math.Round(cx + t*dx))
+	y := int(math.Round(cy + t*dy))
+	return Position{X: min(max(x, 0), g.Width-1), Y: min(max(y, 0), g.Height-1)}
+}
+
+// visibleCells returns the visibility grid, recomputing it when the commander moves or turns
+func (g *Game) visibleCells() []bool {
+	if g.fog != nil && g.fog.commander == g.Commander &&
+		g.fog.direction == g.Direction && g.fog.level == g.Level {
+		return g.fog.cells
+	}
+
+	cells := make([]bool, g.Width*g.Height)
+	radiusSq := g.FogRadius * g.FogRadius
+
+	// Everything within the radius
+	for y := 0; y < g.Height; y++ {
+		for x := 0; x < g.Width; x++ {
+			dx, dy := x-g.Commander.X, y-g.Commander.Y
+			if dx*dx+dy*dy <= radiusSq {
+				cells[y*g.Width+x] = true
+			}
+		}
+	}
+
+	// Line of sight straight ahead until an obstacle blocks it
+	pos := g.Commander
+	for {
+		pos = step(pos, g.Direction)
+		if pos.X < 0 || pos.X >= g.Width || pos.Y < 0 || pos.Y >= g.Height {
+			break
+		}
+		cells[pos.Y*g.Width+pos.X] = true
+		if g.isObstacle(pos) {
+			break
+		}
+	}
+
+	g.fog = &visibility{commander: g.Commander, direction: g.Direction, level: g.Level, cells: cells}
+	return cells
+}
+
+// isObstacle checks if a position holds an obstacle
+func (g *Game) isObstacle(pos Position) bool {
+	for _, obstacle := range g.Obstacles {
+		if obstacle == pos {
+			return true
+		}
+	}
+	return false
+}
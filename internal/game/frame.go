@@ -0,0 +1,124 @@
+package game
+
+import (
+	"slices"
+	"time"
+)
+
+// StateFrame is everything a client needs to render a game that runs elsewhere,
+// e.g. on the server in server-authoritative play
+type StateFrame struct {
+	Tick            int             `json:"tick"`
+	RunID           string          `json:"run_id"`
+	Width           int             `json:"width"`
+	Height          int             `json:"height"`
+	Commander       Position        `json:"commander"`
+	Direction       Direction       `json:"direction"`
+	Trail           []Position      `json:"trail"`
+	Alerts          []Position      `json:"alerts"`
+	AlertServices   []string        `json:"alert_services,omitempty"` // Service of each alert in scenario mode
+	Obstacles       []Position      `json:"obstacles"`
+	Teleporters     []Teleporter    `json:"teleporters,omitempty"`
+	Gates           []Gate          `json:"gates,omitempty"`
+	SlowZones       []Position      `json:"slow_zones,omitempty"`
+	State           GameState       `json:"state"`
+	Score           int             `json:"score"`
+	Level           int             `json:"level"`
+	AlertsCollected int             `json:"alerts_collected"`
+	AlertsNeeded    int             `json:"alerts_needed"`
+	RollbacksLeft   int             `json:"rollbacks_left"`
+	CanRollback     bool            `json:"can_rollback"`
+	RewindPath      []Position      `json:"rewind_path,omitempty"`
+	FogRadius       int             `json:"fog_radius,omitempty"`
+	Scenario        *Scenario       `json:"scenario,omitempty"`
+	Daily           *DailyChallenge `json:"daily,omitempty"`
+	Events          []Event         `json:"events,omitempty"` // Events since the previous frame
+}
+
+// Frame captures the game's current state for rendering elsewhere. The frame
+// shares no memory with the game, so it can be encoded after the game moves on.
+func (g *Game) Frame() StateFrame {
+	f := StateFrame{
+		Tick:            g.tick,
+		RunID:           g.runID,
+		Width:           g.Width,
+		Height:          g.Height,
+		Commander:       g.Commander,
+		Direction:       g.Direction,
+		Trail:           slices.Clone(g.Trail),
+		Alerts:          slices.Clone(g.Alerts),
+		Obstacles:       slices.Clone(g.Obstacles),
+		Teleporters:     slices.Clone(g.Teleporters),
+		Gates:           slices.Clone(g.Gates),
+		SlowZones:       slices.Clone(g.SlowZones),
+		State:           g.State,
+		Score:           g.Score,
+		Level:           g.Level,
+		AlertsCollected: g.AlertsCollected,
+		AlertsNeeded:    g.AlertsNeeded,
+		RollbacksLeft:   g.RollbacksLeft,
+		CanRollback:     g.CanRollback(),
+		RewindPath:      slices.Clone(g.RewindPath),
+		FogRadius:       g.FogRadius,
+		Scenario:        g.Scenario,
+		Daily:           g.options.Daily,
+	}
+	if g.Scenario != nil {
+		f.AlertServices = make([]string, len(g.Alerts))
+		for i, alert := range g.Alerts {
+			f.AlertServices[i] = g.alertServices[alert]
+		}
+	}
+	return f
+}
+
+// ApplyFrame replaces the game's state with a frame received from the game's
+// owner. The game is only rendered afterwards, never updated.
+func (g *Game) ApplyFrame(f StateFrame) {
+	if f.State == Rewinding && g.State != Rewinding {
+		g.RewindStart = time.Now()
+	}
+
+	g.tick = f.Tick
+	g.runID = f.RunID
+	g.Width, g.Height = f.Width, f.Height
+	g.Commander = f.Commander
+	g.Direction = f.Direction
+	g.Trail = f.Trail
+	g.Alerts = f.Alerts
+	g.Obstacles = f.Obstacles
+	g.Teleporters = f.Teleporters
+	g.Gates = f.Gates
+	g.SlowZones = f.SlowZones
+	g.State = f.State
+	g.Score = f.Score
+	g.Level = f.Level
+	g.AlertsCollected = f.AlertsCollected
+	g.AlertsNeeded = f.AlertsNeeded
+	g.RollbacksLeft = f.RollbacksLeft
+	g.RewindPath = f.RewindPath
+	g.FogRadius = f.FogRadius
+	g.fog = nil
+	g.Scenario = f.Scenario
+	g.options.Scenario = f.Scenario
+	g.options.FogRadius = f.FogRadius
+	g.options.Daily = f.Daily
+
+	// There are no local snapshots; mirror whether the owner can roll back
+	g.rewind = rewindBuffer{}
+	if f.CanRollback {
+		g.rewind.count = 1
+	}
+
+	g.alertServices = nil
+	if f.Scenario != nil {
+		g.alertServices = make(map[Position]string, len(f.Alerts))
+		for i, alert := range f.Alerts {
+			if i < len(f.AlertServices) {
+				g.alertServices[alert] = f.AlertServices[i]
+			}
+		}
+	}
+
+	g.events = append(g.events, f.Events...)
+}
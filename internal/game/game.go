@@ -2,8 +2,8 @@ package game
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
-	"syscall/js"
 	"time"
 )
 
@@ -19,7 +19,8 @@ const (
 
 // Position represents a coordinate on the game grid
 type Position struct {
-	X, Y int
+	X int `json:"x"`
+	Y int `json:"y"`
 }
 
 // GameState represents the current state of the game
@@ -30,8 +31,22 @@ const (
 	Paused
 	GameOver
 	LevelComplete
+	Rewinding // Playing the rollback animation after a collision
 )
 
+// BoardSize is the width and height of the board every ranked game is played
+// on, in the browser and on the server
+const BoardSize = 20
+
+// Options configures optional game modes that persist across restarts
+type Options struct {
+	Scenario  *Scenario        // Scenario mode; nil for classic mode
+	FogRadius int              // Fog of war visibility radius; 0 disables it
+	Level     *LevelDefinition // Hand-made level from the editor; nil for the 10 built-in levels
+	Seed      int64            // Seeds level layouts and alert spawns; 0 picks a random seed
+	Daily     *DailyChallenge  // Daily challenge; overrides the seed and fog of war
+}
+
 // Game represents the main game structure
 type Game struct {
 	Width, Height     int
@@ -39,6 +54,9 @@ type Game struct {
 	Trail             []Position
 	Alerts            []Position
 	Obstacles         []Position
+	Teleporters       []Teleporter
+	Gates             []Gate
+	SlowZones         []Position
 	Direction         Direction
 	State             GameState
 	Score             int
@@ -49,6 +67,44 @@ type Game struct {
 	LastUpdate        time.Time
 	LevelCompleteTime time.Time // Time when level was completed
 
+	slowSkip   bool       // Alternates while the commander is in a slow zone
+	alertZones []Position // Cells alerts may spawn in; empty means anywhere
+
+	// Scenario mode (nil in classic mode)
+	Scenario      *Scenario
+	alertServices map[Position]string
+	scenarioTicks int
+
+	// Fog of war (FogRadius 0 means disabled)
+	FogRadius int
+	fog       *visibility
+
+	// Rollbacks undo a collision by restoring a recent snapshot
+	RollbacksLeft int
+	RewindStart   time.Time  // Time when the rewinding animation started
+	RewindPath    []Position // Positions undone by the current rollback, newest first
+	rewind        rewindBuffer
+	rewindTick    int
+	rolledBack    bool      // Waiting for the player to resume after a rollback
+	restoredDir   Direction // Direction the rollback restored, which a new direction can't reverse
+
+	// Event queue and statistics for consumers such as achievements
+	events         []Event
+	turnsThisLevel int
+	pauseCount     int
+	completed      bool // All levels cleared
+
+	options Options
+	runID   string // Identifies this run, e.g. for leaderboard submissions
+
+	// Deterministic simulation so the server can replay a run from its seed and inputs
+	seed              int64
+	rng               *rand.Rand
+	tick              int // Number of Update calls so far
+	levelStartTick    int
+	levelCompleteTick int
+	inputs            []Input
+
 	// Instrumentation fields
 	moveCount       int64
 	collisionChecks int64
@@ -56,18 +112,20 @@ type Game struct {
 	gameOverCount   int64
 }
 
-// logGameMetric logs a game metric to console for observability
-func (g *Game) logGameMetric(metric string, value interface{}, context string) {
-	if js.Global().Get("console").Truthy() {
-		js.Global().Get("console").Call("log",
-			fmt.Sprintf("[GAME_METRIC] %s: %v - Level: %d, Score: %d, Context: %s",
-				metric, value, g.Level, g.Score, context))
-	}
+// New creates a new classic game instance
+func New(width, height int) *Game {
+	return NewWithOptions(width, height, Options{})
 }
 
-// New creates a new game instance
-func New(width, height int) *Game {
-	rand.Seed(time.Now().UnixNano())
+// NewWithOptions creates a new game instance with optional modes enabled
+func NewWithOptions(width, height int, opts Options) *Game {
+	if opts.Daily != nil {
+		opts = opts.Daily.options(opts)
+	}
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
 
 	g := &Game{
 		Width:             width,
@@ -76,6 +134,9 @@ func New(width, height int) *Game {
 		Trail:             make([]Position, 0),
 		Alerts:            make([]Position, 0),
 		Obstacles:         make([]Position, 0),
+		Teleporters:       make([]Teleporter, 0),
+		Gates:             make([]Gate, 0),
+		SlowZones:         make([]Position, 0),
 		Direction:         Right,
 		State:             Playing,
 		Score:             0,
@@ -85,6 +146,10 @@ func New(width, height int) *Game {
 		StartTime:         time.Now(),
 		LastUpdate:        time.Now(),
 		LevelCompleteTime: time.Time{}, // Initialize to zero time
+		RollbacksLeft:     MaxRollbacks,
+		runID:             fmt.Sprintf("run_%x", rand.Int63()),
+		seed:              seed,
+		rng:               rand.New(rand.NewSource(seed)),
 
 		// Initialize instrumentation counters
 		moveCount:       0,
@@ -95,36 +160,78 @@ func New(width, height int) *Game {
 
 	g.logGameMetric("game_created", fmt.Sprintf("%dx%d", width, height), "New game instance")
 
+	if opts.Daily != nil {
+		g.applyDailyModifiers(opts.Daily)
+	}
+
 	g.spawnAlerts()
 	g.setupLevel()
 
+	// Keep the options so restarts use the same modes
+	opts.Seed = seed
+	g.options = opts
+
+	if opts.Level != nil {
+		g.loadLevel(opts.Level)
+	}
+	if opts.Scenario != nil {
+		g.SetScenario(opts.Scenario)
+	}
+	if opts.FogRadius > 0 {
+		g.SetFogRadius(opts.FogRadius)
+	}
+
 	return g
 }
 
 // Update updates the game state
 func (g *Game) Update() {
-	now := time.Now()
-	g.LastUpdate = now
+	g.tick++
+	g.LastUpdate = time.Now()
 
-	// Always check level completion for timer-based transitions
+	// Always check level completion and rewinds for timer-based transitions
 	g.checkLevelComplete()
+	g.checkRewindComplete()
 
 	// Only move and check collisions when playing
 	if g.State != Playing {
 		return
 	}
 
-	// Move commander
-	g.moveCommander()
+	// Remember this tick so a collision can be rolled back
+	g.saveSnapshot()
+
+	// Move commander, skipping collision checks on slow zone pauses
+	if !g.moveCommander() {
+		return
+	}
 
 	// Check collisions
 	g.checkCollisions()
+
+	// Open root causes keep spawning symptoms
+	if g.State == Playing {
+		g.updateScenario()
+	}
 }
 
-// moveCommander moves the commander in the current direction
-func (g *Game) moveCommander() {
-	// Add current position to trail
-	g.Trail = append(g.Trail, g.Commander)
+// moveCommander moves the commander in the current direction.
+// Returns false if the move was skipped by a slow zone.
+func (g *Game) moveCommander() bool {
+	// Slow zones skip movement on alternate ticks
+	if g.isSlowZone(g.Commander) {
+		g.slowSkip = !g.slowSkip
+		if g.slowSkip {
+			return false
+		}
+	} else {
+		g.slowSkip = false
+	}
+
+	// Add current position to trail (teleporter pads and gates stay reusable)
+	if !g.isTransitTile(g.Commander) {
+		g.Trail = append(g.Trail, g.Commander)
+	}
 
 	// Move commander
 	switch g.Direction {
@@ -138,6 +245,13 @@ func (g *Game) moveCommander() {
 		g.Commander.X++
 	}
 
+	// Teleport to the linked pad, keeping the current direction
+	if exit, ok := g.teleportExit(g.Commander); ok {
+		g.logGameMetric("teleport", fmt.Sprintf("(%d,%d)->(%d,%d)", g.Commander.X, g.Commander.Y, exit.X, exit.Y),
+			"Commander used a teleporter")
+		g.Commander = exit
+	}
+
 	// Track movement metrics
 	g.moveCount++
 
@@ -146,6 +260,8 @@ func (g *Game) moveCommander() {
 		g.logGameMetric("moves_total", g.moveCount, "Commander movement tracking")
 		g.logGameMetric("trail_length", len(g.Trail), "Current trail size")
 	}
+
+	return true
 }
 
 // checkCollisions checks for wall, trail, and alert collisions
@@ -157,16 +273,28 @@ func (g *Game) checkCollisions() {
 		g.Commander.Y < 0 || g.Commander.Y >= g.Height {
 		g.State = GameOver
 		g.gameOverCount++
+		g.emit(Event{Type: EventGameOver})
 		g.logGameMetric("game_over", "wall_collision",
 			fmt.Sprintf("Commander hit wall at (%d,%d)", g.Commander.X, g.Commander.Y))
 		return
 	}
 
+	// One-way gate collision (entered against the allowed direction)
+	if gate, ok := g.gateAt(g.Commander); ok && gate.Direction != g.Direction {
+		g.State = GameOver
+		g.gameOverCount++
+		g.emit(Event{Type: EventGameOver})
+		g.logGameMetric("game_over", "gate_collision",
+			fmt.Sprintf("Commander crossed change freeze gate at (%d,%d) against its direction", g.Commander.X, g.Commander.Y))
+		return
+	}
+
 	// Trail collision (self-collision)
 	for _, segment := range g.Trail {
 		if g.Commander.X == segment.X && g.Commander.Y == segment.Y {
 			g.State = GameOver
 			g.gameOverCount++
+			g.emit(Event{Type: EventGameOver})
 			g.logGameMetric("game_over", "self_collision",
 				fmt.Sprintf("Commander hit trail at (%d,%d), trail length: %d",
 					g.Commander.X, g.Commander.Y, len(g.Trail)))
@@ -179,6 +307,7 @@ func (g *Game) checkCollisions() {
 		if g.Commander.X == obstacle.X && g.Commander.Y == obstacle.Y {
 			g.State = GameOver
 			g.gameOverCount++
+			g.emit(Event{Type: EventGameOver})
 			g.logGameMetric("game_over", "obstacle_collision",
 				fmt.Sprintf("Commander hit obstacle at (%d,%d)", g.Commander.X, g.Commander.Y))
 			return
@@ -203,16 +332,28 @@ func (g *Game) checkCollisions() {
 func (g *Game) collectAlert(index int) {
 	alertPos := g.Alerts[index]
 
+	// Scenario mode: symptoms collected before their root cause earn fewer points
+	basePoints := 10
+	if g.Scenario != nil {
+		service := g.alertServices[alertPos]
+		if g.hasOpenRootCause(service) {
+			basePoints = symptomBasePoints
+			g.logGameMetric("symptom_before_root_cause", service,
+				fmt.Sprintf("Alert at (%d,%d) collected while its root cause is open", alertPos.X, alertPos.Y))
+		}
+		delete(g.alertServices, alertPos)
+	}
+
 	// Remove the collected alert
 	g.Alerts = append(g.Alerts[:index], g.Alerts[index+1:]...)
 
 	// Increase score
-	basePoints := 10
 	comboMultiplier := g.AlertsCollected + 1
 	pointsEarned := basePoints * comboMultiplier
 	g.Score += pointsEarned
 
 	g.AlertsCollected++
+	g.emit(Event{Type: EventAlertCollected, Combo: comboMultiplier})
 
 	// Log alert collection
 	g.logGameMetric("alert_collected", pointsEarned,
@@ -229,8 +370,8 @@ func (g *Game) checkLevelComplete() {
 		if g.State != LevelComplete {
 			g.State = LevelComplete
 
-			// Level completion bonus
-			levelTime := time.Since(g.StartTime)
+			// Level completion bonus, timed in ticks so replays score the same
+			levelTime := time.Duration(float64(g.tick-g.levelStartTick) / TickRate(g.Level) * float64(time.Second))
 			timeBonus := max(0, 60-int(levelTime.Seconds()))
 			bonusPoints := (100 * g.Level) + timeBonus
 			g.Score += bonusPoints
@@ -240,11 +381,14 @@ func (g *Game) checkLevelComplete() {
 				fmt.Sprintf("Time: %.2fs, Bonus: %d points, Total score: %d",
 					levelTime.Seconds(), bonusPoints, g.Score))
 
+			g.emit(Event{Type: EventLevelComplete})
+
 			// Set a timer to advance to next level after a brief pause
 			g.LevelCompleteTime = time.Now()
+			g.levelCompleteTick = g.tick
 		} else {
-			// Check if enough time has passed (1 second) to advance to next level
-			if time.Since(g.LevelCompleteTime) >= 1*time.Second {
+			// Check if enough ticks have passed (1 second) to advance to next level
+			if g.tick-g.levelCompleteTick >= g.ticksFor(1*time.Second) {
 				g.nextLevel()
 			}
 		}
@@ -253,28 +397,44 @@ func (g *Game) checkLevelComplete() {
 
 // nextLevel advances to the next level
 func (g *Game) nextLevel() {
-	if g.Level >= 10 {
-		// Game completed!
-		g.logGameMetric("game_complete", g.Score,
-			fmt.Sprintf("All 10 levels completed! Final score: %d", g.Score))
+	if g.Level >= 10 || g.IsCustomLevel() {
+		// Game completed! (hand-made levels are a single level)
+		if !g.completed {
+			g.completed = true
+			g.logGameMetric("game_complete", g.Score,
+				fmt.Sprintf("All levels completed! Final score: %d", g.Score))
+			g.emit(Event{Type: EventGameComplete})
+		}
 		return
 	}
 
 	prevLevel := g.Level
 	g.Level++
 	g.AlertsCollected = 0
+	g.turnsThisLevel = 0
 	// Progressive difficulty but keep it reasonable
 	g.AlertsNeeded = 5 + (g.Level - 1) // Level 1: 5, Level 2: 6, ..., Level 10: 14
 	g.StartTime = time.Now()
+	g.levelStartTick = g.tick
 	g.State = Playing
 
 	// Reset positions and clear trail for new level
 	g.Commander = Position{X: g.Width / 2, Y: g.Height / 2}
 	g.Trail = make([]Position, 0) // Reset trail for new level
 
-	// Clear alerts and obstacles
+	// Clear alerts, obstacles, and special tiles
 	g.Alerts = make([]Position, 0)
+	if g.Scenario != nil {
+		g.alertServices = make(map[Position]string)
+	}
 	g.Obstacles = make([]Position, 0)
+	g.Teleporters = make([]Teleporter, 0)
+	g.Gates = make([]Gate, 0)
+	g.SlowZones = make([]Position, 0)
+	g.slowSkip = false
+
+	// Rollbacks can't cross into the previous level
+	g.clearSnapshots()
 
 	// Setup new level
 	g.setupLevel()
@@ -311,6 +471,8 @@ func (g *Game) setupLevel() {
 	case 9, 10: // Maximum difficulty
 		g.addMazeLayout()
 	}
+
+	g.addSpecialTiles()
 }
 
 // spawnAlerts spawns new alert bubbles
@@ -325,17 +487,13 @@ func (g *Game) spawnAlerts() {
 			break
 		}
 
-		for {
-			x := rand.Intn(g.Width)
-			y := rand.Intn(g.Height)
-			pos := Position{X: x, Y: y}
+		pos := g.randomAlertCell()
 
-			// Don't spawn on commander, trail, or obstacles
-			if !g.isPositionOccupied(pos) {
-				g.Alerts = append(g.Alerts, pos)
-				g.alertsSpawned++
-				break
-			}
+		// Don't spawn on commander, trail, obstacles, special tiles, or other alerts
+		if !g.isPositionOccupied(pos) && !g.isAlert(pos) {
+			g.Alerts = append(g.Alerts, pos)
+			g.assignAlertService(pos)
+			g.alertsSpawned++
 		}
 	}
 
@@ -368,7 +526,8 @@ func (g *Game) isPositionOccupied(pos Position) bool {
 		}
 	}
 
-	return false
+	// Check teleporters, gates, and slow zones
+	return g.isSpecialTile(pos)
 }
 
 // addStaticBarriers adds static barrier obstacles
@@ -414,8 +573,8 @@ func (g *Game) addRandomObstacles(count int) {
 
 	for i := 0; i < count; i++ {
 		for attempts := 0; attempts < 50; attempts++ {
-			x := rand.Intn(g.Width)
-			y := rand.Intn(g.Height)
+			x := g.rng.Intn(g.Width)
+			y := g.rng.Intn(g.Height)
 			pos := Position{X: x, Y: y}
 
 			// Don't place obstacles too close to commander spawn (maintain 3x3 safe zone)
@@ -450,7 +609,7 @@ func (g *Game) addMazeLayout() {
 
 				// Add connecting obstacle
 				var nextPos Position
-				if rand.Intn(2) == 0 {
+				if g.rng.Intn(2) == 0 {
 					nextPos = Position{X: x + 1, Y: y}
 				} else {
 					nextPos = Position{X: x, Y: y + 1}
@@ -477,18 +636,40 @@ func (g *Game) GetLevel() int            { return g.Level }
 func (g *Game) GetAlertsCollected() int  { return g.AlertsCollected }
 func (g *Game) GetAlertsNeeded() int     { return g.AlertsNeeded }
 func (g *Game) GetState() GameState      { return g.State }
+func (g *Game) GetDirection() Direction  { return g.Direction }
 func (g *Game) GetWidth() int            { return g.Width }
 func (g *Game) GetHeight() int           { return g.Height }
+func (g *Game) GetRunID() string         { return g.runID }
 func (g *Game) IsRunning() bool          { return g.State == Playing }
 
+// Special tile getters
+func (g *Game) GetTeleporters() []Teleporter { return g.Teleporters }
+func (g *Game) GetGates() []Gate             { return g.Gates }
+func (g *Game) GetSlowZones() []Position     { return g.SlowZones }
+
 // Control methods
 func (g *Game) SetDirection(dir Direction) {
-	// Prevent immediate reversal
+	// A paused or lost game ignores turns, except to pick a direction after a rollback
+	if g.State == GameOver || (g.State == Paused && !g.rolledBack) {
+		return
+	}
+
+	// Prevent immediate reversal, including a chain of turns made while waiting after a rollback
 	opposite := map[Direction]Direction{
 		Up: Down, Down: Up, Left: Right, Right: Left,
 	}
+	if g.rolledBack && g.restoredDir == opposite[dir] {
+		return
+	}
 	if g.Direction != opposite[dir] {
 		dirNames := map[Direction]string{Up: "Up", Down: "Down", Left: "Left", Right: "Right"}
+		if g.Direction != dir && g.State == Playing {
+			g.turnsThisLevel++
+			g.emit(Event{Type: EventTurn})
+		}
+		if g.Direction != dir {
+			g.record(directionActions[dir])
+		}
 		g.Direction = dir
 		g.logGameMetric("direction_change", dirNames[dir],
 			fmt.Sprintf("Changed from %s to %s", dirNames[g.Direction], dirNames[dir]))
@@ -498,9 +679,14 @@ func (g *Game) SetDirection(dir Direction) {
 func (g *Game) Pause() {
 	if g.State == Playing {
 		g.State = Paused
+		g.record(ActionPause)
+		g.pauseCount++
+		g.emit(Event{Type: EventPause})
 		g.logGameMetric("game_paused", time.Since(g.StartTime).Seconds(), "Game paused by player")
 	} else if g.State == Paused {
 		g.State = Playing
+		g.rolledBack = false
+		g.record(ActionPause)
 		g.logGameMetric("game_resumed", time.Since(g.StartTime).Seconds(), "Game resumed by player")
 	}
 }
@@ -508,7 +694,22 @@ func (g *Game) Pause() {
 func (g *Game) Restart() {
 	g.logGameMetric("game_restart", g.Level,
 		fmt.Sprintf("Game restarted at level %d with score %d", g.Level, g.Score))
-	*g = *New(g.Width, g.Height)
+
+	// A restart is a new run with a new seed, except on the daily challenge's shared board
+	opts := g.options
+	opts.Seed = 0
+	*g = *NewWithOptions(g.Width, g.Height, opts)
+}
+
+// TickRate returns how many times per second the game updates at a level.
+// Level 1 runs at 2.15 ticks per second, speeding up to 8 from level 10.
+func TickRate(level int) float64 {
+	return math.Min(8, 1.5+float64(level)*0.65)
+}
+
+// ticksFor converts a duration to ticks at the current level, rounding up
+func (g *Game) ticksFor(d time.Duration) int {
+	return int(math.Ceil(d.Seconds() * TickRate(g.Level)))
 }
 
 // Utility functions
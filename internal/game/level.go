@@ -0,0 +1,260 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// LevelFormatVersion is the current version of the shareable level format
+const LevelFormatVersion = 1
+
+// LevelDefinition is a hand-made level in the shareable level format
+type LevelDefinition struct {
+	Version      int          `json:"version"`
+	Name         string       `json:"name"`
+	Width        int          `json:"width"`
+	Height       int          `json:"height"`
+	Spawn        Position     `json:"spawn"`
+	Direction    Direction    `json:"direction"`
+	AlertsNeeded int          `json:"alerts_needed"`
+	Obstacles    []Position   `json:"obstacles,omitempty"`
+	AlertZones   []Position   `json:"alert_zones,omitempty"` // Cells alerts may spawn in; empty means anywhere
+	Teleporters  []Teleporter `json:"teleporters,omitempty"`
+	Gates        []Gate       `json:"gates,omitempty"`
+	SlowZones    []Position   `json:"slow_zones,omitempty"`
+}
+
+// ParseLevel parses a level in the shareable level format and checks that it is solvable
+func ParseLevel(data []byte) (*LevelDefinition, error) {
+	var def LevelDefinition
+	if err := json.Unmarshal(data, &def); err != nil {
+		return nil, fmt.Errorf("invalid level definition: %w", err)
+	}
+	if def.Version != LevelFormatVersion {
+		return nil, fmt.Errorf("unsupported level format version %d", def.Version)
+	}
+	if err := ValidateLevel(&def); err != nil {
+		return nil, err
+	}
+	return &def, nil
+}
+
+// ValidateLevel checks that a level is well-formed and solvable: the commander's
+// first move is safe and enough alert cells are reachable from the spawn point.
+func ValidateLevel(def *LevelDefinition) error {
+	if def.Width < 5 || def.Height < 5 || def.Width > 60 || def.Height > 60 {
+		return fmt.Errorf("level size %dx%d is outside 5x5 to 60x60", def.Width, def.Height)
+	}
+	if def.AlertsNeeded <= 0 {
+		return errors.New("level needs at least one alert to complete")
+	}
+
+	inBounds := func(p Position) bool {
+		return p.X >= 0 && p.X < def.Width && p.Y >= 0 && p.Y < def.Height
+	}
+
+	// Every tile must be on the board and cells can't hold two tiles
+	tiles := make(map[Position]string)
+	place := func(p Position, kind string) error {
+		if !inBounds(p) {
+			return fmt.Errorf("%s at (%d,%d) is off the board", kind, p.X, p.Y)
+		}
+		if other, taken := tiles[p]; taken {
+			return fmt.Errorf("%s at (%d,%d) overlaps a %s", kind, p.X, p.Y, other)
+		}
+		tiles[p] = kind
+		return nil
+	}
+	for _, p := range def.Obstacles {
+		if err := place(p, "obstacle"); err != nil {
+			return err
+		}
+	}
+	for _, gate := range def.Gates {
+		if err := place(gate.Position, "gate"); err != nil {
+			return err
+		}
+	}
+	for _, tp := range def.Teleporters {
+		if err := place(tp.A, "teleporter"); err != nil {
+			return err
+		}
+		if err := place(tp.B, "teleporter"); err != nil {
+			return err
+		}
+	}
+	for _, p := range def.SlowZones {
+		if err := place(p, "slow zone"); err != nil {
+			return err
+		}
+	}
+
+	if !inBounds(def.Spawn) {
+		return fmt.Errorf("spawn point (%d,%d) is off the board", def.Spawn.X, def.Spawn.Y)
+	}
+	if kind, taken := tiles[def.Spawn]; taken && kind != "slow zone" {
+		return fmt.Errorf("spawn point (%d,%d) is on a %s", def.Spawn.X, def.Spawn.Y, kind)
+	}
+
+	// The first move happens before the player can react
+	first := step(def.Spawn, def.Direction)
+	if !inBounds(first) || tiles[first] == "obstacle" {
+		return errors.New("the commander crashes on its first move; change the spawn direction")
+	}
+
+	reachable := reachableCells(def, tiles)
+
+	// Alerts spawn on free cells, optionally restricted to alert zones
+	candidates := def.AlertZones
+	if len(candidates) == 0 {
+		for y := 0; y < def.Height; y++ {
+			for x := 0; x < def.Width; x++ {
+				candidates = append(candidates, Position{X: x, Y: y})
+			}
+		}
+	}
+	reachableAlerts := 0
+	for _, p := range candidates {
+		if !inBounds(p) {
+			return fmt.Errorf("alert zone at (%d,%d) is off the board", p.X, p.Y)
+		}
+		if _, taken := tiles[p]; taken || p == def.Spawn {
+			continue
+		}
+		if reachable[p] {
+			reachableAlerts++
+		} else if len(def.AlertZones) > 0 {
+			return fmt.Errorf("alert zone at (%d,%d) can't be reached from the spawn point", p.X, p.Y)
+		}
+	}
+	if reachableAlerts == 0 {
+		return errors.New("no alert can spawn where the commander can reach it")
+	}
+
+	return nil
+}
+
+// step returns the neighbor of p in direction d
+func step(p Position, d Direction) Position {
+	switch d {
+	case Up:
+		p.Y--
+	case Down:
+		p.Y++
+	case Left:
+		p.X--
+	case Right:
+		p.X++
+	}
+	return p
+}
+
+// reachableCells runs a breadth-first search from the spawn point, honoring gate
+// directions and teleporter links. It ignores the commander's own trail.
+func reachableCells(def *LevelDefinition, tiles map[Position]string) map[Position]bool {
+	gates := make(map[Position]Direction, len(def.Gates))
+	for _, gate := range def.Gates {
+		gates[gate.Position] = gate.Direction
+	}
+	links := make(map[Position]Position, len(def.Teleporters)*2)
+	for _, tp := range def.Teleporters {
+		links[tp.A] = tp.B
+		links[tp.B] = tp.A
+	}
+
+	reachable := map[Position]bool{def.Spawn: true}
+	queue := []Position{def.Spawn}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		for _, dir := range []Direction{Up, Down, Left, Right} {
+			next := step(cur, dir)
+			if next.X < 0 || next.X >= def.Width || next.Y < 0 || next.Y >= def.Height {
+				continue
+			}
+			if tiles[next] == "obstacle" {
+				continue
+			}
+			if allowed, isGate := gates[next]; isGate && allowed != dir {
+				continue
+			}
+			if exit, isPad := links[next]; isPad {
+				reachable[next] = true
+				next = exit
+			}
+			if !reachable[next] {
+				reachable[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return reachable
+}
+
+// loadLevel replaces the generated layout with a hand-made level
+func (g *Game) loadLevel(def *LevelDefinition) {
+	g.Width, g.Height = def.Width, def.Height
+	g.Commander = def.Spawn
+	g.Direction = def.Direction
+	g.AlertsNeeded = def.AlertsNeeded
+	g.Trail = make([]Position, 0)
+
+	g.Obstacles = append([]Position{}, def.Obstacles...)
+	g.Teleporters = append([]Teleporter{}, def.Teleporters...)
+	g.Gates = append([]Gate{}, def.Gates...)
+	g.SlowZones = append([]Position{}, def.SlowZones...)
+	g.alertZones = append([]Position{}, def.AlertZones...)
+
+	g.Alerts = make([]Position, 0)
+	g.spawnAlerts()
+
+	g.logGameMetric("custom_level_loaded", def.Name,
+		fmt.Sprintf("Size: %dx%d, obstacles: %d, alert zones: %d, alerts needed: %d",
+			def.Width, def.Height, len(def.Obstacles), len(def.AlertZones), def.AlertsNeeded))
+}
+
+// PreviewLevel creates a paused game showing a level's layout without alerts, for the editor
+func PreviewLevel(def *LevelDefinition) *Game {
+	return &Game{
+		Width:        def.Width,
+		Height:       def.Height,
+		Commander:    def.Spawn,
+		Direction:    def.Direction,
+		Trail:        make([]Position, 0),
+		Alerts:       make([]Position, 0),
+		Obstacles:    def.Obstacles,
+		Teleporters:  def.Teleporters,
+		Gates:        def.Gates,
+		SlowZones:    def.SlowZones,
+		alertZones:   def.AlertZones,
+		State:        Paused,
+		Level:        1,
+		AlertsNeeded: def.AlertsNeeded,
+	}
+}
+
+// GetAlertZones returns the cells alerts may spawn in; empty means anywhere
+func (g *Game) GetAlertZones() []Position { return g.alertZones }
+
+// randomAlertCell picks a random cell for an alert, inside the alert zones if the level has any
+func (g *Game) randomAlertCell() Position {
+	if len(g.alertZones) > 0 {
+		return g.alertZones[g.rng.Intn(len(g.alertZones))]
+	}
+	return Position{X: g.rng.Intn(g.Width), Y: g.rng.Intn(g.Height)}
+}
+
+// isAlert checks if a position already holds an alert
+func (g *Game) isAlert(pos Position) bool {
+	for _, alert := range g.Alerts {
+		if alert == pos {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCustomLevel reports whether the game is playing a hand-made level
+func (g *Game) IsCustomLevel() bool { return g.options.Level != nil }
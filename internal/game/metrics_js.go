@@ -0,0 +1,18 @@
+//go:build js && wasm
+// +build js,wasm
+
+package game
+
+import (
+	"fmt"
+	"syscall/js"
+)
+
+// logGameMetric logs a game metric to console for observability
+func (g *Game) logGameMetric(metric string, value interface{}, context string) {
+	if js.Global().Get("console").Truthy() {
+		js.Global().Get("console").Call("log",
+			fmt.Sprintf("[GAME_METRIC] %s: %v - Level: %d, Score: %d, Context: %s",
+				metric, value, g.Level, g.Score, context))
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !(js && wasm)
+// +build !js !wasm
+
+package game
+
+// logGameMetric is a no-op outside the browser, e.g. when the server replays a run
+func (g *Game) logGameMetric(metric string, value interface{}, context string) {}
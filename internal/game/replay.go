@@ -0,0 +1,137 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Action is a player input recorded for replays
+type Action string
+
+const (
+	ActionUp       Action = "up"
+	ActionDown     Action = "down"
+	ActionLeft     Action = "left"
+	ActionRight    Action = "right"
+	ActionPause    Action = "pause" // Toggles between paused and playing
+	ActionRollback Action = "rollback"
+)
+
+// directionActions maps directions to their recorded actions
+var directionActions = map[Direction]Action{
+	Up: ActionUp, Down: ActionDown, Left: ActionLeft, Right: ActionRight,
+}
+
+// Replay limits keep server-side verification cheap
+const (
+	MaxReplayTicks  = 100000 // Over 3 hours at the fastest tick rate
+	MaxReplayInputs = 20000
+)
+
+// Input is a player input applied before the given tick's update
+type Input struct {
+	Tick   int    `json:"tick"`
+	Action Action `json:"action"`
+}
+
+// Replay is everything needed to re-run a game: its seed, board size, how many
+// ticks it ran, and the inputs that changed it
+type Replay struct {
+	Seed   int64   `json:"seed"`
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+	Ticks  int     `json:"ticks"`
+	Inputs []Input `json:"inputs"`
+}
+
+// record appends an input to the replay log at the current tick
+func (g *Game) record(action Action) {
+	g.inputs = append(g.inputs, Input{Tick: g.tick, Action: action})
+}
+
+// GetReplay returns the replay of the run so far
+func (g *Game) GetReplay() Replay {
+	return Replay{
+		Seed:   g.seed,
+		Width:  g.Width,
+		Height: g.Height,
+		Ticks:  g.tick,
+		Inputs: append([]Input(nil), g.inputs...),
+	}
+}
+
+// Validate checks that a replay is within limits and its inputs are in order
+func (r *Replay) Validate() error {
+	if r.Seed == 0 {
+		return errors.New("replay has no seed")
+	}
+	if r.Width < 5 || r.Height < 5 || r.Width > 60 || r.Height > 60 {
+		return fmt.Errorf("board size %dx%d is outside 5x5 to 60x60", r.Width, r.Height)
+	}
+	if r.Ticks <= 0 || r.Ticks > MaxReplayTicks {
+		return fmt.Errorf("replay length of %d ticks is out of range", r.Ticks)
+	}
+	if len(r.Inputs) > MaxReplayInputs {
+		return fmt.Errorf("replay has %d inputs, more than %d", len(r.Inputs), MaxReplayInputs)
+	}
+
+	prev := 0
+	for i, input := range r.Inputs {
+		if input.Tick < prev || input.Tick >= r.Ticks {
+			return fmt.Errorf("input %d at tick %d is out of order", i, input.Tick)
+		}
+		prev = input.Tick
+
+		switch input.Action {
+		case ActionUp, ActionDown, ActionLeft, ActionRight, ActionPause, ActionRollback:
+		default:
+			return fmt.Errorf("input %d has unknown action %q", i, input.Action)
+		}
+	}
+	return nil
+}
+
+// Simulate re-runs a replay headlessly with the given modes and returns the
+// resulting game. opts.Seed is replaced by the replay's seed.
+func Simulate(r Replay, opts Options) (*Game, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	opts.Seed = r.Seed
+	g := NewWithOptions(r.Width, r.Height, opts)
+
+	next := 0
+	for g.tick < r.Ticks {
+		for next < len(r.Inputs) && r.Inputs[next].Tick == g.tick {
+			g.Apply(r.Inputs[next].Action)
+			next++
+		}
+		g.Update()
+		g.TakeEvents()
+	}
+	return g, nil
+}
+
+// Apply performs a player input, e.g. one recorded in a replay or sent by a remote client
+func (g *Game) Apply(action Action) {
+	switch action {
+	case ActionUp:
+		g.SetDirection(Up)
+	case ActionDown:
+		g.SetDirection(Down)
+	case ActionLeft:
+		g.SetDirection(Left)
+	case ActionRight:
+		g.SetDirection(Right)
+	case ActionPause:
+		g.Pause()
+	case ActionRollback:
+		g.Rollback()
+	}
+}
+
+// IsFinished reports whether the run has ended, by a game over or by clearing every level
+func (g *Game) IsFinished() bool {
+	return g.State == GameOver || g.completed
+}
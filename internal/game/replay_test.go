@@ -0,0 +1,198 @@
+package game
+
+import "testing"
+
+// playRun plays a game with a greedy bot that heads for the first alert and
+// avoids cells it would crash into, until the run ends or maxTicks pass
+func playRun(seed int64, maxTicks int) *Game {
+	g := NewWithOptions(BoardSize, BoardSize, Options{Seed: seed})
+	for i := 0; i < maxTicks && !g.IsFinished(); i++ {
+		if g.State == Playing {
+			g.SetDirection(botDirection(g))
+		}
+		g.Update()
+		g.TakeEvents()
+	}
+	return g
+}
+
+// botDirection picks the direction towards the first alert, falling back to
+// any safe direction
+func botDirection(g *Game) Direction {
+	var preferred []Direction
+	if len(g.Alerts) > 0 {
+		target := g.Alerts[0]
+		switch {
+		case target.X > g.Commander.X:
+			preferred = append(preferred, Right)
+		case target.X < g.Commander.X:
+			preferred = append(preferred, Left)
+		}
+		switch {
+		case target.Y > g.Commander.Y:
+			preferred = append(preferred, Down)
+		case target.Y < g.Commander.Y:
+			preferred = append(preferred, Up)
+		}
+	}
+	preferred = append(preferred, g.Direction, Up, Right, Down, Left)
+
+	opposite := map[Direction]Direction{Up: Down, Down: Up, Left: Right, Right: Left}
+	for _, dir := range preferred {
+		if dir != opposite[g.Direction] && isSafe(g, step(g.Commander, dir)) {
+			return dir
+		}
+	}
+	return g.Direction
+}
+
+// isSafe reports whether moving onto pos wouldn't end the game
+func isSafe(g *Game, pos Position) bool {
+	if pos.X < 0 || pos.X >= g.Width || pos.Y < 0 || pos.Y >= g.Height {
+		return false
+	}
+	if _, ok := g.gateAt(pos); ok {
+		return false
+	}
+	for _, p := range append(append([]Position(nil), g.Trail...), g.Obstacles...) {
+		if p == pos {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSimulateReproducesRun(t *testing.T) {
+	for _, seed := range []int64{1, 42, 20260101, 987654321} {
+		played := playRun(seed, 20000)
+		if !played.IsFinished() {
+			t.Fatalf("seed %d: bot run didn't finish", seed)
+		}
+
+		replay := played.GetReplay()
+		simulated, err := Simulate(replay, Options{})
+		if err != nil {
+			t.Fatalf("seed %d: Simulate: %v", seed, err)
+		}
+		if !simulated.IsFinished() {
+			t.Errorf("seed %d: simulated run isn't finished", seed)
+		}
+		if simulated.GetScore() != played.GetScore() {
+			t.Errorf("seed %d: simulated score %d, played %d", seed, simulated.GetScore(), played.GetScore())
+		}
+		if simulated.GetLevel() != played.GetLevel() {
+			t.Errorf("seed %d: simulated level %d, played %d", seed, simulated.GetLevel(), played.GetLevel())
+		}
+	}
+}
+
+func TestSimulateTruncatedReplay(t *testing.T) {
+	played := playRun(42, 20000)
+	replay := played.GetReplay()
+	replay.Ticks--
+	for len(replay.Inputs) > 0 && replay.Inputs[len(replay.Inputs)-1].Tick >= replay.Ticks {
+		replay.Inputs = replay.Inputs[:len(replay.Inputs)-1]
+	}
+
+	simulated, err := Simulate(replay, Options{})
+	if err != nil {
+		t.Fatalf("Simulate: %v", err)
+	}
+	if simulated.IsFinished() {
+		t.Error("replay cut one tick short still finished the run")
+	}
+}
+
+func TestReplayValidate(t *testing.T) {
+	valid := func() Replay {
+		return Replay{
+			Seed:   42,
+			Width:  BoardSize,
+			Height: BoardSize,
+			Ticks:  100,
+			Inputs: []Input{{Tick: 0, Action: ActionUp}, {Tick: 10, Action: ActionRight}, {Tick: 10, Action: ActionPause}},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(r *Replay)
+		wantErr bool
+	}{
+		{"valid", func(r *Replay) {}, false},
+		{"no inputs", func(r *Replay) { r.Inputs = nil }, false},
+		{"no seed", func(r *Replay) { r.Seed = 0 }, true},
+		{"board too small", func(r *Replay) { r.Width = 4 }, true},
+		{"board too large", func(r *Replay) { r.Height = 61 }, true},
+		{"no ticks", func(r *Replay) { r.Ticks = 0 }, true},
+		{"too many ticks", func(r *Replay) { r.Ticks = MaxReplayTicks + 1 }, true},
+		{"too many inputs", func(r *Replay) { r.Inputs = make([]Input, MaxReplayInputs+1) }, true},
+		{"inputs out of order", func(r *Replay) { r.Inputs[0].Tick = 20 }, true},
+		{"input after the last tick", func(r *Replay) { r.Inputs[2].Tick = 100 }, true},
+		{"negative tick", func(r *Replay) { r.Inputs[0].Tick = -1 }, true},
+		{"unknown action", func(r *Replay) { r.Inputs[1].Action = "teleport" }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid()
+			tt.modify(&r)
+			if err := r.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetDirectionWhilePaused(t *testing.T) {
+	g := NewWithOptions(BoardSize, BoardSize, Options{Seed: 42})
+	g.Update()
+	dir := g.Direction
+	g.Pause()
+	inputs := len(g.GetReplay().Inputs)
+
+	g.SetDirection((dir + 1) % 4)
+	if g.Direction != dir || len(g.GetReplay().Inputs) != inputs {
+		t.Errorf("turn while paused changed direction to %d and recorded %d inputs", g.Direction, len(g.GetReplay().Inputs)-inputs)
+	}
+}
+
+func TestSetDirectionAfterRollback(t *testing.T) {
+	g := NewWithOptions(BoardSize, BoardSize, Options{Seed: 42})
+	for i := 0; i < BoardSize*2 && g.State != GameOver; i++ {
+		g.Update()
+	}
+	if !g.Rollback() {
+		t.Fatal("couldn't roll back the crash")
+	}
+	for i := 0; i < 100 && g.State == Rewinding; i++ {
+		g.Update()
+	}
+	if g.State != Paused {
+		t.Fatalf("state after the rewind = %d, want Paused", g.State)
+	}
+
+	// The player can pick a new direction, but not reverse by turning twice
+	restored := g.Direction
+	opposite := map[Direction]Direction{Up: Down, Down: Up, Left: Right, Right: Left}
+	turn := Up
+	if restored == Up || restored == Down {
+		turn = Left
+	}
+	g.SetDirection(turn)
+	if g.Direction != turn {
+		t.Fatalf("direction after turning = %d, want %d", g.Direction, turn)
+	}
+	g.SetDirection(opposite[restored])
+	if g.Direction != turn {
+		t.Errorf("turned back on the restored direction %d while waiting", restored)
+	}
+
+	// Once resumed, the usual pause rule applies
+	g.Pause()
+	g.Pause()
+	g.SetDirection(restored)
+	if g.Direction != turn {
+		t.Error("turned while paused after resuming")
+	}
+}
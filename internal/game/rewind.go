@@ -0,0 +1,148 @@
+package game
+
+import (
+	"fmt"
+	"time"
+)
+
+// Rollback tuning
+const (
+	MaxRollbacks     = 3                      // Rollbacks available per run
+	rewindTicks      = 8                      // How many ticks a rollback goes back
+	rewindBufferSize = 16                     // Snapshots kept in the ring buffer
+	RewindDuration   = 600 * time.Millisecond // Length of the rewinding animation
+)
+
+// snapshot captures the per-tick state a rollback restores.
+// Obstacles and special tiles are fixed within a level, so they are not copied.
+type snapshot struct {
+	commander       Position
+	trail           []Position
+	alerts          []Position
+	alertServices   map[Position]string
+	direction       Direction
+	score           int
+	alertsCollected int
+	slowSkip        bool
+	scenarioTicks   int
+}
+
+// rewindBuffer is a fixed-size ring buffer of recent snapshots
+type rewindBuffer struct {
+	items [rewindBufferSize]snapshot
+	next  int // Index the next snapshot is written to
+	count int // Number of valid snapshots
+}
+
+// saveSnapshot records the current state before the commander moves
+func (g *Game) saveSnapshot() {
+	snap := snapshot{
+		commander:       g.Commander,
+		trail:           append([]Position(nil), g.Trail...),
+		alerts:          append([]Position(nil), g.Alerts...),
+		direction:       g.Direction,
+		score:           g.Score,
+		alertsCollected: g.AlertsCollected,
+		slowSkip:        g.slowSkip,
+		scenarioTicks:   g.scenarioTicks,
+	}
+	if g.alertServices != nil {
+		snap.alertServices = make(map[Position]string, len(g.alertServices))
+		for pos, service := range g.alertServices {
+			snap.alertServices[pos] = service
+		}
+	}
+
+	g.rewind.items[g.rewind.next] = snap
+	g.rewind.next = (g.rewind.next + 1) % rewindBufferSize
+	g.rewind.count = min(g.rewind.count+1, rewindBufferSize)
+}
+
+// clearSnapshots drops all snapshots, e.g. when a new level starts
+func (g *Game) clearSnapshots() {
+	g.rewind = rewindBuffer{}
+}
+
+// CanRollback reports whether a rollback can undo the current game over
+func (g *Game) CanRollback() bool {
+	return g.State == GameOver && g.RollbacksLeft > 0 && g.rewind.count > 0
+}
+
+// Rollback restores the state from a few ticks ago after a collision instead of ending the game.
+// The game shows the rewinding animation for RewindDuration and then waits paused for the player.
+// The animation ends on a tick rather than on the clock so replays stay deterministic.
+func (g *Game) Rollback() bool {
+	if !g.CanRollback() {
+		return false
+	}
+
+	// Go back rewindTicks, or as far as the buffer reaches
+	back := min(rewindTicks, g.rewind.count)
+	index := (g.rewind.next - back + rewindBufferSize) % rewindBufferSize
+	snap := g.rewind.items[index]
+
+	// Path the commander travels backwards during the animation
+	crash := g.Commander
+	g.RewindPath = []Position{crash}
+	for i := len(g.Trail) - 1; i >= len(snap.trail) && i >= 0; i-- {
+		g.RewindPath = append(g.RewindPath, g.Trail[i])
+	}
+
+	g.Commander = snap.commander
+	g.Trail = snap.trail
+	g.Alerts = snap.alerts
+	g.alertServices = snap.alertServices
+	g.Direction = snap.direction
+	g.Score = snap.score
+	g.AlertsCollected = snap.alertsCollected
+	g.slowSkip = snap.slowSkip
+	g.scenarioTicks = snap.scenarioTicks
+
+	// The restored snapshot is the present again; drop everything after it
+	g.rewind.next = index
+	g.rewind.count -= back
+
+	g.RollbacksLeft--
+	g.State = Rewinding
+	g.rolledBack = true
+	g.restoredDir = snap.direction
+	g.RewindStart = time.Now()
+	g.rewindTick = g.tick
+	g.record(ActionRollback)
+	g.emit(Event{Type: EventRollback})
+
+	g.logGameMetric("rollback", g.RollbacksLeft,
+		fmt.Sprintf("Rolled back %d ticks from (%d,%d) to (%d,%d), rollbacks left: %d",
+			back, crash.X, crash.Y, g.Commander.X, g.Commander.Y, g.RollbacksLeft))
+	return true
+}
+
+// checkRewindComplete pauses the game once the rewinding animation has played
+func (g *Game) checkRewindComplete() {
+	if g.State == Rewinding && g.tick-g.rewindTick >= g.ticksFor(RewindDuration) {
+		g.State = Paused
+		g.RewindPath = nil
+		g.logGameMetric("rollback_complete", g.RollbacksLeft, "Rewind animation finished, game paused")
+	}
+}
+
+// RewindProgress returns how far the rewinding animation has played, from 0 to 1
+func (g *Game) RewindProgress() float64 {
+	if g.State != Rewinding {
+		return 0
+	}
+	return min64(1, float64(time.Since(g.RewindStart))/float64(RewindDuration))
+}
+
+// GetRollbacksLeft returns the remaining rollbacks for this run
+func (g *Game) GetRollbacksLeft() int { return g.RollbacksLeft }
+
+// GetRewindPath returns the positions undone by the current rollback, newest first
+func (g *Game) GetRewindPath() []Position { return g.RewindPath }
+
+func min64(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,238 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Scenario describes a themed incident where alerts belong to services in a dependency graph
+type Scenario struct {
+	Name            string    `json:"name"`
+	Description     string    `json:"description"`
+	Services        []Service `json:"services"`
+	SymptomInterval int       `json:"symptom_interval,omitempty"` // Ticks between symptom spawns while a root cause is open
+	MaxAlerts       int       `json:"max_alerts,omitempty"`       // Cap on alerts on screen including symptoms
+}
+
+// Service is a node in the scenario dependency graph
+type Service struct {
+	Name      string   `json:"name"`
+	DependsOn []string `json:"depends_on,omitempty"`
+}
+
+// symptomBasePoints replaces the regular 10 base points for an alert collected
+// while its root cause is still open
+const symptomBasePoints = 4
+
+// ParseScenario parses and validates a scenario definition file
+func ParseScenario(data []byte) (*Scenario, error) {
+	var s Scenario
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid scenario definition: %w", err)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Validate checks the dependency graph and fills in defaults
+func (s *Scenario) Validate() error {
+	if s.Name == "" {
+		return errors.New("scenario name is required")
+	}
+	if len(s.Services) == 0 {
+		return fmt.Errorf("scenario %q has no services", s.Name)
+	}
+
+	known := make(map[string]bool, len(s.Services))
+	for _, svc := range s.Services {
+		if svc.Name == "" {
+			return fmt.Errorf("scenario %q has a service without a name", s.Name)
+		}
+		if known[svc.Name] {
+			return fmt.Errorf("scenario %q defines service %q twice", s.Name, svc.Name)
+		}
+		known[svc.Name] = true
+	}
+	for _, svc := range s.Services {
+		for _, dep := range svc.DependsOn {
+			if !known[dep] {
+				return fmt.Errorf("service %q depends on unknown service %q", svc.Name, dep)
+			}
+		}
+	}
+
+	// Reject cycles so every symptom has a root cause
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(s.Services))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("scenario %q has a dependency cycle through %q", s.Name, name)
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		for _, dep := range s.service(name).DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		return nil
+	}
+	for _, svc := range s.Services {
+		if err := visit(svc.Name); err != nil {
+			return err
+		}
+	}
+
+	if s.SymptomInterval <= 0 {
+		s.SymptomInterval = 12
+	}
+	if s.MaxAlerts <= 0 {
+		s.MaxAlerts = 6
+	}
+	return nil
+}
+
+// service looks up a service by name
+func (s *Scenario) service(name string) Service {
+	for _, svc := range s.Services {
+		if svc.Name == name {
+			return svc
+		}
+	}
+	return Service{}
+}
+
+// upstreamOf returns every service the named service depends on, directly or transitively
+func (s *Scenario) upstreamOf(name string) map[string]bool {
+	upstream := make(map[string]bool)
+	var walk func(string)
+	walk = func(n string) {
+		for _, dep := range s.service(n).DependsOn {
+			if !upstream[dep] {
+				upstream[dep] = true
+				walk(dep)
+			}
+		}
+	}
+	walk(name)
+	return upstream
+}
+
+// dependentsOf returns the services that directly depend on the named service
+func (s *Scenario) dependentsOf(name string) []string {
+	var dependents []string
+	for _, svc := range s.Services {
+		for _, dep := range svc.DependsOn {
+			if dep == name {
+				dependents = append(dependents, svc.Name)
+				break
+			}
+		}
+	}
+	return dependents
+}
+
+// SetScenario switches the game into scenario mode and restarts alert spawning
+func (g *Game) SetScenario(s *Scenario) {
+	g.Scenario = s
+	g.options.Scenario = s
+	g.alertServices = make(map[Position]string)
+	g.scenarioTicks = 0
+
+	// Respawn alerts so each one belongs to a service
+	g.Alerts = make([]Position, 0)
+	g.spawnAlerts()
+
+	g.logGameMetric("scenario_loaded", s.Name,
+		fmt.Sprintf("Services: %d, symptom interval: %d ticks", len(s.Services), s.SymptomInterval))
+}
+
+// assignAlertService attaches a random service to a newly spawned alert
+func (g *Game) assignAlertService(pos Position) {
+	if g.Scenario == nil {
+		return
+	}
+	g.alertServices[pos] = g.Scenario.Services[g.rng.Intn(len(g.Scenario.Services))].Name
+}
+
+// hasOpenRootCause checks if any service upstream of the named service still has an open alert
+func (g *Game) hasOpenRootCause(service string) bool {
+	upstream := g.Scenario.upstreamOf(service)
+	for _, alert := range g.Alerts {
+		if upstream[g.alertServices[alert]] {
+			return true
+		}
+	}
+	return false
+}
+
+// updateScenario spawns symptom alerts on dependents of open root causes
+func (g *Game) updateScenario() {
+	if g.Scenario == nil {
+		return
+	}
+
+	g.scenarioTicks++
+	if g.scenarioTicks%g.Scenario.SymptomInterval != 0 {
+		return
+	}
+
+	// Snapshot open alerts since spawning appends to the slice
+	open := append([]Position(nil), g.Alerts...)
+	for _, alert := range open {
+		if len(g.Alerts) >= g.Scenario.MaxAlerts {
+			return
+		}
+		dependents := g.Scenario.dependentsOf(g.alertServices[alert])
+		if len(dependents) == 0 {
+			continue
+		}
+		g.spawnSymptomAlert(g.alertServices[alert], dependents[g.rng.Intn(len(dependents))])
+	}
+}
+
+// spawnSymptomAlert spawns an alert on a dependent service caused by an open root cause
+func (g *Game) spawnSymptomAlert(rootCause, service string) {
+	for attempts := 0; attempts < 100; attempts++ {
+		pos := Position{X: g.rng.Intn(g.Width), Y: g.rng.Intn(g.Height)}
+		if g.isPositionOccupied(pos) {
+			continue
+		}
+		if _, taken := g.alertServices[pos]; taken {
+			continue
+		}
+
+		g.Alerts = append(g.Alerts, pos)
+		g.alertServices[pos] = service
+		g.alertsSpawned++
+		g.logGameMetric("symptom_spawned", service,
+			fmt.Sprintf("Root cause %s still open, symptom at (%d,%d)", rootCause, pos.X, pos.Y))
+		return
+	}
+}
+
+// GetScenario returns the active scenario, or nil in classic mode
+func (g *Game) GetScenario() *Scenario { return g.Scenario }
+
+// AlertService returns the service an alert belongs to, or "" in classic mode
+func (g *Game) AlertService(pos Position) string { return g.alertServices[pos] }
+
+// IsSymptomAlert checks if an alert's root cause is still open
+func (g *Game) IsSymptomAlert(pos Position) bool {
+	if g.Scenario == nil {
+		return false
+	}
+	service, ok := g.alertServices[pos]
+	return ok && g.hasOpenRootCause(service)
+}
@@ -0,0 +1,154 @@
+package game
+
+import "fmt"
+
+// Teleporter links two pads; entering either pad moves the commander to the other
+type Teleporter struct {
+	A Position `json:"a"`
+	B Position `json:"b"`
+}
+
+// Gate is a one-way "change freeze" gate that can only be entered moving in Direction
+type Gate struct {
+	Position
+	Direction Direction `json:"direction"`
+}
+
+// teleportExit returns the linked exit if pos is a teleporter pad
+func (g *Game) teleportExit(pos Position) (Position, bool) {
+	for _, tp := range g.Teleporters {
+		if tp.A == pos {
+			return tp.B, true
+		}
+		if tp.B == pos {
+			return tp.A, true
+		}
+	}
+	return Position{}, false
+}
+
+// gateAt returns the gate at pos, if any
+func (g *Game) gateAt(pos Position) (Gate, bool) {
+	for _, gate := range g.Gates {
+		if gate.Position == pos {
+			return gate, true
+		}
+	}
+	return Gate{}, false
+}
+
+// isSlowZone checks if a position is inside a slow zone
+func (g *Game) isSlowZone(pos Position) bool {
+	for _, zone := range g.SlowZones {
+		if zone == pos {
+			return true
+		}
+	}
+	return false
+}
+
+// isTransitTile checks if a position is a tile the commander passes through
+// without leaving a trail (teleporter pads and gates), so they can be reused
+func (g *Game) isTransitTile(pos Position) bool {
+	if _, ok := g.teleportExit(pos); ok {
+		return true
+	}
+	_, ok := g.gateAt(pos)
+	return ok
+}
+
+// isSpecialTile checks if a position holds a teleporter, gate, or slow zone
+func (g *Game) isSpecialTile(pos Position) bool {
+	return g.isTransitTile(pos) || g.isSlowZone(pos)
+}
+
+// addSpecialTiles places teleporters, gates, and slow zones for the current level
+func (g *Game) addSpecialTiles() {
+	if g.Level >= 2 {
+		g.addSlowZone(3, 2)
+	}
+	if g.Level >= 4 {
+		g.addGates(2)
+	}
+	if g.Level >= 6 {
+		g.addTeleporter()
+	}
+
+	if len(g.Teleporters)+len(g.Gates)+len(g.SlowZones) > 0 {
+		g.logGameMetric("special_tiles", len(g.Teleporters)*2+len(g.Gates)+len(g.SlowZones),
+			fmt.Sprintf("Teleporters: %d, gates: %d, slow cells: %d",
+				len(g.Teleporters), len(g.Gates), len(g.SlowZones)))
+	}
+}
+
+// randomTilePosition finds a free cell away from the walls and the commander spawn
+func (g *Game) randomTilePosition() (Position, bool) {
+	centerX, centerY := g.Width/2, g.Height/2
+
+	for attempts := 0; attempts < 50; attempts++ {
+		x := 2 + g.rng.Intn(max(1, g.Width-4))
+		y := 2 + g.rng.Intn(max(1, g.Height-4))
+		pos := Position{X: x, Y: y}
+
+		// Maintain 3x3 safe zone around commander spawn
+		if abs(x-centerX) <= 2 && abs(y-centerY) <= 2 {
+			continue
+		}
+
+		if !g.isPositionOccupied(pos) {
+			return pos, true
+		}
+	}
+	return Position{}, false
+}
+
+// addSlowZone adds a rectangular slow zone of the given size
+func (g *Game) addSlowZone(width, height int) {
+	origin, ok := g.randomTilePosition()
+	if !ok {
+		return
+	}
+
+	centerX, centerY := g.Width/2, g.Height/2
+	for dx := 0; dx < width; dx++ {
+		for dy := 0; dy < height; dy++ {
+			pos := Position{X: origin.X + dx, Y: origin.Y + dy}
+			if pos.X >= g.Width-1 || pos.Y >= g.Height-1 {
+				continue
+			}
+			if abs(pos.X-centerX) <= 2 && abs(pos.Y-centerY) <= 2 {
+				continue
+			}
+			if !g.isPositionOccupied(pos) {
+				g.SlowZones = append(g.SlowZones, pos)
+			}
+		}
+	}
+}
+
+// addGates adds one-way gates with random allowed directions
+func (g *Game) addGates(count int) {
+	for i := 0; i < count; i++ {
+		pos, ok := g.randomTilePosition()
+		if !ok {
+			return
+		}
+		g.Gates = append(g.Gates, Gate{Position: pos, Direction: Direction(g.rng.Intn(4))})
+	}
+}
+
+// addTeleporter adds a linked pair of teleporter pads
+func (g *Game) addTeleporter() {
+	a, ok := g.randomTilePosition()
+	if !ok {
+		return
+	}
+
+	for attempts := 0; attempts < 10; attempts++ {
+		b, ok := g.randomTilePosition()
+		if ok && b != a {
+			g.Teleporters = append(g.Teleporters, Teleporter{A: a, B: b})
+			return
+		}
+	}
+}
@@ -8,6 +8,23 @@ import (
 	"github.com/NathanNam/incident-commander-game/internal/game"
 )
 
+// Controller receives player controls. *game.Game is controlled directly; in
+// server-authoritative play the controls are sent to the server instead.
+type Controller interface {
+	SetDirection(dir game.Direction)
+	Pause()
+	Restart()
+	Rollback() bool
+	GetRollbacksLeft() int
+}
+
+// EditorTarget receives paint strokes from the level editor canvas
+type EditorTarget interface {
+	PaintCell(x, y int, dragging bool)
+	EndStroke()
+	GridSize() (width, height int)
+}
+
 // InputHandler manages input events
 type InputHandler struct {
 	keyCallback              js.Func
@@ -15,6 +32,10 @@ type InputHandler struct {
 	touchEndCallback         js.Func
 	touchStartX, touchStartY float64
 
+	// Level editor paint events
+	editorCallbacks []js.Func
+	painting        bool
+
 	// Instrumentation fields
 	keyPressCount     int64
 	touchEventCount   int64
@@ -49,7 +70,7 @@ func New() *InputHandler {
 }
 
 // SetupEventListeners sets up keyboard and touch event listeners
-func (h *InputHandler) SetupEventListeners(g *game.Game) {
+func (h *InputHandler) SetupEventListeners(g Controller) {
 	document := js.Global().Get("document")
 
 	// Keyboard events
@@ -86,6 +107,11 @@ func (h *InputHandler) SetupEventListeners(g *game.Game) {
 			event.Call("preventDefault")
 			g.Restart()
 			h.logInputMetric("game_control", "restart", "Keyboard restart")
+		case "b", "B", "Backspace":
+			event.Call("preventDefault")
+			if g.Rollback() {
+				h.logInputMetric("game_control", "rollback", fmt.Sprintf("Rollbacks left: %d", g.GetRollbacksLeft()))
+			}
 		}
 
 		// Report metrics every 50 key presses
@@ -103,7 +129,7 @@ func (h *InputHandler) SetupEventListeners(g *game.Game) {
 }
 
 // setupTouchEvents sets up touch events for mobile controls
-func (h *InputHandler) setupTouchEvents(g *game.Game) {
+func (h *InputHandler) setupTouchEvents(g Controller) {
 	canvas := js.Global().Get("document").Call("getElementById", "game-canvas")
 
 	// Touch start
@@ -188,7 +214,7 @@ func (h *InputHandler) setupTouchEvents(g *game.Game) {
 }
 
 // setupOnScreenButtons sets up on-screen button controls
-func (h *InputHandler) setupOnScreenButtons(g *game.Game) {
+func (h *InputHandler) setupOnScreenButtons(g Controller) {
 	document := js.Global().Get("document")
 
 	// Direction buttons
@@ -246,6 +272,96 @@ func (h *InputHandler) setupOnScreenButtons(g *game.Game) {
 		})
 		restartBtn.Call("addEventListener", "touchstart", restartCallback)
 	}
+
+	// Rollback button
+	rollbackBtn := document.Call("getElementById", "btn-rollback")
+	if !rollbackBtn.IsNull() {
+		rollbackCallback := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			args[0].Call("preventDefault")
+			h.buttonPressCount++
+			if g.Rollback() {
+				h.logInputMetric("button_press", "rollback",
+					fmt.Sprintf("Button presses: %d, rollbacks left: %d", h.buttonPressCount, g.GetRollbacksLeft()))
+			}
+			return nil
+		})
+		rollbackBtn.Call("addEventListener", "touchstart", rollbackCallback)
+	}
+}
+
+// SetupEditorListeners turns mouse and touch events on the canvas into paint strokes
+// on the level editor grid
+func (h *InputHandler) SetupEditorListeners(target EditorTarget) {
+	canvas := js.Global().Get("document").Call("getElementById", "game-canvas")
+
+	// paintAt converts client coordinates to a grid cell and paints it
+	paintAt := func(clientX, clientY float64, dragging bool) {
+		rect := canvas.Call("getBoundingClientRect")
+		width, height := target.GridSize()
+		if rect.Get("width").Float() == 0 || rect.Get("height").Float() == 0 {
+			return
+		}
+
+		// Canvas pixels per CSS pixel, then the renderer's square cell size
+		px := (clientX - rect.Get("left").Float()) * canvas.Get("width").Float() / rect.Get("width").Float()
+		py := (clientY - rect.Get("top").Float()) * canvas.Get("height").Float() / rect.Get("height").Float()
+		canvasSize := min(canvas.Get("width").Int(), canvas.Get("height").Int())
+		cellSize := canvasSize / max(width, height)
+		if cellSize == 0 {
+			return
+		}
+
+		target.PaintCell(int(px)/cellSize, int(py)/cellSize, dragging)
+	}
+
+	mouseDown := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		event := args[0]
+		event.Call("preventDefault")
+		h.painting = true
+		paintAt(event.Get("clientX").Float(), event.Get("clientY").Float(), false)
+		return nil
+	})
+	mouseMove := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if h.painting {
+			event := args[0]
+			paintAt(event.Get("clientX").Float(), event.Get("clientY").Float(), true)
+		}
+		return nil
+	})
+	strokeEnd := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if h.painting {
+			h.painting = false
+			target.EndStroke()
+		}
+		return nil
+	})
+	touchStart := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		touches := args[0].Get("touches")
+		if touches.Get("length").Int() > 0 {
+			h.painting = true
+			touch := touches.Index(0)
+			paintAt(touch.Get("clientX").Float(), touch.Get("clientY").Float(), false)
+		}
+		return nil
+	})
+	touchMove := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		touches := args[0].Get("touches")
+		if h.painting && touches.Get("length").Int() > 0 {
+			touch := touches.Index(0)
+			paintAt(touch.Get("clientX").Float(), touch.Get("clientY").Float(), true)
+		}
+		return nil
+	})
+
+	canvas.Call("addEventListener", "mousedown", mouseDown)
+	canvas.Call("addEventListener", "mousemove", mouseMove)
+	js.Global().Call("addEventListener", "mouseup", strokeEnd)
+	canvas.Call("addEventListener", "touchstart", touchStart)
+	canvas.Call("addEventListener", "touchmove", touchMove)
+	canvas.Call("addEventListener", "touchend", strokeEnd)
+
+	h.editorCallbacks = append(h.editorCallbacks, mouseDown, mouseMove, strokeEnd, touchStart, touchMove)
+	h.logInputMetric("editor_listeners", "initialized", "Level editor paint events configured")
 }
 
 // reportInputMetrics reports comprehensive input metrics
@@ -273,6 +389,9 @@ func (h *InputHandler) Cleanup() {
 	if !h.touchEndCallback.IsUndefined() {
 		h.touchEndCallback.Release()
 	}
+	for _, callback := range h.editorCallbacks {
+		callback.Release()
+	}
 }
 
 // abs returns the absolute value of a float64
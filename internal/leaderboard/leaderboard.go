@@ -0,0 +1,351 @@
+package leaderboard
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/NathanNam/incident-commander-game/internal/game"
+)
+
+// Time windows for leaderboard queries
+const (
+	WindowDaily   = "daily"
+	WindowWeekly  = "weekly"
+	WindowAllTime = "all"
+)
+
+// Difficulties a score can be submitted under
+const (
+	DifficultyNormal = "normal"
+	DifficultyHard   = "hard" // Daily challenges played with fog of war
+)
+
+// MaxPageSize caps the number of entries returned by one query
+const MaxPageSize = 100
+
+// ErrDuplicateReplay is returned when a replay was already ranked under another run
+var ErrDuplicateReplay = errors.New("replay was already submitted for another run")
+
+var (
+	idPattern   = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+	modePattern = regexp.MustCompile(`^[a-z0-9_:-]{1,40}$`)
+)
+
+// Entry is one submitted score. Entries with the same run ID replace each other,
+// so a run that continues after a rollback keeps only its latest score.
+type Entry struct {
+	RunID      string    `json:"run_id"`
+	PlayerID   string    `json:"player_id"`
+	Name       string    `json:"name"`
+	Score      int       `json:"score"`
+	Level      int       `json:"level"`
+	Mode       string    `json:"mode"`
+	Difficulty string    `json:"difficulty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplayHash string    `json:"replay_hash,omitempty"` // Set for verified runs; empty for server play
+}
+
+// Submission is a score posted by a client with the replay that produced it.
+// Only the entry is stored once the server has verified the replay.
+type Submission struct {
+	Entry
+	Replay game.Replay `json:"replay"`
+}
+
+// Validate checks a submitted entry and normalizes its name
+func (e *Entry) Validate() error {
+	if !idPattern.MatchString(e.RunID) {
+		return errors.New("invalid run ID")
+	}
+	if !idPattern.MatchString(e.PlayerID) {
+		return errors.New("invalid player ID")
+	}
+	if !modePattern.MatchString(e.Mode) {
+		return fmt.Errorf("invalid mode %q", e.Mode)
+	}
+	if e.Difficulty != DifficultyNormal && e.Difficulty != DifficultyHard {
+		return fmt.Errorf("invalid difficulty %q", e.Difficulty)
+	}
+	if e.Score < 0 || e.Level < 1 || e.Level > 10 {
+		return errors.New("score or level out of range")
+	}
+
+	e.Name = strings.TrimSpace(e.Name)
+	if e.Name == "" {
+		e.Name = "Anonymous"
+	}
+	if !utf8.ValidString(e.Name) || utf8.RuneCountInString(e.Name) > 24 {
+		return errors.New("name must be at most 24 characters")
+	}
+	return nil
+}
+
+// Query selects a page of the leaderboard. Empty mode or difficulty matches any.
+type Query struct {
+	Mode       string
+	Difficulty string
+	Window     string
+	Offset     int
+	Limit      int
+	Player     string // Entries of this player are marked as theirs
+}
+
+// RankedEntry is the public view of an entry with its position on the
+// leaderboard. Player IDs are left out, since the leaderboard is public.
+type RankedEntry struct {
+	Rank       int       `json:"rank"`
+	RunID      string    `json:"run_id"`
+	Name       string    `json:"name"`
+	Score      int       `json:"score"`
+	Level      int       `json:"level"`
+	Mode       string    `json:"mode"`
+	Difficulty string    `json:"difficulty"`
+	CreatedAt  time.Time `json:"created_at"`
+	Mine       bool      `json:"mine,omitempty"` // The entry is the querying player's
+}
+
+// Page is one page of query results
+type Page struct {
+	Entries []RankedEntry `json:"entries"`
+	Total   int           `json:"total"`
+	Offset  int           `json:"offset"`
+	Limit   int           `json:"limit"`
+}
+
+// Store keeps scores in an append-only JSON lines file with an in-memory index
+// of entries sorted by score for each mode and difficulty combination
+type Store struct {
+	mu      sync.RWMutex
+	file    *os.File
+	runs    map[string]*Entry   // Latest entry per run
+	index   map[string][]*Entry // Sorted best first, keyed by indexKey
+	replays map[string]string   // Run ID per replay hash, kept after the run moves on
+}
+
+// Open loads the store from path, creating the file if it doesn't exist.
+// A truncated last line from an interrupted write is skipped.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		file:    file,
+		runs:    make(map[string]*Entry),
+		index:   make(map[string][]*Entry),
+		replays: make(map[string]string),
+	}
+
+	var good int64 // Bytes of complete, valid lines
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			if !scanner.Scan() {
+				// Drop the partial line so new entries start on a fresh line
+				if err := file.Truncate(good); err != nil {
+					file.Close()
+					return nil, err
+				}
+				break
+			}
+			file.Close()
+			return nil, fmt.Errorf("corrupt leaderboard %s at line %d: %w", path, line, err)
+		}
+		s.insert(&entry)
+		good += int64(len(scanner.Bytes())) + 1
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// ReplayRun returns the run that submitted a replay hash, if any
+func (s *Store) ReplayRun(hash string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	run, ok := s.replays[hash]
+	return run, ok
+}
+
+// Close closes the underlying file
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// Submit validates an entry, appends it to the file, and indexes it.
+// Returns the entry's all-time rank within its mode and difficulty.
+func (s *Store) Submit(entry Entry) (int, error) {
+	if err := entry.Validate(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A run can only belong to the player that started it
+	if previous, ok := s.runs[entry.RunID]; ok && previous.PlayerID != entry.PlayerID {
+		return 0, errors.New("run belongs to another player")
+	}
+	// A replay can only be ranked once, under the run that first submitted it
+	if run, ok := s.replays[entry.ReplayHash]; ok && entry.ReplayHash != "" && run != entry.RunID {
+		return 0, ErrDuplicateReplay
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return 0, err
+	}
+	if err := s.file.Sync(); err != nil {
+		return 0, err
+	}
+
+	s.insert(&entry)
+
+	for i, e := range s.index[indexKey(entry.Mode, entry.Difficulty)] {
+		if e == &entry {
+			return i + 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// Query returns a page of entries, best first
+func (s *Store) Query(q Query, now time.Time) Page {
+	if q.Limit <= 0 || q.Limit > MaxPageSize {
+		q.Limit = 10
+	}
+	q.Offset = max(0, q.Offset)
+	since := windowStart(q.Window, now)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	page := Page{Entries: make([]RankedEntry, 0, q.Limit), Offset: q.Offset, Limit: q.Limit}
+	for _, e := range s.index[indexKey(q.Mode, q.Difficulty)] {
+		if e.CreatedAt.Before(since) {
+			continue
+		}
+		if page.Total >= q.Offset && len(page.Entries) < q.Limit {
+			page.Entries = append(page.Entries, RankedEntry{
+				Rank:       page.Total + 1,
+				RunID:      e.RunID,
+				Name:       e.Name,
+				Score:      e.Score,
+				Level:      e.Level,
+				Mode:       e.Mode,
+				Difficulty: e.Difficulty,
+				CreatedAt:  e.CreatedAt,
+				Mine:       q.Player != "" && e.PlayerID == q.Player,
+			})
+		}
+		page.Total++
+	}
+	return page
+}
+
+// insert indexes an entry, replacing the previous entry of the same run
+func (s *Store) insert(entry *Entry) {
+	if previous, ok := s.runs[entry.RunID]; ok {
+		for _, key := range indexKeys(previous) {
+			s.index[key] = remove(s.index[key], previous)
+		}
+	}
+	s.runs[entry.RunID] = entry
+	if _, ok := s.replays[entry.ReplayHash]; !ok && entry.ReplayHash != "" {
+		s.replays[entry.ReplayHash] = entry.RunID
+	}
+
+	for _, key := range indexKeys(entry) {
+		entries := s.index[key]
+		i := sort.Search(len(entries), func(i int) bool { return better(entry, entries[i]) })
+		entries = append(entries, nil)
+		copy(entries[i+1:], entries[i:])
+		entries[i] = entry
+		s.index[key] = entries
+	}
+}
+
+// better orders entries by score, then by who got there first
+func better(a, b *Entry) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.CreatedAt.Before(b.CreatedAt)
+}
+
+// indexKey names the index for a mode and difficulty; empty values match any
+func indexKey(mode, difficulty string) string {
+	if mode == "" {
+		mode = "*"
+	}
+	if difficulty == "" {
+		difficulty = "*"
+	}
+	return mode + "|" + difficulty
+}
+
+// indexKeys returns every index an entry belongs to
+func indexKeys(e *Entry) []string {
+	return []string{
+		indexKey(e.Mode, e.Difficulty),
+		indexKey(e.Mode, ""),
+		indexKey("", e.Difficulty),
+		indexKey("", ""),
+	}
+}
+
+func remove(entries []*Entry, entry *Entry) []*Entry {
+	for i, e := range entries {
+		if e == entry {
+			return append(entries[:i], entries[i+1:]...)
+		}
+	}
+	return entries
+}
+
+// windowStart returns the earliest time included in a window, in UTC.
+// Weekly windows start on Monday.
+func windowStart(window string, now time.Time) time.Time {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch window {
+	case WindowDaily:
+		return day
+	case WindowWeekly:
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	default:
+		return time.Time{}
+	}
+}
+
+// ValidWindow checks if a window name is supported; empty means all-time
+func ValidWindow(window string) bool {
+	switch window {
+	case "", WindowDaily, WindowWeekly, WindowAllTime:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,294 @@
+package leaderboard
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+var testTime = time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC) // A Wednesday
+
+// openTemp opens a store in a new temporary directory and returns its path
+func openTemp(t *testing.T) (*Store, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "leaderboard.jsonl")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, path
+}
+
+// entry returns a valid classic entry for a run
+func entry(runID, playerID string, score int, createdAt time.Time) Entry {
+	return Entry{
+		RunID:      runID,
+		PlayerID:   playerID,
+		Name:       playerID,
+		Score:      score,
+		Level:      1,
+		Mode:       "classic",
+		Difficulty: DifficultyNormal,
+		CreatedAt:  createdAt,
+	}
+}
+
+// runIDs lists a page's run IDs in order
+func runIDs(page Page) []string {
+	ids := make([]string, len(page.Entries))
+	for i, e := range page.Entries {
+		ids[i] = e.RunID
+	}
+	return ids
+}
+
+func TestSubmitOrder(t *testing.T) {
+	s, _ := openTemp(t)
+
+	submissions := []Entry{
+		entry("run_a", "p1", 100, testTime),
+		entry("run_b", "p2", 300, testTime),
+		entry("run_c", "p3", 200, testTime),
+		entry("run_d", "p4", 200, testTime.Add(-time.Minute)), // Tied, but got there first
+		entry("run_e", "p5", 50, testTime),
+	}
+	wantRanks := []int{1, 1, 2, 2, 5}
+	for i, e := range submissions {
+		rank, err := s.Submit(e)
+		if err != nil {
+			t.Fatalf("Submit(%s): %v", e.RunID, err)
+		}
+		if rank != wantRanks[i] {
+			t.Errorf("Submit(%s) rank = %d, want %d", e.RunID, rank, wantRanks[i])
+		}
+	}
+
+	page := s.Query(Query{Mode: "classic", Difficulty: DifficultyNormal}, testTime)
+	if want := []string{"run_b", "run_d", "run_c", "run_a", "run_e"}; !slices.Equal(runIDs(page), want) {
+		t.Errorf("order = %v, want %v", runIDs(page), want)
+	}
+	for i, e := range page.Entries {
+		if e.Rank != i+1 {
+			t.Errorf("%s has rank %d, want %d", e.RunID, e.Rank, i+1)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	s, _ := openTemp(t)
+	entries := []Entry{
+		entry("run_today", "p1", 100, testTime),
+		entry("run_monday", "p2", 300, testTime.AddDate(0, 0, -2)),
+		entry("run_last_week", "p3", 500, testTime.AddDate(0, 0, -7)),
+	}
+	daily := entry("run_daily", "p1", 400, testTime)
+	daily.Mode, daily.Difficulty = "daily:2026-10-14", DifficultyHard
+	entries = append(entries, daily)
+	for _, e := range entries {
+		if _, err := s.Submit(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+		total int
+	}{
+		{"all modes", Query{}, []string{"run_last_week", "run_daily", "run_monday", "run_today"}, 4},
+		{"classic", Query{Mode: "classic"}, []string{"run_last_week", "run_monday", "run_today"}, 3},
+		{"hard", Query{Difficulty: DifficultyHard}, []string{"run_daily"}, 1},
+		{"today", Query{Mode: "classic", Window: WindowDaily}, []string{"run_today"}, 1},
+		{"this week", Query{Mode: "classic", Window: WindowWeekly}, []string{"run_monday", "run_today"}, 2},
+		{"second page", Query{Offset: 1, Limit: 2}, []string{"run_daily", "run_monday"}, 4},
+		{"past the end", Query{Offset: 10}, []string{}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := s.Query(tt.query, testTime)
+			if !slices.Equal(runIDs(page), tt.want) || page.Total != tt.total {
+				t.Errorf("got %v of %d, want %v of %d", runIDs(page), page.Total, tt.want, tt.total)
+			}
+		})
+	}
+
+	page := s.Query(Query{Player: "p1"}, testTime)
+	for _, e := range page.Entries {
+		if mine := e.RunID == "run_today" || e.RunID == "run_daily"; e.Mine != mine {
+			t.Errorf("%s: mine = %v, want %v", e.RunID, e.Mine, mine)
+		}
+	}
+}
+
+func TestSubmitReplacesRun(t *testing.T) {
+	s, path := openTemp(t)
+
+	if _, err := s.Submit(entry("run_a", "p1", 100, testTime)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Submit(entry("run_b", "p2", 200, testTime)); err != nil {
+		t.Fatal(err)
+	}
+	// The run continued after a rollback and scored more
+	rank, err := s.Submit(entry("run_a", "p1", 300, testTime.Add(time.Minute)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rank != 1 {
+		t.Errorf("rank = %d, want 1", rank)
+	}
+	if _, err := s.Submit(entry("run_a", "p2", 400, testTime)); err == nil {
+		t.Error("another player replaced the run")
+	}
+
+	check := func(s *Store) {
+		t.Helper()
+		page := s.Query(Query{}, testTime)
+		if want := []string{"run_a", "run_b"}; !slices.Equal(runIDs(page), want) {
+			t.Fatalf("order = %v, want %v", runIDs(page), want)
+		}
+		if page.Entries[0].Score != 300 {
+			t.Errorf("run_a score = %d, want 300", page.Entries[0].Score)
+		}
+	}
+	check(s)
+
+	// Reloading replays the file, replacements included
+	s.Close()
+	reloaded, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+	check(reloaded)
+}
+
+func TestSubmitDuplicateReplay(t *testing.T) {
+	s, path := openTemp(t)
+
+	first := entry("run_a", "p1", 100, testTime)
+	first.ReplayHash = "hash_a"
+	if _, err := s.Submit(first); err != nil {
+		t.Fatal(err)
+	}
+	// The run continued after a rollback, so its new replay has a new hash
+	continued := entry("run_a", "p1", 300, testTime)
+	continued.ReplayHash = "hash_a2"
+	if _, err := s.Submit(continued); err != nil {
+		t.Fatal(err)
+	}
+	// Server play has no replay to compare
+	for _, runID := range []string{"run_b", "run_c"} {
+		if _, err := s.Submit(entry(runID, "p2", 50, testTime)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check := func(s *Store) {
+		t.Helper()
+		for _, hash := range []string{"hash_a", "hash_a2"} {
+			copied := entry("run_copy", "p1", 300, testTime)
+			copied.ReplayHash = hash
+			if _, err := s.Submit(copied); !errors.Is(err, ErrDuplicateReplay) {
+				t.Errorf("resubmitting %s under a new run: err = %v, want ErrDuplicateReplay", hash, err)
+			}
+			if run, ok := s.ReplayRun(hash); !ok || run != "run_a" {
+				t.Errorf("ReplayRun(%s) = %q, %v; want run_a", hash, run, ok)
+			}
+		}
+	}
+	check(s)
+
+	s.Close()
+	reloaded, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+	check(reloaded)
+}
+
+func TestOpenTruncatedLastLine(t *testing.T) {
+	s, path := openTemp(t)
+	for _, e := range []Entry{entry("run_a", "p1", 100, testTime), entry("run_b", "p2", 200, testTime)} {
+		if _, err := s.Submit(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+
+	// An interrupted write leaves half a line
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"run_id":"run_c","player_id":"p3","sco`)
+	f.Close()
+
+	reloaded, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open with a truncated last line: %v", err)
+	}
+	if _, err := reloaded.Submit(entry("run_d", "p4", 50, testTime)); err != nil {
+		t.Fatal(err)
+	}
+	reloaded.Close()
+
+	// The partial line is gone and the new entry starts on its own line
+	again, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open after appending: %v", err)
+	}
+	defer again.Close()
+	if want := []string{"run_b", "run_a", "run_d"}; !slices.Equal(runIDs(again.Query(Query{}, testTime)), want) {
+		t.Errorf("order = %v, want %v", runIDs(again.Query(Query{}, testTime)), want)
+	}
+}
+
+func TestOpenCorruptLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leaderboard.jsonl")
+	data := `{"run_id":"run_a","player_id":"p1","score":1,"level":1,"mode":"classic","difficulty":"normal"}` + "\n" +
+		"not json\n" +
+		`{"run_id":"run_b","player_id":"p2","score":2,"level":1,"mode":"classic","difficulty":"normal"}` + "\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := Open(path); err == nil {
+		s.Close()
+		t.Error("Open accepted a corrupt line in the middle of the file")
+	}
+}
+
+func TestEntryValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(e *Entry)
+		wantErr bool
+	}{
+		{"valid", func(e *Entry) {}, false},
+		{"bad run ID", func(e *Entry) { e.RunID = "run a" }, true},
+		{"bad player ID", func(e *Entry) { e.PlayerID = "" }, true},
+		{"bad mode", func(e *Entry) { e.Mode = "Classic!" }, true},
+		{"bad difficulty", func(e *Entry) { e.Difficulty = "easy" }, true},
+		{"negative score", func(e *Entry) { e.Score = -1 }, true},
+		{"level too high", func(e *Entry) { e.Level = 11 }, true},
+		{"long name", func(e *Entry) { e.Name = "abcdefghijklmnopqrstuvwxy" }, true},
+		{"blank name", func(e *Entry) { e.Name = "  " }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := entry("run_a", "p1", 10, testTime)
+			tt.modify(&e)
+			if err := e.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package netplay
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/NathanNam/incident-commander-game/internal/game"
+)
+
+// Spectator stream message types
+const (
+	TypeKeyframe = "keyframe" // A full frame; sent first and whenever the board changes
+	TypeDelta    = "delta"    // Changes since the previous frame
+	TypeEnd      = "end"      // The watched session ended
+)
+
+// StreamMessage carries a game's state to the server while it's played in a
+// browser, and from the server to spectators
+type StreamMessage struct {
+	Type      string           `json:"type"`
+	SessionID string           `json:"session_id,omitempty"` // Set in the server's welcome and on keyframes for spectators
+	Name      string           `json:"name,omitempty"`       // Player being watched, on keyframes for spectators
+	Frame     *game.StateFrame `json:"frame,omitempty"`
+	Delta     *Delta           `json:"delta,omitempty"`
+}
+
+// Delta is the compact change between two frames of the same level. Keys are
+// short because one is sent every tick.
+type Delta struct {
+	Tick       int             `json:"t"`
+	Commander  *game.Position  `json:"c,omitempty"`
+	Direction  *game.Direction `json:"d,omitempty"`
+	TrailCut   *int            `json:"tc,omitempty"` // Trail shortened to this length, e.g. by a rollback
+	TrailAdd   []game.Position `json:"ta,omitempty"` // Cells appended to the trail
+	AlertsAdd  []DeltaAlert    `json:"aa,omitempty"` // Spawned alerts
+	AlertsDel  []game.Position `json:"ad,omitempty"` // Collected alerts
+	RewindPath []game.Position `json:"rp,omitempty"` // Path of a new rollback
+	Stats      *DeltaStats     `json:"s,omitempty"`  // Set when any stat changed
+}
+
+// DeltaAlert is a spawned alert and its service in scenario mode
+type DeltaAlert struct {
+	game.Position
+	Service string `json:"s,omitempty"`
+}
+
+// DeltaStats are the scalar parts of a frame
+type DeltaStats struct {
+	State           game.GameState `json:"st"`
+	Score           int            `json:"sc"`
+	Level           int            `json:"l"`
+	AlertsCollected int            `json:"ac"`
+	AlertsNeeded    int            `json:"an"`
+	RollbacksLeft   int            `json:"rb"`
+	CanRollback     bool           `json:"cr,omitempty"`
+}
+
+// errDeltaMismatch is returned when a delta doesn't fit the frame it's applied to
+var errDeltaMismatch = errors.New("delta doesn't match the frame")
+
+// Diff returns the delta from prev to next. Returns false when the two frames
+// aren't from the same run and level, which needs a keyframe instead.
+func Diff(prev, next game.StateFrame) (Delta, bool) {
+	if prev.RunID != next.RunID || prev.Level != next.Level ||
+		prev.Width != next.Width || prev.Height != next.Height ||
+		!slices.Equal(prev.Obstacles, next.Obstacles) ||
+		!slices.Equal(prev.Teleporters, next.Teleporters) ||
+		!slices.Equal(prev.Gates, next.Gates) ||
+		!slices.Equal(prev.SlowZones, next.SlowZones) {
+		return Delta{}, false
+	}
+
+	d := Delta{Tick: next.Tick}
+	if next.Commander != prev.Commander {
+		d.Commander = &next.Commander
+	}
+	if next.Direction != prev.Direction {
+		d.Direction = &next.Direction
+	}
+
+	// The trail only grows, except when a rollback cuts it back
+	common := 0
+	for common < len(prev.Trail) && common < len(next.Trail) && prev.Trail[common] == next.Trail[common] {
+		common++
+	}
+	if common < len(prev.Trail) {
+		d.TrailCut = &common
+	}
+	d.TrailAdd = next.Trail[common:]
+
+	prevAlerts := make(map[game.Position]bool, len(prev.Alerts))
+	for _, alert := range prev.Alerts {
+		prevAlerts[alert] = true
+	}
+	for i, alert := range next.Alerts {
+		if prevAlerts[alert] {
+			delete(prevAlerts, alert)
+			continue
+		}
+		added := DeltaAlert{Position: alert}
+		if i < len(next.AlertServices) {
+			added.Service = next.AlertServices[i]
+		}
+		d.AlertsAdd = append(d.AlertsAdd, added)
+	}
+	for _, alert := range prev.Alerts {
+		if prevAlerts[alert] {
+			d.AlertsDel = append(d.AlertsDel, alert)
+		}
+	}
+
+	if len(next.RewindPath) > 0 && !slices.Equal(prev.RewindPath, next.RewindPath) {
+		d.RewindPath = next.RewindPath
+	}
+
+	stats := frameStats(next)
+	if stats != frameStats(prev) {
+		d.Stats = &stats
+	}
+	return d, true
+}
+
+// frameStats returns a frame's scalar parts
+func frameStats(f game.StateFrame) DeltaStats {
+	return DeltaStats{
+		State:           f.State,
+		Score:           f.Score,
+		Level:           f.Level,
+		AlertsCollected: f.AlertsCollected,
+		AlertsNeeded:    f.AlertsNeeded,
+		RollbacksLeft:   f.RollbacksLeft,
+		CanRollback:     f.CanRollback,
+	}
+}
+
+// Apply updates a frame with a delta made against it
+func (d *Delta) Apply(f *game.StateFrame) error {
+	if d.TrailCut != nil {
+		if *d.TrailCut < 0 || *d.TrailCut > len(f.Trail) {
+			return errDeltaMismatch
+		}
+		// Clipped so the next append doesn't overwrite cells an earlier copy of the frame still shows
+		f.Trail = slices.Clip(f.Trail[:*d.TrailCut])
+	}
+	if len(f.Trail)+len(d.TrailAdd) > f.Width*f.Height {
+		return errDeltaMismatch
+	}
+	f.Trail = append(f.Trail, d.TrailAdd...)
+
+	if len(d.AlertsDel) > 0 {
+		collected := make(map[game.Position]bool, len(d.AlertsDel))
+		for _, alert := range d.AlertsDel {
+			collected[alert] = true
+		}
+		alerts := f.Alerts[:0:0]
+		var services []string
+		for i, alert := range f.Alerts {
+			if collected[alert] {
+				continue
+			}
+			alerts = append(alerts, alert)
+			if i < len(f.AlertServices) {
+				services = append(services, f.AlertServices[i])
+			}
+		}
+		f.Alerts, f.AlertServices = alerts, services
+	}
+	if len(f.Alerts)+len(d.AlertsAdd) > f.Width*f.Height {
+		return errDeltaMismatch
+	}
+	for _, added := range d.AlertsAdd {
+		f.Alerts = append(f.Alerts, added.Position)
+		if f.Scenario != nil {
+			f.AlertServices = append(f.AlertServices, added.Service)
+		}
+	}
+
+	f.Tick = d.Tick
+	if d.Commander != nil {
+		f.Commander = *d.Commander
+	}
+	if d.Direction != nil {
+		f.Direction = *d.Direction
+	}
+	if d.RewindPath != nil {
+		f.RewindPath = d.RewindPath
+	}
+	if s := d.Stats; s != nil {
+		f.State = s.State
+		f.Score = s.Score
+		f.Level = s.Level
+		f.AlertsCollected = s.AlertsCollected
+		f.AlertsNeeded = s.AlertsNeeded
+		f.RollbacksLeft = s.RollbacksLeft
+		f.CanRollback = s.CanRollback
+	}
+	if f.State != game.Rewinding {
+		f.RewindPath = nil
+	}
+	return nil
+}
+
+// CheckFrame checks that a keyframe from a browser is within the game's limits
+// before the server keeps it
+func CheckFrame(f *game.StateFrame) error {
+	if f.Width < 5 || f.Height < 5 || f.Width > 60 || f.Height > 60 {
+		return errors.New("board size out of range")
+	}
+	cells := f.Width * f.Height
+	if len(f.Trail) > cells || len(f.Alerts) > cells || len(f.Obstacles) > cells || len(f.RewindPath) > cells {
+		return errors.New("frame has more positions than the board has cells")
+	}
+	return nil
+}
+
+// Empty reports whether a delta changes nothing but the tick
+func (d *Delta) Empty() bool {
+	return d.Commander == nil && d.Direction == nil && d.TrailCut == nil && len(d.TrailAdd) == 0 &&
+		len(d.AlertsAdd) == 0 && len(d.AlertsDel) == 0 && d.RewindPath == nil && d.Stats == nil
+}
@@ -0,0 +1,38 @@
+// Package netplay defines the messages exchanged over the WebSocket when the
+// game runs on the server and the browser only sends inputs and renders frames.
+package netplay
+
+import "github.com/NathanNam/incident-commander-game/internal/game"
+
+// Server message types
+const (
+	TypeWelcome = "welcome" // Sent once per connection with the session to reconnect to
+	TypeFrame   = "frame"   // Sent every tick with the game's state
+)
+
+// Client message types
+const (
+	TypeInput   = "input"   // A player input such as a turn, pause, or rollback
+	TypeRestart = "restart" // Start a new run in the same session
+)
+
+// CloseSessionEnded is the WebSocket close code of a session the server ended,
+// e.g. after a finished run. It can't be resumed, so the client waits for the
+// player to restart instead of reconnecting.
+const CloseSessionEnded = 4000
+
+// ServerMessage is sent from the server to the client
+type ServerMessage struct {
+	Type      string           `json:"type"`
+	SessionID string           `json:"session_id,omitempty"`
+	Token     string           `json:"token,omitempty"`  // Secret needed to reconnect to the session
+	Ranked    bool             `json:"ranked,omitempty"` // Whether the current run counts for the leaderboard
+	Resync    bool             `json:"resync,omitempty"` // The connection resumed an existing session
+	Frame     *game.StateFrame `json:"frame,omitempty"`
+}
+
+// ClientMessage is sent from the client to the server
+type ClientMessage struct {
+	Type   string      `json:"type"`
+	Action game.Action `json:"action,omitempty"`
+}
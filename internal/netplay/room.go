@@ -0,0 +1,69 @@
+package netplay
+
+import (
+	"github.com/NathanNam/incident-commander-game/internal/game"
+	"github.com/NathanNam/incident-commander-game/internal/race"
+)
+
+// Room phases
+const (
+	PhaseLobby     = "lobby"     // Players join and get ready
+	PhaseCountdown = "countdown" // Everyone is ready; the race is about to start
+	PhaseRacing    = "racing"
+	PhaseFinished  = "finished" // Results are in; the room closes shortly
+)
+
+// Room message types, server to client
+const (
+	TypeRoom      = "room"      // The room's players and phase; sent whenever either changes
+	TypeCountdown = "countdown" // Seconds until the race starts
+	TypeRace      = "race"      // Sent every tick with the race's state
+	TypeResults   = "results"   // Final placings
+)
+
+// Room message types, client to server. Turns use TypeInput.
+const (
+	TypeReady = "ready" // Set or clear the player's ready check
+	TypeLeave = "leave" // Leave the room, forfeiting a race in progress
+)
+
+// RoomSummary describes an open room in the room list
+type RoomSummary struct {
+	ID      string   `json:"id"`
+	Phase   string   `json:"phase"`
+	Players []string `json:"players"` // Names in seat order
+	Seats   int      `json:"seats"`   // Most players the room takes
+}
+
+// RoomState is a room's lobby as one player sees it
+type RoomState struct {
+	ID      string       `json:"id"`
+	Phase   string       `json:"phase"`
+	Players []RoomPlayer `json:"players"`
+	You     int          `json:"you"` // Seat of the player receiving the state
+}
+
+// RoomPlayer is a seat in a room. Player IDs are never sent to other players.
+type RoomPlayer struct {
+	Seat      int    `json:"seat"`
+	Name      string `json:"name"`
+	Ready     bool   `json:"ready"`
+	Connected bool   `json:"connected"`
+}
+
+// RoomMessage is sent from the server to players in a room
+type RoomMessage struct {
+	Type      string        `json:"type"`
+	Room      *RoomState    `json:"room,omitempty"`
+	Countdown int           `json:"countdown,omitempty"`
+	Race      *race.Frame   `json:"race,omitempty"`
+	Events    []race.Event  `json:"events,omitempty"` // Set on race frames
+	Results   []race.Result `json:"results,omitempty"`
+}
+
+// RoomCommand is sent from a player to the server
+type RoomCommand struct {
+	Type   string      `json:"type"`
+	Ready  bool        `json:"ready,omitempty"`
+	Action game.Action `json:"action,omitempty"`
+}
@@ -0,0 +1,416 @@
+// Package race is the multiplayer game: two to four commanders on one seeded
+// board, racing to collect alerts while avoiding each other's trails.
+package race
+
+import (
+	"math/rand"
+	"slices"
+	"sort"
+
+	"github.com/NathanNam/incident-commander-game/internal/game"
+)
+
+// Race tuning
+const (
+	MinPlayers     = 2
+	MaxPlayers     = 4
+	TargetAlerts   = 10                // The first commander to collect this many wins
+	TickRate       = 6                 // Ticks per second
+	MaxTicks       = 3 * 60 * TickRate // Races end after three minutes
+	alertPoints    = 10                // Points per alert
+	survivalBonus  = 50                // Points for commanders still standing at the end
+	obstacleBlocks = 6                 // 2x2 blocks scattered on the board
+	spawnClearance = 4                 // Cells around each spawn kept free of obstacles
+)
+
+// Reasons a commander is out of the race
+const (
+	CrashWall     = "wall"
+	CrashObstacle = "obstacle"
+	CrashTrail    = "trail"
+	CrashHeadOn   = "head_on" // Two commanders moved into the same cell
+	CrashForfeit  = "forfeit" // Left the race or lost the connection
+)
+
+// Event types
+const (
+	EventAlertCollected = "alert_collected"
+	EventCrash          = "crash"
+	EventFinished       = "finished"
+)
+
+// Player is one commander in the race, identified by its seat
+type Player struct {
+	Seat      int             `json:"seat"`
+	Name      string          `json:"name"`
+	Commander game.Position   `json:"commander"`
+	Direction game.Direction  `json:"direction"`
+	Trail     []game.Position `json:"trail"`
+	Alive     bool            `json:"alive"`
+	Alerts    int             `json:"alerts"`
+	Score     int             `json:"score"`
+	Crash     string          `json:"crash,omitempty"`
+	CrashTick int             `json:"crash_tick,omitempty"`
+
+	moved game.Direction // Direction of the last move; turning back into it is ignored
+}
+
+// Event is something that happened during a tick, for traces and the HUD
+type Event struct {
+	Type  string `json:"type"`
+	Seat  int    `json:"seat"`
+	Tick  int    `json:"tick"`
+	Crash string `json:"crash,omitempty"`
+}
+
+// Result is a commander's final placing
+type Result struct {
+	Rank   int    `json:"rank"`
+	Seat   int    `json:"seat"`
+	Name   string `json:"name"`
+	Score  int    `json:"score"`
+	Alerts int    `json:"alerts"`
+	Alive  bool   `json:"alive"`
+	Crash  string `json:"crash,omitempty"`
+}
+
+// Frame is the race's state for rendering
+type Frame struct {
+	Tick         int             `json:"tick"`
+	Width        int             `json:"width"`
+	Height       int             `json:"height"`
+	Players      []Player        `json:"players"`
+	Alerts       []game.Position `json:"alerts"`
+	Obstacles    []game.Position `json:"obstacles"`
+	TargetAlerts int             `json:"target_alerts"`
+	TicksLeft    int             `json:"ticks_left"`
+	Finished     bool            `json:"finished"`
+}
+
+// Race is one multiplayer game. It is deterministic for a seed and the
+// players' turns, and not safe for concurrent use.
+type Race struct {
+	Width, Height int
+	Tick          int
+	Players       []*Player
+	Alerts        []game.Position
+	Obstacles     []game.Position
+	Finished      bool
+
+	rng    *rand.Rand
+	events []Event
+}
+
+// spawns are the starting corners, each heading along the board's edge
+var spawns = []struct {
+	x, y      func(w, h int) int
+	direction game.Direction
+}{
+	{func(w, h int) int { return 2 }, func(w, h int) int { return 2 }, game.Right},
+	{func(w, h int) int { return w - 3 }, func(w, h int) int { return h - 3 }, game.Left},
+	{func(w, h int) int { return w - 3 }, func(w, h int) int { return 2 }, game.Down},
+	{func(w, h int) int { return 2 }, func(w, h int) int { return h - 3 }, game.Up},
+}
+
+// New creates a race for the named players, seated in order
+func New(width, height int, seed int64, names []string) *Race {
+	r := &Race{
+		Width:  width,
+		Height: height,
+		rng:    rand.New(rand.NewSource(seed)),
+	}
+
+	for seat, name := range names[:min(len(names), MaxPlayers)] {
+		spawn := spawns[seat]
+		r.Players = append(r.Players, &Player{
+			Seat:      seat,
+			Name:      name,
+			Commander: game.Position{X: spawn.x(width, height), Y: spawn.y(width, height)},
+			Direction: spawn.direction,
+			Trail:     make([]game.Position, 0),
+			Alive:     true,
+			moved:     spawn.direction,
+		})
+	}
+
+	r.addObstacles()
+	for len(r.Alerts) < len(r.Players)+2 {
+		if !r.spawnAlert() {
+			break
+		}
+	}
+	return r
+}
+
+// addObstacles scatters 2x2 blocks away from the spawns
+func (r *Race) addObstacles() {
+	for placed, attempts := 0, 0; placed < obstacleBlocks && attempts < 100; attempts++ {
+		x, y := r.rng.Intn(r.Width-1), r.rng.Intn(r.Height-1)
+		block := []game.Position{{X: x, Y: y}, {X: x + 1, Y: y}, {X: x, Y: y + 1}, {X: x + 1, Y: y + 1}}
+		if slices.ContainsFunc(block, r.nearSpawn) {
+			continue
+		}
+		r.Obstacles = append(r.Obstacles, block...)
+		placed++
+	}
+}
+
+// nearSpawn reports whether a cell is within spawnClearance of a starting corner
+func (r *Race) nearSpawn(pos game.Position) bool {
+	for _, spawn := range spawns {
+		dx := pos.X - spawn.x(r.Width, r.Height)
+		dy := pos.Y - spawn.y(r.Width, r.Height)
+		if max(dx, -dx) <= spawnClearance && max(dy, -dy) <= spawnClearance {
+			return true
+		}
+	}
+	return false
+}
+
+// occupied returns every cell a commander can't enter: obstacles and trails
+func (r *Race) occupied() map[game.Position]bool {
+	cells := make(map[game.Position]bool, len(r.Obstacles))
+	for _, obstacle := range r.Obstacles {
+		cells[obstacle] = true
+	}
+	for _, p := range r.Players {
+		for _, segment := range p.Trail {
+			cells[segment] = true
+		}
+	}
+	return cells
+}
+
+// spawnAlert places an alert on a free cell. Returns false if the board is full.
+func (r *Race) spawnAlert() bool {
+	blocked := r.occupied()
+	for _, p := range r.Players {
+		blocked[p.Commander] = true
+	}
+	for _, alert := range r.Alerts {
+		blocked[alert] = true
+	}
+
+	free := make([]game.Position, 0, r.Width*r.Height)
+	for y := 0; y < r.Height; y++ {
+		for x := 0; x < r.Width; x++ {
+			if pos := (game.Position{X: x, Y: y}); !blocked[pos] {
+				free = append(free, pos)
+			}
+		}
+	}
+	if len(free) == 0 {
+		return false
+	}
+	r.Alerts = append(r.Alerts, free[r.rng.Intn(len(free))])
+	return true
+}
+
+// SetDirection turns a commander for its next move, unless it would reverse into its own trail
+func (r *Race) SetDirection(seat int, dir game.Direction) {
+	if seat < 0 || seat >= len(r.Players) || r.Finished {
+		return
+	}
+	p := r.Players[seat]
+	if p.Alive && dir != opposite(p.moved) {
+		p.Direction = dir
+	}
+}
+
+// Forfeit takes a commander out of the race
+func (r *Race) Forfeit(seat int) {
+	if seat < 0 || seat >= len(r.Players) || r.Finished || !r.Players[seat].Alive {
+		return
+	}
+	r.crash(r.Players[seat], CrashForfeit)
+	r.checkFinished()
+}
+
+// Update moves every commander one cell, resolving crashes and collections
+func (r *Race) Update() {
+	if r.Finished {
+		return
+	}
+	r.Tick++
+
+	// Every commander leaves its current cell to its trail
+	targets := make(map[game.Position]int)
+	for _, p := range r.Players {
+		if p.Alive {
+			p.Trail = append(p.Trail, p.Commander)
+			targets[step(p.Commander, p.Direction)]++
+		}
+	}
+
+	// Crashes are decided against the board before anyone moves
+	blocked := r.occupied()
+	obstacles := make(map[game.Position]bool, len(r.Obstacles))
+	for _, obstacle := range r.Obstacles {
+		obstacles[obstacle] = true
+	}
+	for _, p := range r.Players {
+		if !p.Alive {
+			continue
+		}
+		next := step(p.Commander, p.Direction)
+		p.moved = p.Direction
+		switch {
+		case next.X < 0 || next.X >= r.Width || next.Y < 0 || next.Y >= r.Height:
+			r.crash(p, CrashWall)
+		case obstacles[next]:
+			r.crash(p, CrashObstacle)
+		case blocked[next]:
+			r.crash(p, CrashTrail)
+		case targets[next] > 1:
+			r.crash(p, CrashHeadOn)
+		default:
+			p.Commander = next
+		}
+	}
+
+	// Collect alerts and replace them
+	for _, p := range r.Players {
+		if !p.Alive {
+			continue
+		}
+		if i := slices.Index(r.Alerts, p.Commander); i >= 0 {
+			r.Alerts = slices.Delete(r.Alerts, i, i+1)
+			p.Alerts++
+			p.Score += alertPoints
+			r.emit(Event{Type: EventAlertCollected, Seat: p.Seat})
+			r.spawnAlert()
+		}
+	}
+
+	r.checkFinished()
+}
+
+// crash takes a commander out of the race
+func (r *Race) crash(p *Player, reason string) {
+	p.Alive = false
+	p.Crash = reason
+	p.CrashTick = r.Tick
+	r.emit(Event{Type: EventCrash, Seat: p.Seat, Crash: reason})
+}
+
+// checkFinished ends the race when someone reaches the target, at most one
+// commander is left in a multiplayer race, or time is up
+func (r *Race) checkFinished() {
+	alive := 0
+	winner := false
+	for _, p := range r.Players {
+		if p.Alive {
+			alive++
+		}
+		if p.Alerts >= TargetAlerts {
+			winner = true
+		}
+	}
+
+	lastStanding := alive == 0 || (alive == 1 && len(r.Players) > 1)
+	if !winner && !lastStanding && r.Tick < MaxTicks {
+		return
+	}
+
+	r.Finished = true
+	for _, p := range r.Players {
+		if p.Alive {
+			p.Score += survivalBonus
+		}
+	}
+	r.emit(Event{Type: EventFinished, Seat: -1})
+}
+
+// Results returns the players ranked by score, then alerts, then how long they lasted
+func (r *Race) Results() []Result {
+	players := slices.Clone(r.Players)
+	sort.SliceStable(players, func(i, j int) bool {
+		a, b := players[i], players[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Alerts != b.Alerts {
+			return a.Alerts > b.Alerts
+		}
+		if a.Alive != b.Alive {
+			return a.Alive
+		}
+		return a.CrashTick > b.CrashTick
+	})
+
+	results := make([]Result, len(players))
+	for i, p := range players {
+		results[i] = Result{
+			Rank:   i + 1,
+			Seat:   p.Seat,
+			Name:   p.Name,
+			Score:  p.Score,
+			Alerts: p.Alerts,
+			Alive:  p.Alive,
+			Crash:  p.Crash,
+		}
+	}
+	return results
+}
+
+// Frame captures the race's state. The frame shares no memory with the race.
+func (r *Race) Frame() Frame {
+	f := Frame{
+		Tick:         r.Tick,
+		Width:        r.Width,
+		Height:       r.Height,
+		Players:      make([]Player, len(r.Players)),
+		Alerts:       slices.Clone(r.Alerts),
+		Obstacles:    slices.Clone(r.Obstacles),
+		TargetAlerts: TargetAlerts,
+		TicksLeft:    max(0, MaxTicks-r.Tick),
+		Finished:     r.Finished,
+	}
+	for i, p := range r.Players {
+		f.Players[i] = *p
+		f.Players[i].Trail = slices.Clone(p.Trail)
+	}
+	return f
+}
+
+// emit queues an event at the current tick
+func (r *Race) emit(e Event) {
+	e.Tick = r.Tick
+	r.events = append(r.events, e)
+}
+
+// TakeEvents returns and clears the events queued since the last call
+func (r *Race) TakeEvents() []Event {
+	events := r.events
+	r.events = nil
+	return events
+}
+
+// step returns the neighboring cell in a direction
+func step(p game.Position, d game.Direction) game.Position {
+	switch d {
+	case game.Up:
+		p.Y--
+	case game.Down:
+		p.Y++
+	case game.Left:
+		p.X--
+	case game.Right:
+		p.X++
+	}
+	return p
+}
+
+// opposite returns the reverse of a direction
+func opposite(d game.Direction) game.Direction {
+	switch d {
+	case game.Up:
+		return game.Down
+	case game.Down:
+		return game.Up
+	case game.Left:
+		return game.Right
+	default:
+		return game.Left
+	}
+}
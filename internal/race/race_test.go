@@ -0,0 +1,176 @@
+package race
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/NathanNam/incident-commander-game/internal/game"
+)
+
+// testRace returns a 10x10 race with the given players and obstacles, and one
+// alert in a corner out of everyone's way
+func testRace(players []*Player, obstacles ...game.Position) *Race {
+	for seat, p := range players {
+		p.Seat = seat
+		p.Alive = true
+		p.moved = p.Direction
+	}
+	return &Race{
+		Width:     10,
+		Height:    10,
+		Players:   players,
+		Alerts:    []game.Position{{X: 9, Y: 9}},
+		Obstacles: obstacles,
+		rng:       rand.New(rand.NewSource(1)),
+	}
+}
+
+func TestUpdateCrashes(t *testing.T) {
+	at := func(x, y int) game.Position { return game.Position{X: x, Y: y} }
+
+	tests := []struct {
+		name      string
+		players   []*Player
+		obstacles []game.Position
+		want      []string // Crash reason per seat; "" if still racing
+	}{
+		{
+			name: "clear moves",
+			players: []*Player{
+				{Commander: at(2, 2), Direction: game.Right},
+				{Commander: at(7, 7), Direction: game.Left},
+			},
+			want: []string{"", ""},
+		},
+		{
+			name: "head-on into the same cell",
+			players: []*Player{
+				{Commander: at(2, 5), Direction: game.Right},
+				{Commander: at(4, 5), Direction: game.Left},
+			},
+			want: []string{CrashHeadOn, CrashHeadOn},
+		},
+		{
+			name: "head-on from the side",
+			players: []*Player{
+				{Commander: at(2, 5), Direction: game.Right},
+				{Commander: at(3, 4), Direction: game.Down},
+				{Commander: at(8, 8), Direction: game.Up},
+			},
+			want: []string{CrashHeadOn, CrashHeadOn, ""},
+		},
+		{
+			name: "swapping cells",
+			players: []*Player{
+				{Commander: at(2, 5), Direction: game.Right},
+				{Commander: at(3, 5), Direction: game.Left},
+			},
+			want: []string{CrashTrail, CrashTrail},
+		},
+		{
+			name: "into another commander's trail",
+			players: []*Player{
+				{Commander: at(2, 5), Direction: game.Right},
+				{Commander: at(3, 7), Direction: game.Down, Trail: []game.Position{at(3, 5), at(3, 6)}},
+			},
+			want: []string{CrashTrail, ""},
+		},
+		{
+			name: "into the cell another commander just left",
+			players: []*Player{
+				{Commander: at(2, 5), Direction: game.Right},
+				{Commander: at(3, 5), Direction: game.Down},
+			},
+			want: []string{CrashTrail, ""},
+		},
+		{
+			name: "into its own trail",
+			players: []*Player{
+				{Commander: at(2, 5), Direction: game.Up, Trail: []game.Position{at(2, 4), at(3, 4), at(3, 5)}},
+				{Commander: at(7, 7), Direction: game.Left},
+			},
+			want: []string{CrashTrail, ""},
+		},
+		{
+			name: "wall",
+			players: []*Player{
+				{Commander: at(0, 5), Direction: game.Left},
+				{Commander: at(7, 7), Direction: game.Left},
+			},
+			want: []string{CrashWall, ""},
+		},
+		{
+			name: "obstacle",
+			players: []*Player{
+				{Commander: at(2, 5), Direction: game.Right},
+				{Commander: at(7, 7), Direction: game.Left},
+			},
+			obstacles: []game.Position{at(3, 5)},
+			want:      []string{CrashObstacle, ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRace(tt.players, tt.obstacles...)
+			r.Update()
+
+			for seat, want := range tt.want {
+				p := r.Players[seat]
+				if p.Crash != want || p.Alive != (want == "") {
+					t.Errorf("seat %d: crash %q, alive %v; want crash %q", seat, p.Crash, p.Alive, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckFinished(t *testing.T) {
+	tests := []struct {
+		name         string
+		alive        []bool
+		alerts       []int
+		tick         int
+		wantFinished bool
+	}{
+		{"everyone racing", []bool{true, true, true}, []int{3, 5, 0}, 100, false},
+		{"two of three left", []bool{true, false, true}, []int{3, 5, 0}, 100, false},
+		{"last one standing", []bool{false, true, false}, []int{3, 5, 0}, 100, true},
+		{"everyone crashed", []bool{false, false}, []int{3, 5}, 100, true},
+		{"solo race still running", []bool{true}, []int{3}, 100, false},
+		{"target reached", []bool{true, true}, []int{TargetAlerts, 5}, 100, true},
+		{"target reached by a crashed commander", []bool{false, true, true}, []int{TargetAlerts, 5, 0}, 100, true},
+		{"time up", []bool{true, true}, []int{3, 5}, MaxTicks, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var players []*Player
+			for range tt.alive {
+				players = append(players, &Player{})
+			}
+			r := testRace(players)
+			r.Tick = tt.tick
+			for seat, p := range r.Players {
+				p.Alive = tt.alive[seat]
+				p.Alerts = tt.alerts[seat]
+				p.Score = p.Alerts * alertPoints
+			}
+
+			r.checkFinished()
+
+			if r.Finished != tt.wantFinished {
+				t.Fatalf("Finished = %v, want %v", r.Finished, tt.wantFinished)
+			}
+			for seat, p := range r.Players {
+				want := p.Alerts * alertPoints
+				if tt.wantFinished && p.Alive {
+					want += survivalBonus
+				}
+				if p.Score != want {
+					t.Errorf("seat %d: score %d, want %d", seat, p.Score, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package renderer
+
+import (
+	"fmt"
+	"strconv"
+	"syscall/js"
+
+	"github.com/NathanNam/incident-commander-game/internal/race"
+)
+
+// raceColors tells the commanders apart by seat; the first matches the single-player trail
+var raceColors = []string{"#6fcf3f", "#4da3ff", "#b57bff", "#f5d547"}
+
+// crashLabels describe why a commander is out of the race
+var crashLabels = map[string]string{
+	race.CrashWall:     "hit the wall",
+	race.CrashObstacle: "hit an obstacle",
+	race.CrashTrail:    "hit a trail",
+	race.CrashHeadOn:   "head-on collision",
+	race.CrashForfeit:  "forfeited",
+}
+
+// RaceColor returns the color of the commander in a seat, for the lobby and results
+func RaceColor(seat int) string {
+	return raceColors[seat%len(raceColors)]
+}
+
+// RenderRace renders a multiplayer race from the point of view of the player in seat you
+func (r *Renderer) RenderRace(f *race.Frame, you int) {
+	r.fitGrid(f.Width, f.Height)
+
+	r.clearCanvas()
+	r.drawGridLines(f.Width, f.Height)
+
+	r.ctx.Set("fillStyle", "#444444")
+	for _, obstacle := range f.Obstacles {
+		r.ctx.Call("fillRect", obstacle.X*r.cellSize, obstacle.Y*r.cellSize, r.cellSize, r.cellSize)
+	}
+
+	// Trails of crashed commanders stay on the board, faded
+	for _, p := range f.Players {
+		if !p.Alive {
+			r.ctx.Set("globalAlpha", 0.4)
+		}
+		r.ctx.Set("fillStyle", RaceColor(p.Seat))
+		for _, segment := range p.Trail {
+			r.ctx.Call("fillRect", segment.X*r.cellSize+2, segment.Y*r.cellSize+2, r.cellSize-4, r.cellSize-4)
+		}
+		r.ctx.Set("globalAlpha", 1)
+	}
+
+	r.ctx.Set("font", strconv.Itoa(r.cellSize/2)+"px Arial")
+	r.ctx.Set("textAlign", "center")
+	r.ctx.Set("textBaseline", "middle")
+	for _, alert := range f.Alerts {
+		centerX := alert.X*r.cellSize + r.cellSize/2
+		centerY := alert.Y*r.cellSize + r.cellSize/2
+		r.ctx.Set("fillStyle", "#ff3838")
+		r.ctx.Call("beginPath")
+		r.ctx.Call("arc", centerX, centerY, r.cellSize/2-3, 0, 2*3.14159)
+		r.ctx.Call("fill")
+		r.ctx.Set("fillStyle", "#ffffff")
+		r.ctx.Call("fillText", "!", centerX, centerY)
+	}
+
+	for _, p := range f.Players {
+		r.drawRacer(p, p.Seat == you)
+	}
+
+	r.drawRaceUI(f, you)
+}
+
+// drawRacer draws a commander in its seat's color with its name above it.
+// The local player gets the mascot.
+func (r *Renderer) drawRacer(p race.Player, local bool) {
+	x := p.Commander.X * r.cellSize
+	y := p.Commander.Y * r.cellSize
+	centerX := x + r.cellSize/2
+	centerY := y + r.cellSize/2
+
+	if !p.Alive {
+		r.ctx.Set("globalAlpha", 0.5)
+	}
+	r.ctx.Set("fillStyle", RaceColor(p.Seat))
+	r.ctx.Call("beginPath")
+	r.ctx.Call("arc", centerX, centerY, r.cellSize/2-1, 0, 2*3.14159)
+	r.ctx.Call("fill")
+	if local && r.mascotLoaded() {
+		r.ctx.Call("drawImage", r.mascotImg, x+2, y+2, r.cellSize-4, r.cellSize-4)
+	}
+
+	label := p.Name
+	if !p.Alive {
+		label = "💥 " + label
+	}
+	r.ctx.Set("font", "bold "+strconv.Itoa(max(8, r.cellSize/3))+"px Arial")
+	r.ctx.Set("textAlign", "center")
+	r.ctx.Set("textBaseline", "bottom")
+	r.ctx.Call("fillText", label, centerX, y)
+	r.ctx.Set("globalAlpha", 1)
+}
+
+// drawRaceUI shows the local player's race in the sidebar
+func (r *Renderer) drawRaceUI(f *race.Frame, you int) {
+	document := js.Global().Get("document")
+	if you < 0 || you >= len(f.Players) {
+		return
+	}
+	p := f.Players[you]
+
+	if el := document.Call("getElementById", "score"); !el.IsNull() {
+		el.Set("textContent", "Score: "+strconv.Itoa(p.Score))
+	}
+	if el := document.Call("getElementById", "level"); !el.IsNull() {
+		seconds := f.TicksLeft / race.TickRate
+		el.Set("textContent", fmt.Sprintf("Race: ⏱️ %d:%02d", seconds/60, seconds%60))
+	}
+	if el := document.Call("getElementById", "alerts"); !el.IsNull() {
+		el.Set("textContent", "Alerts: "+strconv.Itoa(p.Alerts)+"/"+strconv.Itoa(f.TargetAlerts))
+	}
+	if el := document.Call("getElementById", "game-state"); !el.IsNull() {
+		switch {
+		case f.Finished:
+			el.Set("textContent", "🏁 Race over")
+			el.Set("className", "level-complete")
+		case !p.Alive:
+			el.Set("textContent", "💥 Out: "+crashLabels[p.Crash])
+			el.Set("className", "game-over")
+		default:
+			el.Set("textContent", "🏎️ Racing")
+			el.Set("className", "playing")
+		}
+	}
+}
@@ -3,6 +3,7 @@ package renderer
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"syscall/js"
 	"time"
 
@@ -16,6 +17,12 @@ type Renderer struct {
 	cellSize  int
 	mascotImg js.Value
 
+	// Scenario currently shown in the sidebar, to avoid rewriting static DOM
+	shownScenario *game.Scenario
+
+	// Achievement toast is hidden again after this time
+	toastUntil time.Time
+
 	// Instrumentation fields
 	renderCount       int64
 	lastRenderTime    time.Time
@@ -65,6 +72,11 @@ func New(canvas js.Value) *Renderer {
 
 // updateCellSize calculates the cell size based on current canvas dimensions and grid size
 func (r *Renderer) updateCellSize(g *game.Game) {
+	r.fitGrid(g.GetWidth(), g.GetHeight())
+}
+
+// fitGrid sizes cells so a grid of the given dimensions fits the canvas
+func (r *Renderer) fitGrid(gridWidth, gridHeight int) {
 	canvasWidth := r.canvas.Get("width").Int()
 	canvasHeight := r.canvas.Get("height").Int()
 
@@ -75,8 +87,6 @@ func (r *Renderer) updateCellSize(g *game.Game) {
 	}
 
 	// Calculate cell size based on grid dimensions
-	gridWidth := g.GetWidth()
-	gridHeight := g.GetHeight()
 	gridSize := gridWidth
 	if gridHeight > gridWidth {
 		gridSize = gridHeight
@@ -94,10 +104,15 @@ func (r *Renderer) Render(g *game.Game) {
 
 	r.clearCanvas()
 	r.drawGrid(g)
+	r.drawSlowZones(g)
 	r.drawObstacles(g)
+	r.drawGates(g)
+	r.drawTeleporters(g)
 	r.drawTrail(g)
 	r.drawAlerts(g)
+	r.drawFog(g)
 	r.drawCommander(g)
+	r.drawRewind(g)
 	r.drawUI(g)
 
 	// Track rendering metrics
@@ -117,6 +132,59 @@ func (r *Renderer) Render(g *game.Game) {
 	}
 }
 
+// RenderEditor renders a level layout for the level editor, with alert spawn zones,
+// the spawn direction, and a half-placed teleporter pad
+func (r *Renderer) RenderEditor(g *game.Game, pendingPad *game.Position) {
+	r.updateCellSize(g)
+
+	r.clearCanvas()
+	r.drawGrid(g)
+	r.drawAlertZones(g)
+	r.drawSlowZones(g)
+	r.drawObstacles(g)
+	r.drawGates(g)
+	r.drawTeleporters(g)
+	r.drawCommander(g)
+	r.drawSpawnDirection(g)
+
+	if pendingPad != nil {
+		r.ctx.Set("strokeStyle", "#b388ff")
+		r.ctx.Set("lineWidth", 2)
+		r.ctx.Call("setLineDash", []interface{}{4, 3})
+		r.ctx.Call("strokeRect", pendingPad.X*r.cellSize+2, pendingPad.Y*r.cellSize+2, r.cellSize-4, r.cellSize-4)
+		r.ctx.Call("setLineDash", []interface{}{})
+	}
+}
+
+// drawAlertZones shades the cells alerts may spawn in
+func (r *Renderer) drawAlertZones(g *game.Game) {
+	r.ctx.Set("fillStyle", "rgba(255, 56, 56, 0.2)")
+	for _, zone := range g.GetAlertZones() {
+		r.ctx.Call("fillRect", zone.X*r.cellSize+1, zone.Y*r.cellSize+1, r.cellSize-2, r.cellSize-2)
+	}
+}
+
+// drawSpawnDirection draws an arrow next to the commander showing its starting direction
+func (r *Renderer) drawSpawnDirection(g *game.Game) {
+	arrows := map[game.Direction]string{
+		game.Up: "▲", game.Down: "▼", game.Left: "◀", game.Right: "▶",
+	}
+	offsets := map[game.Direction][2]int{
+		game.Up: {0, -1}, game.Down: {0, 1}, game.Left: {-1, 0}, game.Right: {1, 0},
+	}
+
+	commander := g.GetCommander()
+	offset := offsets[g.GetDirection()]
+	centerX := commander.X*r.cellSize + r.cellSize/2 + offset[0]*r.cellSize*2/3
+	centerY := commander.Y*r.cellSize + r.cellSize/2 + offset[1]*r.cellSize*2/3
+
+	r.ctx.Set("fillStyle", "#9dd9f3")
+	r.ctx.Set("font", strconv.Itoa(r.cellSize/2)+"px Arial")
+	r.ctx.Set("textAlign", "center")
+	r.ctx.Set("textBaseline", "middle")
+	r.ctx.Call("fillText", arrows[g.GetDirection()], centerX, centerY)
+}
+
 // clearCanvas clears the entire canvas
 func (r *Renderer) clearCanvas() {
 	// Set background color
@@ -126,12 +194,14 @@ func (r *Renderer) clearCanvas() {
 
 // drawGrid draws the game grid
 func (r *Renderer) drawGrid(g *game.Game) {
+	r.drawGridLines(g.GetWidth(), g.GetHeight())
+}
+
+// drawGridLines draws the lines of a grid of the given dimensions
+func (r *Renderer) drawGridLines(width, height int) {
 	r.ctx.Set("strokeStyle", "#2a3f5f")
 	r.ctx.Set("lineWidth", 1)
 
-	width := g.GetWidth()
-	height := g.GetHeight()
-
 	// Draw vertical lines
 	for x := 0; x <= width; x++ {
 		r.ctx.Call("beginPath")
@@ -149,6 +219,19 @@ func (r *Renderer) drawGrid(g *game.Game) {
 	}
 }
 
+// mascotLoaded reports whether the mascot image is ready to draw
+func (r *Renderer) mascotLoaded() bool {
+	if r.mascotImg.IsNull() {
+		return false
+	}
+
+	// Image is considered loaded if complete=true and naturalWidth>0
+	complete := r.mascotImg.Get("complete")
+	naturalWidth := r.mascotImg.Get("naturalWidth")
+	return !complete.IsUndefined() && complete.Bool() &&
+		!naturalWidth.IsUndefined() && naturalWidth.Int() > 0
+}
+
 // drawCommander draws the incident commander using the mascot image
 func (r *Renderer) drawCommander(g *game.Game) {
 	commander := g.GetCommander()
@@ -157,18 +240,7 @@ func (r *Renderer) drawCommander(g *game.Game) {
 
 	// Check if image is loaded and valid
 	r.imageLoadChecks++
-	imageLoaded := false
-	if !r.mascotImg.IsNull() {
-		// Check if image is actually loaded (complete property)
-		complete := r.mascotImg.Get("complete")
-		naturalWidth := r.mascotImg.Get("naturalWidth")
-
-		// Image is considered loaded if complete=true and naturalWidth>0
-		if !complete.IsUndefined() && complete.Bool() &&
-			!naturalWidth.IsUndefined() && naturalWidth.Int() > 0 {
-			imageLoaded = true
-		}
-	}
+	imageLoaded := r.mascotLoaded()
 
 	if imageLoaded {
 		// Draw the mascot image
@@ -219,6 +291,9 @@ func (r *Renderer) drawTrail(g *game.Game) {
 
 	trail := g.GetTrail()
 	for _, segment := range trail {
+		if !g.IsVisible(segment) {
+			continue
+		}
 		x := segment.X * r.cellSize
 		y := segment.Y * r.cellSize
 		r.ctx.Call("fillRect", x+2, y+2, r.cellSize-4, r.cellSize-4)
@@ -230,13 +305,19 @@ func (r *Renderer) drawAlerts(g *game.Game) {
 	alerts := g.GetAlerts()
 
 	for _, alert := range alerts {
+		if !g.IsVisible(alert) {
+			continue
+		}
 		x := alert.X * r.cellSize
 		y := alert.Y * r.cellSize
 		centerX := x + r.cellSize/2
 		centerY := y + r.cellSize/2
 
-		// Draw red circle
+		// Draw red circle (orange for symptoms whose root cause is still open)
 		r.ctx.Set("fillStyle", "#ff3838")
+		if g.IsSymptomAlert(alert) {
+			r.ctx.Set("fillStyle", "#ffa502")
+		}
 		r.ctx.Call("beginPath")
 		r.ctx.Call("arc", centerX, centerY, r.cellSize/2-3, 0, 2*3.14159)
 		r.ctx.Call("fill")
@@ -247,21 +328,232 @@ func (r *Renderer) drawAlerts(g *game.Game) {
 		r.ctx.Set("textAlign", "center")
 		r.ctx.Set("textBaseline", "middle")
 		r.ctx.Call("fillText", "!", centerX, centerY)
+
+		// Label the owning service in scenario mode
+		if service := g.AlertService(alert); service != "" {
+			r.ctx.Set("font", "bold "+strconv.Itoa(max(8, r.cellSize/3))+"px Arial")
+			r.ctx.Set("textBaseline", "bottom")
+			r.ctx.Call("fillText", service, centerX, y)
+		}
 	}
 }
 
+// AnnounceAchievement shows a newly unlocked achievement in the HUD for a few seconds
+func (r *Renderer) AnnounceAchievement(icon, name, description string) {
+	document := js.Global().Get("document")
+	toastEl := document.Call("getElementById", "achievement-toast")
+	if toastEl.IsNull() {
+		return
+	}
+
+	toastEl.Set("textContent", icon+" Achievement unlocked: "+name+" — "+description)
+	toastEl.Get("classList").Call("add", "visible")
+	r.toastUntil = time.Now().Add(4 * time.Second)
+
+	r.logRenderMetric("achievement_announced", name, description)
+}
+
+// drawScenarioPanel fills in the sidebar with the scenario description and dependency graph
+func (r *Renderer) drawScenarioPanel(document js.Value, g *game.Game) {
+	scenario := g.GetScenario()
+	if scenario == r.shownScenario {
+		return
+	}
+	r.shownScenario = scenario
+
+	panel := document.Call("getElementById", "scenario-panel")
+	if panel.IsNull() {
+		return
+	}
+	if scenario == nil {
+		panel.Get("style").Set("display", "none")
+		return
+	}
+
+	edges := make([]string, 0, len(scenario.Services))
+	for _, svc := range scenario.Services {
+		for _, dep := range svc.DependsOn {
+			edges = append(edges, svc.Name+" → "+dep)
+		}
+	}
+
+	document.Call("getElementById", "scenario-name").Set("textContent", "📟 Scenario: "+scenario.Name)
+	document.Call("getElementById", "scenario-description").Set("textContent", scenario.Description)
+	document.Call("getElementById", "scenario-graph").Set("textContent", strings.Join(edges, "\n"))
+	panel.Get("style").Set("display", "block")
+}
+
 // drawObstacles draws the level obstacles
 func (r *Renderer) drawObstacles(g *game.Game) {
 	r.ctx.Set("fillStyle", "#444444")
 
 	obstacles := g.GetObstacles()
 	for _, obstacle := range obstacles {
+		if !g.IsVisible(obstacle) {
+			continue
+		}
 		x := obstacle.X * r.cellSize
 		y := obstacle.Y * r.cellSize
 		r.ctx.Call("fillRect", x, y, r.cellSize, r.cellSize)
 	}
 }
 
+// drawRewind draws the rollback animation: a ghost of the commander retracing the
+// undone path over a tinted, scanlined board
+func (r *Renderer) drawRewind(g *game.Game) {
+	if g.GetState() != game.Rewinding {
+		return
+	}
+
+	progress := g.RewindProgress()
+	width := r.canvas.Get("width").Int()
+	height := r.canvas.Get("height").Int()
+
+	// Tint fades out as the animation completes
+	r.ctx.Set("fillStyle", fmt.Sprintf("rgba(157, 217, 243, %.2f)", 0.25*(1-progress)))
+	r.ctx.Call("fillRect", 0, 0, width, height)
+
+	// Scanlines scrolling upward like a rewinding tape
+	r.ctx.Set("fillStyle", "rgba(255, 255, 255, 0.08)")
+	offset := int(progress*float64(r.cellSize*4)) % 8
+	for y := height - offset; y > 0; y -= 8 {
+		r.ctx.Call("fillRect", 0, y, width, 2)
+	}
+
+	// Ghost commander moving back along the undone path
+	path := g.GetRewindPath()
+	if len(path) > 0 {
+		step := min(len(path)-1, int(progress*float64(len(path))))
+		pos := path[step]
+		r.ctx.Set("fillStyle", "rgba(157, 217, 243, 0.6)")
+		r.ctx.Call("beginPath")
+		r.ctx.Call("arc", pos.X*r.cellSize+r.cellSize/2, pos.Y*r.cellSize+r.cellSize/2, r.cellSize/2-2, 0, 2*3.14159)
+		r.ctx.Call("fill")
+	}
+
+	r.ctx.Set("fillStyle", "#ffffff")
+	r.ctx.Set("font", "bold "+strconv.Itoa(r.cellSize)+"px Arial")
+	r.ctx.Set("textAlign", "center")
+	r.ctx.Set("textBaseline", "middle")
+	r.ctx.Call("fillText", "⏪ ROLLBACK", width/2, height/2)
+}
+
+// drawFog darkens cells outside the commander's visibility and draws pager pings
+// toward hidden alerts
+func (r *Renderer) drawFog(g *game.Game) {
+	if !g.FogEnabled() {
+		return
+	}
+
+	r.ctx.Set("fillStyle", "rgba(10, 12, 24, 0.85)")
+	for y := 0; y < g.GetHeight(); y++ {
+		for x := 0; x < g.GetWidth(); x++ {
+			if !g.IsVisible(game.Position{X: x, Y: y}) {
+				r.ctx.Call("fillRect", x*r.cellSize, y*r.cellSize, r.cellSize, r.cellSize)
+			}
+		}
+	}
+
+	// Faint pager pings at the board edge pointing toward hidden alerts
+	for _, ping := range g.PagerPings() {
+		centerX := float64(ping.Edge.X*r.cellSize + r.cellSize/2)
+		centerY := float64(ping.Edge.Y*r.cellSize + r.cellSize/2)
+		size := float64(r.cellSize) / 2.5
+
+		r.ctx.Set("fillStyle", "rgba(255, 56, 56, 0.35)")
+		r.ctx.Call("beginPath")
+		r.ctx.Call("arc", centerX, centerY, size, 0, 2*3.14159)
+		r.ctx.Call("fill")
+
+		// Arrow tip along the ping direction, base perpendicular to it
+		r.ctx.Set("fillStyle", "rgba(255, 255, 255, 0.6)")
+		r.ctx.Call("beginPath")
+		r.ctx.Call("moveTo", centerX+ping.DX*size, centerY+ping.DY*size)
+		r.ctx.Call("lineTo", centerX-ping.DY*size/2, centerY+ping.DX*size/2)
+		r.ctx.Call("lineTo", centerX+ping.DY*size/2, centerY-ping.DX*size/2)
+		r.ctx.Call("closePath")
+		r.ctx.Call("fill")
+	}
+}
+
+// drawSlowZones draws slow zones as hatched amber cells
+func (r *Renderer) drawSlowZones(g *game.Game) {
+	for _, zone := range g.GetSlowZones() {
+		if !g.IsVisible(zone) {
+			continue
+		}
+		x := zone.X * r.cellSize
+		y := zone.Y * r.cellSize
+
+		r.ctx.Set("fillStyle", "rgba(255, 215, 0, 0.18)")
+		r.ctx.Call("fillRect", x, y, r.cellSize, r.cellSize)
+
+		// Diagonal hatching
+		r.ctx.Set("strokeStyle", "rgba(255, 215, 0, 0.45)")
+		r.ctx.Set("lineWidth", 1)
+		r.ctx.Call("beginPath")
+		r.ctx.Call("moveTo", x, y+r.cellSize/2)
+		r.ctx.Call("lineTo", x+r.cellSize/2, y)
+		r.ctx.Call("moveTo", x, y+r.cellSize)
+		r.ctx.Call("lineTo", x+r.cellSize, y)
+		r.ctx.Call("moveTo", x+r.cellSize/2, y+r.cellSize)
+		r.ctx.Call("lineTo", x+r.cellSize, y+r.cellSize/2)
+		r.ctx.Call("stroke")
+	}
+}
+
+// drawGates draws one-way change freeze gates with an arrow showing the allowed direction
+func (r *Renderer) drawGates(g *game.Game) {
+	arrows := map[game.Direction]string{
+		game.Up: "▲", game.Down: "▼", game.Left: "◀", game.Right: "▶",
+	}
+
+	for _, gate := range g.GetGates() {
+		if !g.IsVisible(gate.Position) {
+			continue
+		}
+		x := gate.X * r.cellSize
+		y := gate.Y * r.cellSize
+
+		r.ctx.Set("fillStyle", "#3a2a5f")
+		r.ctx.Call("fillRect", x+1, y+1, r.cellSize-2, r.cellSize-2)
+		r.ctx.Set("strokeStyle", "#ff9f43")
+		r.ctx.Set("lineWidth", 2)
+		r.ctx.Call("strokeRect", x+2, y+2, r.cellSize-4, r.cellSize-4)
+
+		r.ctx.Set("fillStyle", "#ff9f43")
+		r.ctx.Set("font", strconv.Itoa(r.cellSize/2)+"px Arial")
+		r.ctx.Set("textAlign", "center")
+		r.ctx.Set("textBaseline", "middle")
+		r.ctx.Call("fillText", arrows[gate.Direction], x+r.cellSize/2, y+r.cellSize/2)
+	}
+}
+
+// drawTeleporters draws teleporter pads, with each linked pair sharing a color
+func (r *Renderer) drawTeleporters(g *game.Game) {
+	colors := []string{"#b388ff", "#18dcff", "#7bed9f"}
+
+	for i, tp := range g.GetTeleporters() {
+		color := colors[i%len(colors)]
+		for _, pad := range []game.Position{tp.A, tp.B} {
+			if !g.IsVisible(pad) {
+				continue
+			}
+			centerX := pad.X*r.cellSize + r.cellSize/2
+			centerY := pad.Y*r.cellSize + r.cellSize/2
+
+			r.ctx.Set("strokeStyle", color)
+			r.ctx.Set("lineWidth", 2)
+			r.ctx.Call("beginPath")
+			r.ctx.Call("arc", centerX, centerY, r.cellSize/2-2, 0, 2*3.14159)
+			r.ctx.Call("stroke")
+			r.ctx.Call("beginPath")
+			r.ctx.Call("arc", centerX, centerY, r.cellSize/4, 0, 2*3.14159)
+			r.ctx.Call("stroke")
+		}
+	}
+}
+
 // drawUI draws the user interface elements
 func (r *Renderer) drawUI(g *game.Game) {
 	// Update DOM elements instead of drawing on canvas
@@ -301,19 +593,47 @@ func (r *Renderer) drawUI(g *game.Game) {
 			stateEl.Set("textContent", "⏸️ Paused")
 			stateEl.Set("className", "paused")
 		case 2: // GameOver
-			stateEl.Set("textContent", "💀 Game Over")
+			message := "💀 Game Over"
+			if g.CanRollback() {
+				message += " (B: roll back, " + strconv.Itoa(g.GetRollbacksLeft()) + " left)"
+			}
+			stateEl.Set("textContent", message)
 			stateEl.Set("className", "game-over")
 		case 3: // LevelComplete
 			message := "🎉 Level " + strconv.Itoa(g.GetLevel()) + " Complete!"
-			if g.GetLevel() < 10 {
+			if g.IsCustomLevel() {
+				message = "🎉 Custom Level Complete!"
+			} else if g.GetLevel() < 10 {
 				message += " → Level " + strconv.Itoa(g.GetLevel()+1)
 			}
 			stateEl.Set("textContent", message)
 			stateEl.Set("className", "level-complete")
+		case 4: // Rewinding
+			stateEl.Set("textContent", "⏪ Rolling back...")
+			stateEl.Set("className", "paused")
 		}
 		uiUpdates++
 	}
 
+	// Update rollback button with the remaining uses
+	rollbackEl := document.Call("getElementById", "btn-rollback")
+	if !rollbackEl.IsNull() {
+		rollbackEl.Set("textContent", "⏪ "+strconv.Itoa(g.GetRollbacksLeft()))
+		uiUpdates++
+	}
+
+	// Hide the achievement toast once it has been shown long enough
+	if !r.toastUntil.IsZero() && time.Now().After(r.toastUntil) {
+		toastEl := document.Call("getElementById", "achievement-toast")
+		if !toastEl.IsNull() {
+			toastEl.Get("classList").Call("remove", "visible")
+		}
+		r.toastUntil = time.Time{}
+	}
+
+	// Update scenario details
+	r.drawScenarioPanel(document, g)
+
 	// Log UI update metrics every 500 renders
 	if r.renderCount%500 == 0 {
 		r.logRenderMetric("ui_updates", uiUpdates,
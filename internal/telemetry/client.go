@@ -4,12 +4,25 @@
 package telemetry
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall/js"
 	"time"
 )
 
+// Buffered telemetry is sent as one batch when this many items are waiting,
+// or at the flush interval, whichever comes first
+const (
+	batchMaxItems      = 50
+	batchFlushInterval = 5 * time.Second
+)
+
 // ClientTelemetry handles client-side telemetry collection and transmission
 type ClientTelemetry struct {
 	sessionID     string
@@ -17,6 +30,18 @@ type ClientTelemetry struct {
 	serverURL     string
 	events        []ClientEvent
 	metrics       map[string]interface{}
+
+	traceID string      // One trace per play session
+	session *ClientSpan // Root of the trace, ended when the page goes away
+
+	mu     sync.Mutex
+	level  *ClientSpan     // Current level's span; nil between levels
+	active *ClientSpan     // Most recently started span that hasn't ended
+	buffer []BatchItem     // Waiting for the next batch
+	outbox []*pendingBatch // Batches not yet delivered
+	stats  deliveryStats
+
+	delivering bool // deliver is sending batches
 }
 
 // NewClientTelemetry creates a new client telemetry instance
@@ -24,13 +49,20 @@ func NewClientTelemetry(serverURL string) *ClientTelemetry {
 	sessionID := generateSessionID()
 	correlationID := generateCorrelationID()
 
-	return &ClientTelemetry{
+	ct := &ClientTelemetry{
 		sessionID:     sessionID,
 		correlationID: correlationID,
 		serverURL:     serverURL,
 		events:        make([]ClientEvent, 0),
 		metrics:       make(map[string]interface{}),
+		traceID:       generateTraceID(),
 	}
+	ct.session = ct.startSpan("game_session", nil)
+	ct.loadOutbox()
+	ct.watchPageLifecycle()
+	ct.deliver()
+	go ct.flushLoop()
+	return ct
 }
 
 // generateSessionID creates a unique session identifier
@@ -79,16 +111,23 @@ func (ct *ClientTelemetry) LogEvent(eventType string, level, score int, data str
 		fmt.Sprintf("[CLIENT_TELEMETRY] %s - Session: %s, Level: %d, Score: %d",
 			eventType, ct.sessionID, level, score))
 
-	// Send event immediately for real-time telemetry
-	ct.sendEvent(event)
+	ct.enqueue(BatchItem{Kind: BatchEvent, Event: &event})
 }
 
-// RecordMetric records a client-side metric
+// RecordMetric records a client-side metric. metricType is "counter" (value
+// is an increment), "updowncounter", "gauge" or "histogram".
 func (ct *ClientTelemetry) RecordMetric(name string, value float64, metricType string, labels map[string]interface{}) {
+	ct.RecordMetricWithUnit(name, value, metricType, "", labels)
+}
+
+// RecordMetricWithUnit records a client-side metric in a UCUM unit such as
+// "ms" or "{frame}"
+func (ct *ClientTelemetry) RecordMetricWithUnit(name string, value float64, metricType, unit string, labels map[string]interface{}) {
 	metric := ClientMetric{
 		Name:      name,
 		Value:     value,
 		Type:      metricType,
+		Unit:      unit,
 		Timestamp: time.Now(),
 		SessionID: ct.sessionID,
 		Labels:    labels,
@@ -97,65 +136,210 @@ func (ct *ClientTelemetry) RecordMetric(name string, value float64, metricType s
 	// Store locally
 	ct.metrics[name] = value
 
-	// Send metric
-	ct.sendMetric(metric)
+	ct.enqueue(BatchItem{Kind: BatchMetric, Metric: &metric})
 }
 
-// StartSpan creates a new trace span (simplified implementation)
+// StartSpan starts a span under the current level span, or under the session
+// span between levels
 func (ct *ClientTelemetry) StartSpan(operationName string) *ClientSpan {
-	return &ClientSpan{
-		TraceID:       generateTraceID(),
+	return ct.CurrentSpan().StartChild(operationName)
+}
+
+// startSpan starts a span under parent, or a root span if parent is nil, and
+// makes it the active span
+func (ct *ClientTelemetry) startSpan(operationName string, parent *ClientSpan) *ClientSpan {
+	span := &ClientSpan{
+		TraceID:       ct.traceID,
 		SpanID:        generateSpanID(),
 		OperationName: operationName,
 		StartTime:     time.Now(),
 		SessionID:     ct.sessionID,
 		telemetry:     ct,
+		parent:        parent,
+	}
+	if parent != nil {
+		span.ParentSpanID = parent.SpanID
+	}
+
+	ct.mu.Lock()
+	ct.active = span
+	ct.mu.Unlock()
+	return span
+}
+
+// CurrentSpan returns the span new work belongs to: the current level span,
+// or the session span between levels
+func (ct *ClientTelemetry) CurrentSpan() *ClientSpan {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if ct.level != nil {
+		return ct.level
+	}
+	return ct.session
+}
+
+// LevelSpan returns the current level's span, or nil between levels
+func (ct *ClientTelemetry) LevelSpan() *ClientSpan {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return ct.level
+}
+
+// StartLevelSpan ends the current level span, if any, and starts one for
+// level under the session span
+func (ct *ClientTelemetry) StartLevelSpan(level int) *ClientSpan {
+	ct.EndLevelSpan()
+
+	span := ct.session.StartChild("level")
+	span.SetAttribute("level", level)
+
+	ct.mu.Lock()
+	ct.level = span
+	ct.mu.Unlock()
+	return span
+}
+
+// EndLevelSpan ends the current level span, if any
+func (ct *ClientTelemetry) EndLevelSpan() {
+	ct.mu.Lock()
+	span := ct.level
+	ct.level = nil
+	ct.mu.Unlock()
+
+	if span != nil {
+		span.End()
 	}
 }
 
-// sendEvent sends an event to the server telemetry endpoint
-func (ct *ClientTelemetry) sendEvent(event ClientEvent) {
-	go ct.sendToServer("/api/telemetry/events", event)
+// RecordError marks the current span as failed
+func (ct *ClientTelemetry) RecordError(description string) {
+	ct.CurrentSpan().RecordError(description)
+}
+
+// endSession ends the level and session spans
+func (ct *ClientTelemetry) endSession() {
+	ct.EndLevelSpan()
+	ct.session.End()
+}
+
+// TraceParent returns a W3C traceparent header value that makes the server's
+// request span a child of the active client span, or of the session when no
+// span is active
+func (ct *ClientTelemetry) TraceParent() string {
+	ct.mu.Lock()
+	spanID := ct.session.SpanID
+	if ct.active != nil {
+		spanID = ct.active.SpanID
+	}
+	ct.mu.Unlock()
+
+	return "00-" + ct.traceID + "-" + spanID + "-01"
+}
+
+// enqueue buffers an item for the next batch, sending the batch once it's full
+func (ct *ClientTelemetry) enqueue(item BatchItem) {
+	ct.mu.Lock()
+	ct.buffer = append(ct.buffer, item)
+	full := len(ct.buffer) >= batchMaxItems
+	ct.mu.Unlock()
+
+	if full {
+		ct.Flush()
+	}
+}
+
+// Flush moves everything buffered into the outbox, split into batches small
+// enough for the server, and sends whatever is due, including earlier batches
+// waiting to be retried
+func (ct *ClientTelemetry) Flush() {
+	ct.mu.Lock()
+	if len(ct.buffer) > 0 {
+		ct.queueBatches(ct.buffer)
+		ct.buffer = nil
+		ct.saveOutbox()
+	}
+	ct.mu.Unlock()
+
+	ct.deliver()
 }
 
-// sendMetric sends a metric to the server telemetry endpoint
-func (ct *ClientTelemetry) sendMetric(metric ClientMetric) {
-	go ct.sendToServer("/api/telemetry/metrics", metric)
+// flushLoop sends partial batches so quiet periods still report promptly,
+// retries failed ones, and reports delivery statistics
+func (ct *ClientTelemetry) flushLoop() {
+	flush := time.NewTicker(batchFlushInterval)
+	defer flush.Stop()
+	stats := time.NewTicker(deliveryStatsInterval)
+	defer stats.Stop()
+	for {
+		select {
+		case <-flush.C:
+			ct.Flush()
+		case <-stats.C:
+			ct.reportDeliveryStats()
+		}
+	}
 }
 
-// sendToServer sends telemetry data to server endpoint
-func (ct *ClientTelemetry) sendToServer(endpoint string, data interface{}) {
+// sendToServer posts telemetry data to a server endpoint and waits for the
+// response status. retryAfter is set when the server asks the client to slow down.
+func (ct *ClientTelemetry) sendToServer(endpoint string, data interface{}) (status int, retryAfter time.Duration, err error) {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		js.Global().Get("console").Call("error", "Failed to marshal telemetry data:", err.Error())
-		return
+		return 0, 0, err
 	}
 
 	// Use fetch API to send data
 	url := ct.serverURL + endpoint
 	headers := map[string]interface{}{
-		"Content-Type":      "application/json",
-		"X-Session-ID":      ct.sessionID,
-		"X-Correlation-ID":  ct.correlationID,
+		"Content-Type":     "application/json",
+		"X-Session-ID":     ct.sessionID,
+		"X-Correlation-ID": ct.correlationID,
+		"traceparent":      ct.TraceParent(),
 	}
 
+	// Not keepalive: browsers cap keepalive bodies in flight at 64KB, which
+	// is left for the sendBeacon flush when the page goes away
 	options := map[string]interface{}{
-		"method": "POST",
+		"method":  "POST",
 		"headers": headers,
-		"body": string(jsonData),
+		"body":    string(jsonData),
 	}
 
 	// Convert Go map to JavaScript object
 	jsOptions := js.ValueOf(options)
 
-	fetch := js.Global().Get("fetch")
-	promise := fetch.Invoke(url, jsOptions)
-
-	// Handle promise (fire and forget for now)
-	promise.Call("catch", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+	type result struct {
+		status     int
+		retryAfter time.Duration
+		err        error
+	}
+	done := make(chan result, 1)
+
+	onResponse := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		resp := args[0]
+		res := result{status: resp.Get("status").Int()}
+		if header := resp.Get("headers").Call("get", "Retry-After"); !header.IsNull() {
+			if seconds, err := strconv.Atoi(header.String()); err == nil {
+				res.retryAfter = time.Duration(seconds) * time.Second
+			}
+		}
+		done <- res
+		return nil
+	})
+	onError := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
 		js.Global().Get("console").Call("error", "Failed to send telemetry:", args[0])
+		done <- result{err: errors.New("send telemetry: " + args[0].Call("toString").String())}
 		return nil
-	}))
+	})
+	defer onResponse.Release()
+	defer onError.Release()
+
+	fetch := js.Global().Get("fetch")
+	fetch.Invoke(url, jsOptions).Call("then", onResponse).Call("catch", onError)
+
+	res := <-done
+	return res.status, res.retryAfter, res.err
 }
 
 // GetSessionID returns the current session ID
@@ -183,9 +367,18 @@ type ClientSpan struct {
 	EndTime       time.Time
 	SessionID     string
 	Attributes    map[string]interface{}
+	Events        []ClientSpanEvent
+	Status        string // SpanStatusOK or SpanStatusError; unset if empty
+	StatusMessage string
 	telemetry     *ClientTelemetry
+	parent        *ClientSpan
+	droppedEvents int // Events past MaxSpanEvents
+	ended         bool
 }
 
+// maxErrorMessageLength matches the server's limit on attribute strings
+const maxErrorMessageLength = 256
+
 // SetAttribute adds an attribute to the span
 func (cs *ClientSpan) SetAttribute(key string, value interface{}) {
 	if cs.Attributes == nil {
@@ -194,39 +387,89 @@ func (cs *ClientSpan) SetAttribute(key string, value interface{}) {
 	cs.Attributes[key] = value
 }
 
-// End finishes the span and sends it
+// StartChild starts a span under cs
+func (cs *ClientSpan) StartChild(operationName string) *ClientSpan {
+	return cs.telemetry.startSpan(operationName, cs)
+}
+
+// AddEvent records a moment within the span. Events past MaxSpanEvents are
+// only counted.
+func (cs *ClientSpan) AddEvent(name string, attributes map[string]interface{}) {
+	if len(cs.Events) >= MaxSpanEvents {
+		cs.droppedEvents++
+		return
+	}
+	cs.Events = append(cs.Events, ClientSpanEvent{Name: name, Timestamp: time.Now(), Attributes: attributes})
+}
+
+// SetStatus sets the span's status to SpanStatusOK or SpanStatusError
+func (cs *ClientSpan) SetStatus(status, message string) {
+	cs.Status = status
+	cs.StatusMessage = message
+}
+
+// RecordError adds an exception event to the span and marks it as failed
+func (cs *ClientSpan) RecordError(description string) {
+	if len(description) > maxErrorMessageLength {
+		description = strings.ToValidUTF8(description[:maxErrorMessageLength], "")
+	}
+	cs.AddEvent("exception", map[string]interface{}{"exception.message": description})
+	cs.SetStatus(SpanStatusError, description)
+}
+
+// End finishes the span and buffers it for the next batch. The span's parent
+// becomes the active span again.
 func (cs *ClientSpan) End() {
+	if cs.ended {
+		return
+	}
+	cs.ended = true
 	cs.EndTime = time.Now()
-	duration := cs.EndTime.Sub(cs.StartTime)
-
-	// Create span event
-	event := ClientEvent{
-		Type:          "span",
-		Timestamp:     cs.StartTime,
-		SessionID:     cs.SessionID,
-		CorrelationID: cs.telemetry.correlationID,
-		Data:          cs.OperationName,
-		TraceID:       cs.TraceID,
-		SpanID:        cs.SpanID,
-		Attributes: map[string]interface{}{
-			"duration_ms":    duration.Milliseconds(),
-			"operation_name": cs.OperationName,
-		},
+	if cs.droppedEvents > 0 {
+		cs.SetAttribute("dropped_events", cs.droppedEvents)
 	}
 
-	// Merge span attributes
-	for k, v := range cs.Attributes {
-		event.Attributes[k] = v
+	cs.telemetry.mu.Lock()
+	if cs.telemetry.active == cs {
+		cs.telemetry.active = cs.parent
 	}
+	cs.telemetry.mu.Unlock()
 
-	cs.telemetry.sendEvent(event)
+	cs.telemetry.enqueue(BatchItem{Kind: BatchSpan, Span: &ClientSpanData{
+		TraceID:       cs.TraceID,
+		SpanID:        cs.SpanID,
+		ParentSpanID:  cs.ParentSpanID,
+		Name:          cs.OperationName,
+		StartTime:     cs.StartTime,
+		EndTime:       cs.EndTime,
+		SessionID:     cs.SessionID,
+		Attributes:    cs.Attributes,
+		Events:        cs.Events,
+		Status:        cs.Status,
+		StatusMessage: cs.StatusMessage,
+	}})
 }
 
-// Helper functions for generating IDs
+// generateTraceID creates a W3C trace ID: 16 random bytes in lowercase hex
 func generateTraceID() string {
-	return fmt.Sprintf("trace_%d", time.Now().UnixNano())
+	return randomHex(16)
 }
 
+// generateSpanID creates a W3C span ID: 8 random bytes in lowercase hex
 func generateSpanID() string {
-	return fmt.Sprintf("span_%d", time.Now().UnixNano())
-}
\ No newline at end of file
+	return randomHex(8)
+}
+
+// randomHex returns n random bytes, not all zero, as lowercase hex. crypto/rand
+// reads from the browser's crypto.getRandomValues.
+func randomHex(n int) string {
+	data := make([]byte, n)
+	for {
+		rand.Read(data)
+		for _, b := range data {
+			if b != 0 {
+				return hex.EncodeToString(data)
+			}
+		}
+	}
+}
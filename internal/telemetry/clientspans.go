@@ -0,0 +1,186 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Spans finished in the browser are exported as the client service, with one
+// resource per play session
+const (
+	clientServiceName = "incident-commander-client"
+	clientTracerName  = "github.com/NathanNam/incident-commander-game/internal/telemetry/client"
+	maxClientSessions = 1000 // Least recently used sessions are forgotten past this
+	clientSessionIdle = 30 * time.Minute
+)
+
+// clientSpanProcessor is the server's batching span processor, shared so client
+// spans go out through the same exporter. It's nil until tracing is set up.
+var clientSpanProcessor sdktrace.SpanProcessor
+
+// clientBaseResource holds the OTEL_RESOURCE_ATTRIBUTES every client session's
+// resource starts from, set up with tracing
+var clientBaseResource *resource.Resource
+
+// clientSession is the tracer provider carrying one session's resource
+type clientSession struct {
+	provider *sdktrace.TracerProvider
+	lastUsed time.Time
+}
+
+var (
+	clientSessionsMu sync.Mutex
+	clientSessions   = make(map[string]*clientSession)
+)
+
+// clientIDsKey is the context key for the IDs a client span was created with
+type clientIDsKey struct{}
+
+// clientIDs are the trace and span IDs the browser assigned to a span
+type clientIDs struct {
+	traceID trace.TraceID
+	spanID  trace.SpanID
+}
+
+// clientIDGenerator hands the SDK the browser's IDs instead of random ones, so
+// server spans parented by the client's traceparent header line up with them
+type clientIDGenerator struct{}
+
+func (clientIDGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	ids, _ := ctx.Value(clientIDsKey{}).(clientIDs)
+	return ids.traceID, ids.spanID
+}
+
+func (clientIDGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	ids, _ := ctx.Value(clientIDsKey{}).(clientIDs)
+	return ids.spanID
+}
+
+// RecordClientSpan exports a span the browser finished as a real span, with
+// the client's IDs, parent, timestamps, attributes, events and status. The
+// span's resource identifies the client service and the play session.
+func RecordClientSpan(clientSpan ClientSpanData, sessionID, userAgent string) error {
+	traceID, err := trace.TraceIDFromHex(clientSpan.TraceID)
+	if err != nil {
+		return fmt.Errorf("trace ID %.32q: %w", clientSpan.TraceID, err)
+	}
+	spanID, err := trace.SpanIDFromHex(clientSpan.SpanID)
+	if err != nil {
+		return fmt.Errorf("span ID %.16q: %w", clientSpan.SpanID, err)
+	}
+
+	ctx := context.WithValue(context.Background(), clientIDsKey{}, clientIDs{traceID, spanID})
+	if clientSpan.ParentSpanID != "" {
+		parentID, err := trace.SpanIDFromHex(clientSpan.ParentSpanID)
+		if err != nil {
+			return fmt.Errorf("parent span ID %.16q: %w", clientSpan.ParentSpanID, err)
+		}
+		ctx = trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     parentID,
+			TraceFlags: trace.FlagsSampled,
+			Remote:     true,
+		}))
+	}
+
+	provider := clientTracerProvider(sessionID, userAgent)
+	if provider == nil {
+		return nil
+	}
+	_, span := provider.Tracer(clientTracerName).Start(ctx, clientSpan.Name,
+		trace.WithTimestamp(clientSpan.StartTime),
+		trace.WithAttributes(clientAttributes(clientSpan.Attributes)...),
+	)
+	for _, event := range clientSpan.Events {
+		span.AddEvent(event.Name,
+			trace.WithTimestamp(event.Timestamp),
+			trace.WithAttributes(clientAttributes(event.Attributes)...),
+		)
+	}
+	switch clientSpan.Status {
+	case SpanStatusOK:
+		span.SetStatus(codes.Ok, "")
+	case SpanStatusError:
+		span.SetStatus(codes.Error, clientSpan.StatusMessage)
+	}
+	span.End(trace.WithTimestamp(clientSpan.EndTime))
+	return nil
+}
+
+// clientTracerProvider returns the tracer provider for a session, creating it
+// if needed. It returns nil when tracing isn't set up.
+func clientTracerProvider(sessionID, userAgent string) *sdktrace.TracerProvider {
+	if clientSpanProcessor == nil {
+		return nil
+	}
+
+	clientSessionsMu.Lock()
+	defer clientSessionsMu.Unlock()
+
+	now := time.Now()
+	if session, ok := clientSessions[sessionID]; ok {
+		session.lastUsed = now
+		return session.provider
+	}
+
+	if len(clientSessions) >= maxClientSessions {
+		oldest := ""
+		for id, session := range clientSessions {
+			if now.Sub(session.lastUsed) > clientSessionIdle {
+				delete(clientSessions, id)
+			} else if oldest == "" || session.lastUsed.Before(clientSessions[oldest].lastUsed) {
+				oldest = id
+			}
+		}
+		if len(clientSessions) >= maxClientSessions {
+			delete(clientSessions, oldest)
+		}
+	}
+
+	attributes := []attribute.KeyValue{
+		semconv.ServiceName(clientServiceName),
+		attribute.String("session.id", sessionID),
+		semconv.UserAgentOriginal(userAgent),
+	}
+	if version := serviceVersion(); version != "" {
+		attributes = append(attributes, semconv.ServiceVersion(version))
+	}
+	res, err := resource.Merge(clientBaseResource, resource.NewSchemaless(attributes...))
+	if err != nil {
+		res = resource.NewSchemaless(attributes...)
+	}
+	// Providers share the server's processor and are never shut down; the
+	// server's provider flushes the processor on exit
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(clientSpanProcessor),
+		sdktrace.WithResource(res),
+		sdktrace.WithIDGenerator(clientIDGenerator{}),
+	)
+	clientSessions[sessionID] = &clientSession{provider: provider, lastUsed: now}
+	return provider
+}
+
+// clientAttributes converts a client's checked attribute map into span attributes
+func clientAttributes(attributes map[string]interface{}) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attributes))
+	for key, value := range attributes {
+		switch v := value.(type) {
+		case string:
+			kvs = append(kvs, attribute.String(key, v))
+		case float64:
+			kvs = append(kvs, attribute.Float64(key, v))
+		case bool:
+			kvs = append(kvs, attribute.Bool(key, v))
+		}
+	}
+	return kvs
+}
@@ -2,18 +2,27 @@ package telemetry
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/url"
 	"os"
+	"runtime/debug"
 	"strings"
+	"time"
 
 	"go.opentelemetry.io/contrib/bridges/otelslog"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/log/global"
 	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
 	sdklog "go.opentelemetry.io/otel/sdk/log"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
@@ -22,6 +31,9 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
+// flushTimeout bounds how long shutdown waits to export buffered telemetry
+const flushTimeout = 10 * time.Second
+
 // Global telemetry instances
 var (
 	appTracer trace.Tracer
@@ -29,97 +41,174 @@ var (
 	appLogger *slog.Logger
 )
 
-// parseOTLPEndpoint parses the OTLP endpoint URL and returns the host, base path, and whether to use HTTPS
-func parseOTLPEndpoint(endpoint string) (host string, basePath string, useHTTPS bool, err error) {
-	// If no protocol is specified, assume localhost:port format
-	if !strings.Contains(endpoint, "://") {
-		return endpoint, "", false, nil
-	}
+// OTLP protocols, as OTEL_EXPORTER_OTLP_PROTOCOL names them
+const (
+	protocolHTTP = "http/protobuf" // The default
+	protocolGRPC = "grpc"
+)
 
-	u, err := url.Parse(endpoint)
-	if err != nil {
-		return "", "", false, err
+// otlpEnv returns the exporter variable OTEL_EXPORTER_OTLP_<signal>_<name>, or
+// the general OTEL_EXPORTER_OTLP_<name> when the signal's own isn't set
+func otlpEnv(signal, name string) string {
+	if value := os.Getenv("OTEL_EXPORTER_OTLP_" + signal + "_" + name); value != "" {
+		return value
 	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_" + name)
+}
 
-	host = u.Host
-	if u.Port() == "" {
-		if u.Scheme == "https" {
-			host += ":443"
-		} else {
-			host += ":80"
-		}
+// otlpProtocol returns the protocol a signal is exported with
+func otlpProtocol(signal string) (string, error) {
+	switch protocol := otlpEnv(signal, "PROTOCOL"); protocol {
+	case "", protocolHTTP:
+		return protocolHTTP, nil
+	case protocolGRPC:
+		return protocolGRPC, nil
+	default:
+		return "", fmt.Errorf("OTLP protocol %q for %s isn't supported; use %q or %q",
+			protocol, strings.ToLower(signal), protocolHTTP, protocolGRPC)
 	}
+}
 
-	// Preserve the path (e.g., "/v2/otel" for Observe)
-	basePath = strings.TrimSuffix(u.Path, "/")
-	useHTTPS = u.Scheme == "https"
-	return host, basePath, useHTTPS, nil
+// plainOTLPEndpoint returns the host:port a signal is exported to without
+// TLS when the environment gives no URL for it. That's localhost by default,
+// as the spec has it, or a bare host:port in OTEL_EXPORTER_OTLP_ENDPOINT, which
+// the server used to accept. The exporters would otherwise dial either with TLS.
+func plainOTLPEndpoint(signal, protocol string) (string, bool) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_"+signal+"_ENDPOINT") != "" {
+		return "", false
+	}
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	switch {
+	case strings.Contains(endpoint, "://"):
+		return "", false
+	case endpoint != "":
+		return endpoint, true
+	case protocol == protocolGRPC:
+		return "localhost:4317", true
+	default:
+		return "localhost:4318", true
+	}
 }
 
-// buildOTLPHeaders creates the standard headers for OTLP exporters.
-func buildOTLPHeaders(targetPackage, bearerToken string) map[string]string {
-	headers := map[string]string{
-		"x-observe-target-package": targetPackage,
+// otlpHeaders returns the headers a signal's exporter should send, or nil to
+// leave them to the exporter, which reads OTEL_EXPORTER_OTLP_HEADERS itself.
+// OTEL_EXPORTER_OTLP_BEARER_TOKEN is still honored by adding an Authorization
+// header, unless the standard headers already have one.
+func otlpHeaders(signal string) map[string]string {
+	token := os.Getenv("OTEL_EXPORTER_OTLP_BEARER_TOKEN")
+	if token == "" {
+		return nil
 	}
-	if bearerToken != "" {
-		headers["Authorization"] = "Bearer " + bearerToken
+	headers := parseOTLPHeaders(otlpEnv(signal, "HEADERS"))
+	for key := range headers {
+		if strings.EqualFold(key, "Authorization") {
+			return headers
+		}
 	}
+	headers["Authorization"] = "Bearer " + token
 	return headers
 }
 
-// setupTracing configures OpenTelemetry tracing with OTLP HTTP exporter.
-func setupTracing(ctx context.Context, res *resource.Resource, otlpEndpoint, bearerToken string) (*sdktrace.TracerProvider, error) {
-	host, basePath, useHTTPS, err := parseOTLPEndpoint(otlpEndpoint)
-	if err != nil {
-		return nil, err
+// parseOTLPHeaders parses a headers variable: comma-separated key=value pairs
+// with percent-encoded values. Malformed pairs are skipped.
+func parseOTLPHeaders(value string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		val, err := url.PathUnescape(strings.TrimSpace(val))
+		if err != nil {
+			continue
+		}
+		headers[key] = val
 	}
+	return headers
+}
 
-	headers := buildOTLPHeaders("Tracing", bearerToken)
-	urlPath := basePath + "/v1/traces"
-	options := []otlptracehttp.Option{
-		otlptracehttp.WithEndpoint(host),
-		otlptracehttp.WithURLPath(urlPath),
-		otlptracehttp.WithHeaders(headers),
+// setupTracing configures OpenTelemetry tracing with an OTLP exporter.
+// OTEL_TRACES_SAMPLER and OTEL_TRACES_SAMPLER_ARG pick the sampler.
+func setupTracing(ctx context.Context, res *resource.Resource) (*sdktrace.TracerProvider, error) {
+	protocol, err := otlpProtocol("TRACES")
+	if err != nil {
+		return nil, err
 	}
-
-	if !useHTTPS {
-		options = append(options, otlptracehttp.WithInsecure())
+	headers := otlpHeaders("TRACES")
+	endpoint, plain := plainOTLPEndpoint("TRACES", protocol)
+
+	var traceExporter sdktrace.SpanExporter
+	if protocol == protocolGRPC {
+		var options []otlptracegrpc.Option
+		if plain {
+			options = append(options, otlptracegrpc.WithEndpoint(endpoint), otlptracegrpc.WithInsecure())
+		}
+		if headers != nil {
+			options = append(options, otlptracegrpc.WithHeaders(headers))
+		}
+		traceExporter, err = otlptracegrpc.New(ctx, options...)
+	} else {
+		var options []otlptracehttp.Option
+		if plain {
+			options = append(options, otlptracehttp.WithEndpoint(endpoint), otlptracehttp.WithInsecure())
+		}
+		if headers != nil {
+			options = append(options, otlptracehttp.WithHeaders(headers))
+		}
+		traceExporter, err = otlptracehttp.New(ctx, options...)
 	}
-
-	traceExporter, err := otlptracehttp.New(ctx, options...)
 	if err != nil {
 		return nil, err
 	}
 
+	// Spans re-emitted for the browser go through the same batcher
+	clientSpanProcessor = sdktrace.NewBatchSpanProcessor(traceExporter)
 	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(traceExporter),
+		sdktrace.WithSpanProcessor(clientSpanProcessor),
 		sdktrace.WithResource(res),
 	)
 	otel.SetTracerProvider(tp)
 
+	// Continue traces the browser starts: requests carrying a W3C traceparent
+	// header get server spans parented to the client's span
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
 	return tp, nil
 }
 
-// setupMetrics configures OpenTelemetry metrics with OTLP HTTP exporter.
-func setupMetrics(ctx context.Context, res *resource.Resource, otlpEndpoint, bearerToken string) (*sdkmetric.MeterProvider, error) {
-	host, basePath, useHTTPS, err := parseOTLPEndpoint(otlpEndpoint)
+// setupMetrics configures OpenTelemetry metrics with an OTLP exporter.
+func setupMetrics(ctx context.Context, res *resource.Resource) (*sdkmetric.MeterProvider, error) {
+	protocol, err := otlpProtocol("METRICS")
 	if err != nil {
 		return nil, err
 	}
-
-	headers := buildOTLPHeaders("Metrics", bearerToken)
-	urlPath := basePath + "/v1/metrics"
-	options := []otlpmetrichttp.Option{
-		otlpmetrichttp.WithEndpoint(host),
-		otlpmetrichttp.WithURLPath(urlPath),
-		otlpmetrichttp.WithHeaders(headers),
-	}
-
-	if !useHTTPS {
-		options = append(options, otlpmetrichttp.WithInsecure())
+	headers := otlpHeaders("METRICS")
+	endpoint, plain := plainOTLPEndpoint("METRICS", protocol)
+
+	var metricExporter sdkmetric.Exporter
+	if protocol == protocolGRPC {
+		var options []otlpmetricgrpc.Option
+		if plain {
+			options = append(options, otlpmetricgrpc.WithEndpoint(endpoint), otlpmetricgrpc.WithInsecure())
+		}
+		if headers != nil {
+			options = append(options, otlpmetricgrpc.WithHeaders(headers))
+		}
+		metricExporter, err = otlpmetricgrpc.New(ctx, options...)
+	} else {
+		var options []otlpmetrichttp.Option
+		if plain {
+			options = append(options, otlpmetrichttp.WithEndpoint(endpoint), otlpmetrichttp.WithInsecure())
+		}
+		if headers != nil {
+			options = append(options, otlpmetrichttp.WithHeaders(headers))
+		}
+		metricExporter, err = otlpmetrichttp.New(ctx, options...)
 	}
-
-	metricExporter, err := otlpmetrichttp.New(ctx, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -133,26 +222,35 @@ func setupMetrics(ctx context.Context, res *resource.Resource, otlpEndpoint, bea
 	return mp, nil
 }
 
-// setupLogging configures OpenTelemetry logging with OTLP HTTP exporter and structured logging.
-func setupLogging(ctx context.Context, res *resource.Resource, otlpEndpoint, bearerToken, serviceName string) (*sdklog.LoggerProvider, error) {
-	host, basePath, useHTTPS, err := parseOTLPEndpoint(otlpEndpoint)
+// setupLogging configures OpenTelemetry logging with an OTLP exporter and structured logging.
+func setupLogging(ctx context.Context, res *resource.Resource, serviceName string) (*sdklog.LoggerProvider, error) {
+	protocol, err := otlpProtocol("LOGS")
 	if err != nil {
 		return nil, err
 	}
-
-	headers := buildOTLPHeaders("Logs", bearerToken)
-	urlPath := basePath + "/v1/logs"
-	options := []otlploghttp.Option{
-		otlploghttp.WithEndpoint(host),
-		otlploghttp.WithURLPath(urlPath),
-		otlploghttp.WithHeaders(headers),
-	}
-
-	if !useHTTPS {
-		options = append(options, otlploghttp.WithInsecure())
+	headers := otlpHeaders("LOGS")
+	endpoint, plain := plainOTLPEndpoint("LOGS", protocol)
+
+	var logExporter sdklog.Exporter
+	if protocol == protocolGRPC {
+		var options []otlploggrpc.Option
+		if plain {
+			options = append(options, otlploggrpc.WithEndpoint(endpoint), otlploggrpc.WithInsecure())
+		}
+		if headers != nil {
+			options = append(options, otlploggrpc.WithHeaders(headers))
+		}
+		logExporter, err = otlploggrpc.New(ctx, options...)
+	} else {
+		var options []otlploghttp.Option
+		if plain {
+			options = append(options, otlploghttp.WithEndpoint(endpoint), otlploghttp.WithInsecure())
+		}
+		if headers != nil {
+			options = append(options, otlploghttp.WithHeaders(headers))
+		}
+		logExporter, err = otlploghttp.New(ctx, options...)
 	}
-
-	logExporter, err := otlploghttp.New(ctx, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -170,34 +268,77 @@ func setupLogging(ctx context.Context, res *resource.Resource, otlpEndpoint, bea
 	return lp, nil
 }
 
+// sdkDisabled reports whether OTEL_SDK_DISABLED turns telemetry off
+func sdkDisabled() bool {
+	return strings.EqualFold(strings.TrimSpace(os.Getenv("OTEL_SDK_DISABLED")), "true")
+}
+
+// serviceVersion is the module version the binary was built from, or the
+// commit for a local build. It's empty when the build info has neither.
+func serviceVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if version := info.Main.Version; version != "" && version != "(devel)" {
+		return version
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			if len(setting.Value) > 12 {
+				return setting.Value[:12]
+			}
+			return setting.Value
+		}
+	}
+	return ""
+}
+
 // SetupInstrumentation initializes OpenTelemetry with tracing, metrics, and logging.
+// Exporters are configured with the standard OTEL_* environment variables and
+// OTEL_RESOURCE_ATTRIBUTES adds resource attributes. serviceName takes
+// precedence over OTEL_SERVICE_NAME, so callers choose which one applies.
+// With OTEL_SDK_DISABLED=true telemetry is a no-op.
 // Returns a cleanup function that should be called before application shutdown.
 func SetupInstrumentation(serviceName string) func() {
 	ctx := context.Background()
 
-	// Get OTLP endpoint from environment or use default
-	otlpEndpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if otlpEndpoint == "" {
-		otlpEndpoint = "localhost:4318"
+	if sdkDisabled() {
+		appTracer = otel.Tracer(serviceName)
+		appMeter = otel.Meter(serviceName)
+		appLogger = slog.Default()
+		appLogger.Info("OpenTelemetry SDK disabled", "service", serviceName)
+		return func() {}
 	}
 
-	// Get bearer token from environment
-	bearerToken := os.Getenv("OTEL_EXPORTER_OTLP_BEARER_TOKEN")
-
-	// Create resource with service identification
+	// Create resource with service identification. Later options win, so the
+	// environment may override the version but not the service name.
+	var attributes []attribute.KeyValue
+	if version := serviceVersion(); version != "" {
+		attributes = append(attributes, semconv.ServiceVersion(version))
+	}
 	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName(serviceName),
-			semconv.ServiceVersion("1.0.0"),
-		),
+		resource.WithAttributes(attributes...),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
 	)
-	if err != nil {
+	if errors.Is(err, resource.ErrPartialResource) {
+		slog.Warn("ignoring malformed resource attributes", "error", err)
+	} else if err != nil {
 		slog.Error("failed to create resource", "error", err)
 		panic(err)
 	}
 
+	// Client spans share the deployment's attributes, such as deployment.environment
+	clientBaseResource, err = resource.New(ctx, resource.WithFromEnv())
+	if err != nil && !errors.Is(err, resource.ErrPartialResource) {
+		slog.Error("failed to create client resource", "error", err)
+		panic(err)
+	}
+
 	// Setup tracing
-	tp, err := setupTracing(ctx, res, otlpEndpoint, bearerToken)
+	tp, err := setupTracing(ctx, res)
 	if err != nil {
 		slog.Error("failed to setup tracing", "error", err)
 		panic(err)
@@ -205,7 +346,7 @@ func SetupInstrumentation(serviceName string) func() {
 	appTracer = otel.Tracer(serviceName)
 
 	// Setup metrics
-	mp, err := setupMetrics(ctx, res, otlpEndpoint, bearerToken)
+	mp, err := setupMetrics(ctx, res)
 	if err != nil {
 		slog.Error("failed to setup metrics", "error", err)
 		panic(err)
@@ -213,20 +354,25 @@ func SetupInstrumentation(serviceName string) func() {
 	appMeter = otel.Meter(serviceName)
 
 	// Setup logging
-	lp, err := setupLogging(ctx, res, otlpEndpoint, bearerToken, serviceName)
+	lp, err := setupLogging(ctx, res, serviceName)
 	if err != nil {
 		slog.Error("failed to setup logging", "error", err)
 		panic(err)
 	}
 
+	name, _ := res.Set().Value(semconv.ServiceNameKey)
 	appLogger.Info("OpenTelemetry instrumentation initialized",
-		"service", serviceName,
-		"endpoint", otlpEndpoint)
+		"service", name.AsString(),
+		"endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"))
 
-	// Return cleanup function
+	// Return cleanup function. Shutting down flushes whatever the batchers still
+	// hold, but an unreachable collector mustn't hold up the exit forever.
 	return func() {
 		appLogger.Info("Shutting down OpenTelemetry instrumentation")
 
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		defer cancel()
+
 		if err := tp.Shutdown(ctx); err != nil {
 			slog.Error("failed to shutdown tracer provider", "error", err)
 		}
@@ -0,0 +1,301 @@
+//go:build js && wasm
+// +build js,wasm
+
+package telemetry
+
+import (
+	"encoding/json"
+	"math/rand"
+	"syscall/js"
+	"time"
+)
+
+// Outbox limits. Batches are retried with exponential backoff until the
+// server takes them or they run out of attempts.
+const (
+	outboxStorageKey      = "incident_commander_telemetry_outbox" // localStorage key
+	maxOutboxBatches      = 20                                    // Oldest batches are dropped past this
+	maxBatchBytes         = 60 << 10                              // Under the server's 64KB max_body_bytes, also the sendBeacon limit
+	maxDeliveryAttempts   = 6
+	retryBaseDelay        = time.Second
+	retryMaxDelay         = time.Minute
+	deliveryStatsInterval = time.Minute
+)
+
+// pendingBatch is a batch the server hasn't accepted yet
+type pendingBatch struct {
+	Items    []BatchItem `json:"items"`
+	Attempts int         `json:"attempts"`
+	NextTry  time.Time   `json:"next_try"`
+	sending  bool        // A request for it is in flight
+}
+
+// deliveryStats counts what happened to batches since the last report
+type deliveryStats struct {
+	delivered int // Accepted by a fetch
+	beaconed  int // Handed to sendBeacon as the page was hidden
+	retried   int
+	dropped   int // Refused by the server, out of attempts or pushed out of a full outbox
+	changed   bool
+}
+
+// loadOutbox restores batches a previous page load couldn't deliver
+func (ct *ClientTelemetry) loadOutbox() {
+	stored := js.Global().Get("localStorage").Call("getItem", outboxStorageKey)
+	if stored.IsNull() {
+		return
+	}
+	var batches []*pendingBatch
+	if err := json.Unmarshal([]byte(stored.String()), &batches); err != nil {
+		js.Global().Get("localStorage").Call("removeItem", outboxStorageKey)
+		return
+	}
+
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	for _, b := range batches {
+		switch {
+		case len(b.Items) == 0:
+		case batchSize(b.Items) > maxBatchBytes:
+			ct.queueBatches(b.Items) // Stored before batches were split by size
+		default:
+			b.NextTry = time.Time{}
+			ct.addToOutbox(b)
+		}
+	}
+}
+
+// saveOutbox writes undelivered batches to localStorage. The caller holds ct.mu.
+func (ct *ClientTelemetry) saveOutbox() {
+	storage := js.Global().Get("localStorage")
+	if len(ct.outbox) == 0 {
+		storage.Call("removeItem", outboxStorageKey)
+		return
+	}
+	data, err := json.Marshal(ct.outbox)
+	if err != nil {
+		return
+	}
+	storage.Call("setItem", outboxStorageKey, string(data))
+}
+
+// batchEnvelope is the encoded size of an empty batch
+var batchEnvelope = len(`{"items":[]}`)
+
+// queueBatches moves items into the outbox as batches whose encoded size stays
+// under maxBatchBytes. An item too big to send on its own is dropped like a
+// batch the server refused. The caller holds ct.mu.
+func (ct *ClientTelemetry) queueBatches(items []BatchItem) {
+	var batch []BatchItem
+	size := batchEnvelope
+	for _, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil || batchEnvelope+len(data) > maxBatchBytes {
+			ct.countDelivery(&ct.stats.dropped)
+			continue
+		}
+		if len(batch) > 0 && size+1+len(data) > maxBatchBytes {
+			ct.addToOutbox(&pendingBatch{Items: batch})
+			batch, size = nil, batchEnvelope
+		}
+		if len(batch) > 0 {
+			size++ // The comma between items
+		}
+		batch = append(batch, item)
+		size += len(data)
+	}
+	if len(batch) > 0 {
+		ct.addToOutbox(&pendingBatch{Items: batch})
+	}
+}
+
+// batchSize returns the encoded size of a batch of items
+func batchSize(items []BatchItem) int {
+	data, _ := json.Marshal(TelemetryBatch{Items: items})
+	return len(data)
+}
+
+// addToOutbox queues a batch, dropping the oldest one if the outbox is full.
+// The caller holds ct.mu.
+func (ct *ClientTelemetry) addToOutbox(b *pendingBatch) {
+	ct.outbox = append(ct.outbox, b)
+	if len(ct.outbox) > maxOutboxBatches {
+		ct.outbox = ct.outbox[1:]
+		ct.countDelivery(&ct.stats.dropped)
+	}
+}
+
+// removeFromOutbox forgets a batch. The caller holds ct.mu.
+func (ct *ClientTelemetry) removeFromOutbox(b *pendingBatch) {
+	for i, pending := range ct.outbox {
+		if pending == b {
+			ct.outbox = append(ct.outbox[:i], ct.outbox[i+1:]...)
+			return
+		}
+	}
+}
+
+// countDelivery bumps one of the delivery counters. The caller holds ct.mu.
+func (ct *ClientTelemetry) countDelivery(counter *int) {
+	*counter++
+	ct.stats.changed = true
+}
+
+// deliver sends the batches that are due one at a time, so a backlog such as
+// a full outbox after a reload doesn't go out all at once. It returns at once
+// if a delivery is already running.
+func (ct *ClientTelemetry) deliver() {
+	ct.mu.Lock()
+	if ct.delivering {
+		ct.mu.Unlock()
+		return
+	}
+	ct.delivering = true
+	ct.mu.Unlock()
+
+	go func() {
+		for b := ct.nextDue(); b != nil; b = ct.nextDue() {
+			ct.send(b)
+		}
+	}()
+}
+
+// nextDue marks the oldest batch that's due as sending and returns it, or
+// ends the delivery and returns nil when none is
+func (ct *ClientTelemetry) nextDue() *pendingBatch {
+	now := time.Now()
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	for _, b := range ct.outbox {
+		if !now.Before(b.NextTry) {
+			b.sending = true
+			return b
+		}
+	}
+	ct.delivering = false
+	return nil
+}
+
+// send posts one batch and decides, from the outcome, whether to keep it
+func (ct *ClientTelemetry) send(b *pendingBatch) {
+	status, retryAfter, err := ct.sendToServer("/api/telemetry/batch", TelemetryBatch{Items: b.Items})
+
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	b.sending = false
+
+	switch {
+	case err == nil && status < 300:
+		ct.removeFromOutbox(b)
+		ct.countDelivery(&ct.stats.delivered)
+	case err == nil && status == 413 && len(b.Items) > 1:
+		// The server takes smaller bodies than maxBatchBytes; send it in halves
+		ct.removeFromOutbox(b)
+		half := len(b.Items) / 2
+		ct.addToOutbox(&pendingBatch{Items: b.Items[:half]})
+		ct.addToOutbox(&pendingBatch{Items: b.Items[half:]})
+		ct.countDelivery(&ct.stats.retried)
+	case err == nil && status < 500 && status != 429:
+		// The server refused the batch itself; sending it again won't help
+		ct.removeFromOutbox(b)
+		ct.countDelivery(&ct.stats.dropped)
+	default:
+		b.Attempts++
+		if b.Attempts >= maxDeliveryAttempts {
+			ct.removeFromOutbox(b)
+			ct.countDelivery(&ct.stats.dropped)
+			break
+		}
+		delay := retryDelay(b.Attempts)
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		b.NextTry = time.Now().Add(delay)
+		ct.countDelivery(&ct.stats.retried)
+	}
+	ct.saveOutbox()
+}
+
+// retryDelay is the backoff before the given attempt, with jitter so clients
+// that failed together don't retry together
+func retryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay << (attempts - 1)
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// watchPageLifecycle hands everything undelivered to sendBeacon when the page
+// is hidden or unloaded, since fetches may not finish after that. Unloading
+// also ends the session span.
+func (ct *ClientTelemetry) watchPageLifecycle() {
+	document := js.Global().Get("document")
+	onHide := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		switch {
+		case args[0].Get("type").String() == "pagehide":
+			ct.endSession() // Closes the trace before the last flush
+		case document.Get("visibilityState").String() != "hidden":
+			return nil
+		}
+		ct.flushWithBeacon()
+		return nil
+	})
+	js.Global().Call("addEventListener", "pagehide", onHide)
+	document.Call("addEventListener", "visibilitychange", onHide)
+}
+
+// flushWithBeacon sends buffered items and undelivered batches with
+// navigator.sendBeacon. Batches the browser won't queue stay in localStorage
+// for the next page load.
+func (ct *ClientTelemetry) flushWithBeacon() {
+	navigator := js.Global().Get("navigator")
+	canBeacon := !navigator.Get("sendBeacon").IsUndefined()
+	url := ct.serverURL + "/api/telemetry/batch"
+
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	if len(ct.buffer) > 0 {
+		ct.queueBatches(ct.buffer)
+		ct.buffer = nil
+	}
+	if canBeacon {
+		for _, b := range append([]*pendingBatch(nil), ct.outbox...) {
+			if b.sending {
+				continue // Its fetch may still land; if not, it's sent again on the next page load
+			}
+			data, err := json.Marshal(TelemetryBatch{Items: b.Items})
+			if err != nil {
+				continue
+			}
+			blob := js.Global().Get("Blob").New([]interface{}{string(data)},
+				map[string]interface{}{"type": "application/json"})
+			if !navigator.Call("sendBeacon", url, blob).Bool() {
+				break // The browser's beacon quota is used up
+			}
+			ct.removeFromOutbox(b)
+			ct.countDelivery(&ct.stats.beaconed)
+		}
+	}
+	ct.saveOutbox()
+}
+
+// reportDeliveryStats records what happened to batches since the last
+// report as client metrics, if anything did
+func (ct *ClientTelemetry) reportDeliveryStats() {
+	ct.mu.Lock()
+	stats := ct.stats
+	ct.stats = deliveryStats{}
+	pending := len(ct.outbox)
+	ct.mu.Unlock()
+
+	if !stats.changed {
+		return
+	}
+	ct.RecordMetricWithUnit("telemetry_batches_delivered_total", float64(stats.delivered), "counter", "{batch}", nil)
+	ct.RecordMetricWithUnit("telemetry_batches_beaconed_total", float64(stats.beaconed), "counter", "{batch}", nil)
+	ct.RecordMetricWithUnit("telemetry_batches_retried_total", float64(stats.retried), "counter", "{batch}", nil)
+	ct.RecordMetricWithUnit("telemetry_batches_dropped_total", float64(stats.dropped), "counter", "{batch}", nil)
+	ct.RecordMetricWithUnit("telemetry_outbox_batches", float64(pending), "gauge", "{batch}", nil)
+}
@@ -20,8 +20,73 @@ type ClientEvent struct {
 type ClientMetric struct {
 	Name      string                 `json:"name"`
 	Value     float64                `json:"value"`
-	Type      string                 `json:"type"` // counter, gauge, histogram
+	Type      string                 `json:"type"` // counter, updowncounter, gauge, histogram
+	Unit      string                 `json:"unit,omitempty"`
 	Timestamp time.Time              `json:"timestamp"`
 	SessionID string                 `json:"session_id"`
 	Labels    map[string]interface{} `json:"labels,omitempty"`
-}
\ No newline at end of file
+}
+
+// ClientSpanData is a finished client-side span (shared type)
+type ClientSpanData struct {
+	TraceID       string                 `json:"trace_id"`
+	SpanID        string                 `json:"span_id"`
+	ParentSpanID  string                 `json:"parent_span_id,omitempty"`
+	Name          string                 `json:"name"`
+	StartTime     time.Time              `json:"start_time"`
+	EndTime       time.Time              `json:"end_time"`
+	SessionID     string                 `json:"session_id"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+	Events        []ClientSpanEvent      `json:"events,omitempty"`
+	Status        string                 `json:"status,omitempty"` // SpanStatusOK or SpanStatusError; unset if empty
+	StatusMessage string                 `json:"status_message,omitempty"`
+}
+
+// ClientSpanEvent marks a moment inside a client span, such as an alert being collected
+type ClientSpanEvent struct {
+	Name       string                 `json:"name"`
+	Timestamp  time.Time              `json:"timestamp"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Span statuses a client can report
+const (
+	SpanStatusOK    = "ok"
+	SpanStatusError = "error"
+)
+
+// MaxSpanEvents is the most events a client span may carry; clients drop the rest
+const MaxSpanEvents = 128
+
+// Kinds of item in a telemetry batch
+const (
+	BatchEvent  = "event"
+	BatchMetric = "metric"
+	BatchSpan   = "span"
+)
+
+// BatchItem is one event, metric or span in a batch; Kind says which is set
+type BatchItem struct {
+	Kind   string          `json:"kind"`
+	Event  *ClientEvent    `json:"event,omitempty"`
+	Metric *ClientMetric   `json:"metric,omitempty"`
+	Span   *ClientSpanData `json:"span,omitempty"`
+}
+
+// TelemetryBatch is buffered client telemetry sent in one request (shared type)
+type TelemetryBatch struct {
+	Items []BatchItem `json:"items"`
+}
+
+// BatchResult reports what the server did with a batch
+type BatchResult struct {
+	Accepted int          `json:"accepted"`
+	Rejected int          `json:"rejected"`
+	Errors   []BatchError `json:"errors,omitempty"`
+}
+
+// BatchError says why one item in a batch was rejected
+type BatchError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
@@ -0,0 +1,11 @@
+// Package web holds the game's browser files. They're embedded into the
+// server binary, so build the WebAssembly module (make build) before the server.
+package web
+
+import "embed"
+
+// Assets holds index.html, lobby.html, static/ (wasm_exec.js and the built
+// game.wasm), images/ and scenarios/. Dotfiles such as .gitkeep are left out.
+//
+//go:embed index.html lobby.html static images scenarios
+var Assets embed.FS